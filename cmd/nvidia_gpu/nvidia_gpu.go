@@ -23,17 +23,21 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	gpumanager "github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia"
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/gpusharing"
 	healthcheck "github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/health_check"
 	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/metrics"
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/nvmlutil"
 	util "github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/util"
 	versionvisibility "github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/version_visibility"
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
 	"github.com/golang/glog"
+	"k8s.io/client-go/kubernetes"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
@@ -55,10 +59,26 @@ var (
 	enableContainerGPUMetrics      = flag.Bool("enable-container-gpu-metrics", false, "If true, the device plugin will expose GPU metrics for containers with allocated GPU")
 	enableHealthMonitoring         = flag.Bool("enable-health-monitoring", false, "If true, the device plugin will detect critical Xid errors and mark the GPUs unallocatable")
 	gpuMetricsPort                 = flag.Int("gpu-metrics-port", 2112, "Port on which GPU metrics for containers are exposed")
+	gpuMetricsBindAddress          = flag.String("gpu-metrics-bind-address", "", "Address on which GPU metrics are exposed. Defaults to all interfaces")
+	gpuMetricsTLSCertFile          = flag.String("gpu-metrics-tls-cert-file", "", "If set with '-gpu-metrics-tls-key-file', GPU metrics are served over TLS. The files are reloaded when they change")
+	gpuMetricsTLSKeyFile           = flag.String("gpu-metrics-tls-key-file", "", "Private key for '-gpu-metrics-tls-cert-file'")
+	gpuMetricsAuthorization        = flag.Bool("gpu-metrics-authorization", false, "If true, GPU metrics requests must carry a bearer token allowed to get the metrics path, checked with TokenReview and SubjectAccessReview. Requires '-gpu-metrics-tls-cert-file'")
 	gpuMetricsCollectionIntervalMs = flag.Int("gpu-metrics-collection-interval", 30000, "Collection interval (in milli seconds) for container GPU metrics")
 	gpuConfigFile                  = flag.String("gpu-config", "/etc/nvidia/gpu_config.json", "File with GPU configurations for device plugin")
 	gpuFractionDivisorFile         = flag.String("gpu-fraction-divisor-file", "/etc/nvidia/gpu-fraction-divisor.txt", "File containing the divisor for vGPU machine shapes")
 	publishDriverVersion           = flag.Bool("publish-driver-version", false, "If true, the device plugin will publish NVIDIA driver versions to the Kubernetes Node annotation")
+	enableProcessGPUMetrics        = flag.Bool("enable-process-gpu-metrics", false, "If true, GPU memory and SM utilization of the processes running on the GPUs are exposed per container")
+	containerRuntimeEndpoint       = flag.String("container-runtime-endpoint", "unix:///run/containerd/containerd.sock", "CRI endpoint used to map GPU processes to containers")
+	gpuIdleWindow                  = flag.Duration("gpu-idle-window", 0, "If set, allocated GPUs that stay idle for longer than this window (e.g. 24h) are reported in the idle_seconds metric")
+	gpuIdleDutyCycleThreshold      = flag.Uint("gpu-idle-duty-cycle-threshold", 0, "Duty cycle (in percent) at or below which an allocated GPU is considered idle")
+	gpuIdleMemoryThreshold         = flag.Uint64("gpu-idle-memory-threshold", 0, "Used memory (in bytes) at or below which an allocated GPU is considered idle. 0 ignores memory usage")
+	annotateIdlePods               = flag.Bool("annotate-idle-pods", false, "If true, pods whose GPUs are all idle for longer than '-gpu-idle-window' are annotated with the time since when they are idle")
+	gpuMemoryEnforcement           = flag.String("gpu-memory-enforcement", "", "If set to flag or kill, containers whose processes use more than their share of the memory of a shared GPU are reported with pod events and metrics, and with kill their processes are killed. Requires '-enable-process-gpu-metrics'")
+	otlpEndpoint                   = flag.String("otlp-endpoint", "", "If set, GPU metrics are also pushed to this OTLP endpoint. host:port for grpc, URL for http")
+	otlpProtocol                   = flag.String("otlp-protocol", metrics.OTLPProtocolGRPC, "Protocol used to push GPU metrics to '-otlp-endpoint', either grpc or http")
+	otlpInsecure                   = flag.Bool("otlp-insecure", false, "If true, TLS is disabled for the OTLP grpc exporter")
+	otlpExportIntervalMs           = flag.Int("otlp-export-interval", 0, "Interval (in milli seconds) between OTLP metrics exports. Defaults to '-gpu-metrics-collection-interval'")
+	otlpAcceleratorType            = flag.String("otlp-accelerator-type", "", "Accelerator type reported as an OTLP resource attribute. Defaults to the GPU model")
 )
 
 func parseGPUConfig(gpuConfigFile string) (gpumanager.GPUConfig, error) {
@@ -107,6 +127,50 @@ func parseGPUFractionDivisor(gpuFractionDivisorFile string) (int, error) {
 	return fractionDivisor, nil
 }
 
+// gpuTimesliceUpdater updates the timeslice of the GPUs managed by the device plugin.
+type gpuTimesliceUpdater interface {
+	UpdateTimeslice(config gpumanager.GPUSharingConfig) error
+}
+
+// watchGPUConfig applies timeslice changes of the GPU config file to the GPUs.
+// The directory is watched, so that updates of mounted ConfigMaps are seen as well.
+func watchGPUConfig(gpuConfigFile string, ngm gpuTimesliceUpdater, current gpumanager.GPUSharingConfig) {
+	watcher, err := util.Files(filepath.Dir(gpuConfigFile))
+	if err != nil {
+		glog.Errorf("Failed to watch GPU config file %s: %v", gpuConfigFile, err)
+		return
+	}
+	defer watcher.Close()
+	for {
+		select {
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			gpuConfig, err := parseGPUConfig(gpuConfigFile)
+			if err != nil {
+				glog.V(3).Infof("Ignoring GPU config file change: %v", err)
+				continue
+			}
+			next := gpuConfig.GPUSharingConfig
+			if next.TimesliceClass == current.TimesliceClass && next.CustomTimeslice == current.CustomTimeslice {
+				continue
+			}
+			glog.Infof("GPU timeslice changed from %q to %q", current.TimesliceClass, next.TimesliceClass)
+			if err := ngm.UpdateTimeslice(next); err != nil {
+				glog.Errorf("Failed to update GPU timeslice: %v", err)
+				continue
+			}
+			current = next
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			glog.Infof("inotify: %s", err)
+		}
+	}
+}
+
 func main() {
 	flag.Parse()
 	glog.Infoln("device-plugin started")
@@ -139,7 +203,7 @@ func main() {
 	}
 
 	glog.Infof("Using gpu config: %v", gpuConfig)
-	ngm := gpumanager.NewNvidiaGPUManager(devDirectory, procDirectory, mountPaths, gpuConfig)
+	ngm := gpumanager.NewNvidiaGPUManager(devDirectory, procDirectory, mountPaths, gpuConfig, &nvmlutil.DeviceInfo{})
 
 	// Retry until nvidiactl and nvidia-uvm are detected. This is required
 	// because Nvidia drivers may not be installed initially.
@@ -158,6 +222,16 @@ func main() {
 	}
 	defer nvml.Shutdown()
 
+	if gpuConfig.UsesSharingStrategy(gpusharing.TimeSharing) {
+		if nodeName := os.Getenv("NODE_NAME"); nodeName == "" {
+			glog.Warning("NODE_NAME environment variable not set, skipping publishing GPU timeslice annotations")
+		} else if kubeClient, err := util.BuildKubeClient(); err != nil {
+			glog.Warningf("Failed to build kube client for GPU timeslice annotations: %v", err)
+		} else {
+			ngm.EnableTimesliceAnnotations(kubeClient, nodeName)
+		}
+	}
+
 	for {
 		err := ngm.Start()
 		if err == nil {
@@ -168,18 +242,120 @@ func main() {
 		time.Sleep(5 * time.Second)
 	}
 
+	if gpuConfig.UsesSharingStrategy(gpusharing.TimeSharing) && *gpuConfigFile != "" {
+		go watchGPUConfig(*gpuConfigFile, ngm, gpuConfig.GPUSharingConfig)
+	}
+
+	if gpuConfig.GPUSharingConfig.SlotHeadroom != nil && !*enableContainerGPUMetrics {
+		glog.Warning("SlotHeadroom requires --enable-container-gpu-metrics, advertising all shared GPU slots")
+	}
+
+	metricServerStarted := false
 	if *enableContainerGPUMetrics {
 		if gpuConfig.GPUPartitionSize != "" {
 			glog.Info("Using multi-instance GPU, metrics are not supported.")
 		} else {
 			glog.Infof("Starting metrics server on port: %d, endpoint path: %s, collection frequency: %d", *gpuMetricsPort, "/metrics", *gpuMetricsCollectionIntervalMs)
 			metricServer := metrics.NewMetricServer(*gpuMetricsCollectionIntervalMs, *gpuMetricsPort, "/metrics")
+			metricServer.SetBindAddress(*gpuMetricsBindAddress)
+			if *gpuMetricsTLSCertFile != "" || *gpuMetricsTLSKeyFile != "" {
+				metricServer.EnableTLS(*gpuMetricsTLSCertFile, *gpuMetricsTLSKeyFile)
+			}
+			if *gpuMetricsAuthorization {
+				kubeClient, err := util.BuildKubeClient()
+				if err != nil {
+					glog.Errorf("Failed to build kube client for metrics authorization: %v", err)
+					return
+				}
+				metricServer.EnableAuthorization(kubeClient)
+			}
+			if *enableProcessGPUMetrics {
+				metricServer.EnableProcessMetrics(*containerRuntimeEndpoint)
+			}
+			if *gpuIdleWindow > 0 {
+				var kubeClient kubernetes.Interface
+				if *annotateIdlePods {
+					kubeClient, err = util.BuildKubeClient()
+					if err != nil {
+						glog.Warningf("Failed to build kube client for annotating idle pods: %v", err)
+					}
+				}
+				metricServer.EnableIdleDetection(metrics.IdleConfig{
+					Window:             *gpuIdleWindow,
+					DutyCycleThreshold: *gpuIdleDutyCycleThreshold,
+					MemoryThreshold:    *gpuIdleMemoryThreshold,
+					AnnotatePods:       *annotateIdlePods,
+					NodeName:           os.Getenv("NODE_NAME"),
+				}, kubeClient)
+			}
+			if *gpuMemoryEnforcement != "" {
+				enforcement := metrics.EnforcementConfig{
+					Action:        metrics.EnforcementAction(*gpuMemoryEnforcement),
+					ResourceNames: ngm.ResourceNames(),
+					MemoryLimits:  ngm.MemoryLimits,
+				}
+				if err := enforcement.Validate(); err != nil {
+					glog.Errorf("Invalid GPU memory enforcement: %v", err)
+					return
+				}
+				if !*enableProcessGPUMetrics {
+					glog.Warning("GPU memory enforcement requires -enable-process-gpu-metrics, GPU memory is not enforced")
+				} else if kubeClient, err := util.BuildKubeClient(); err != nil {
+					glog.Warningf("Failed to build kube client for GPU memory violation events: %v", err)
+					metricServer.EnableMemoryEnforcement(enforcement, nil)
+				} else {
+					metricServer.EnableMemoryEnforcement(enforcement, kubeClient)
+				}
+			}
+			if gpuConfig.GPUSharingConfig.SlotHeadroom != nil {
+				metricServer.OnDeviceUsage(func(usage map[string]metrics.DeviceUsage) {
+					allocated, err := metrics.GetAllocatedDeviceIDs(ngm.ResourceNames()...)
+					if err != nil {
+						glog.Errorf("Failed to get allocated devices, keeping the advertised shared GPU slots: %v", err)
+						return
+					}
+					gpuUsage := make(map[string]gpumanager.GPUUsage)
+					for device, u := range usage {
+						gpuUsage[device] = gpumanager.GPUUsage{UsedMemory: u.UsedMemory, TotalMemory: u.TotalMemory, DutyCycle: u.DutyCycle}
+					}
+					ngm.UpdateSlotHeadroom(gpuUsage, allocated)
+				})
+			}
 			err := metricServer.Start()
 			if err != nil {
 				glog.Infof("Failed to start metric server: %v", err)
 				return
 			}
 			defer metricServer.Stop()
+			metricServerStarted = true
+		}
+	}
+
+	if *otlpEndpoint != "" {
+		if gpuConfig.GPUPartitionSize != "" {
+			glog.Info("Using multi-instance GPU, OTLP metrics are not supported.")
+		} else {
+			interval := *otlpExportIntervalMs
+			if interval <= 0 {
+				interval = *gpuMetricsCollectionIntervalMs
+			}
+			exporter, err := metrics.NewOTLPExporter(metrics.OTLPConfig{
+				Endpoint:        *otlpEndpoint,
+				Protocol:        *otlpProtocol,
+				Insecure:        *otlpInsecure,
+				Interval:        time.Millisecond * time.Duration(interval),
+				NodeName:        os.Getenv("NODE_NAME"),
+				AcceleratorType: *otlpAcceleratorType,
+				// Without the metric server, only the node metrics are pushed.
+				CollectNodeMetrics: !metricServerStarted,
+			})
+			if err != nil {
+				glog.Errorf("Failed to create OTLP exporter: %v", err)
+			} else if err := exporter.Start(); err != nil {
+				glog.Errorf("Failed to start OTLP exporter: %v", err)
+			} else {
+				defer exporter.Stop()
+			}
 		}
 	}
 
@@ -189,7 +365,7 @@ func main() {
 			glog.Infof("Failed to build kube client: %v", err)
 			return
 		}
-		hc := healthcheck.NewGPUHealthChecker(ngm.ListPhysicalDevices(), ngm.Health, ngm.ListHealthCriticalXid(), kubeClient)
+		hc := healthcheck.NewGPUHealthChecker(ngm.ListPhysicalDevices(), ngm.Health, ngm.ListHealthCriticalXid(), kubeClient, &healthcheck.GPUDevice{})
 		if err := hc.Start(); err != nil {
 			glog.Infof("Failed to start GPU Health Checker: %v", err)
 			return
@@ -0,0 +1,148 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// config is the configuration file of the plugin.
+type config struct {
+	Allowlist allowlist `json:"allowlist"`
+	// DevicePolicy lists the devices pods may request. Devices not allowed by any rule are denied.
+	DevicePolicy []deviceRule `json:"device_policy"`
+}
+
+// allowlist restricts the mounts, environment variables and hooks that pod
+// annotations may inject into containers. Devices are not restricted.
+type allowlist struct {
+	// MountHostPaths are the host directories which may be mounted read-only, along with everything below them.
+	MountHostPaths []string `json:"mount_host_paths"`
+	// WritableMountHostPaths are the host directories which may also be mounted writable.
+	WritableMountHostPaths []string `json:"writable_mount_host_paths"`
+	// EnvNames are the environment variables which may be set. A trailing * matches any suffix.
+	EnvNames []string `json:"env_names"`
+	// Hooks are the executables which may be run as OCI hooks, with their arguments and environment.
+	Hooks []hookRule `json:"hooks"`
+}
+
+// hookRule allows an executable to be run as an OCI hook. Hooks run on the
+// host, so their arguments and environment are restricted as well.
+type hookRule struct {
+	Path string `json:"path"`
+	// Args are the arguments the hook must be run with, starting with the executable name.
+	Args []string `json:"args"`
+	// EnvNames are the environment variables which may be passed to the hook. A trailing * matches any suffix.
+	EnvNames []string `json:"env_names"`
+}
+
+// defaultConfig allows the NVIDIA GPU devices and driver libraries installed on GKE nodes to be injected.
+func defaultConfig() *config {
+	return &config{
+		Allowlist: allowlist{
+			MountHostPaths: []string{"/home/kubernetes/bin/nvidia"},
+			EnvNames:       []string{"LD_LIBRARY_PATH", "NVIDIA_*"},
+		},
+		DevicePolicy: []deviceRule{{
+			DevicePaths: []string{"/dev/nvidia*", "/dev/nvidia-caps/*"},
+		}},
+	}
+}
+
+// loadConfig reads the configuration file of the plugin. The default
+// configuration is used when the file does not exist.
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultConfig(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	c := &config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	for _, rule := range c.DevicePolicy {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+// allowsMount returns true if the host path is below a host directory
+// allowed to be mounted, writable or read-only.
+func (a *allowlist) allowsMount(hostPath string, writable bool) bool {
+	allowedPaths := a.WritableMountHostPaths
+	if !writable {
+		allowedPaths = append(slices.Clone(a.MountHostPaths), a.WritableMountHostPaths...)
+	}
+	for _, allowed := range allowedPaths {
+		if isSubPath(filepath.Clean(allowed), hostPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsEnv returns true if the environment variable may be set.
+func (a *allowlist) allowsEnv(name string) bool {
+	return matchesName(a.EnvNames, name)
+}
+
+// allowsHook returns true if the executable may be run as a hook with the
+// given arguments and environment.
+func (a *allowlist) allowsHook(path string, args, env []string) bool {
+	for _, rule := range a.Hooks {
+		if filepath.Clean(rule.Path) != path || !slices.Equal(rule.Args, args) {
+			continue
+		}
+		allowed := true
+		for _, e := range env {
+			name, _, _ := strings.Cut(e, "=")
+			if !matchesName(rule.EnvNames, name) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesName returns true if the name matches one of the names, where a trailing * matches any suffix.
+func matchesName(names []string, name string) bool {
+	for _, allowed := range names {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(name, prefix) || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubPath returns true if path is dir or below dir. Both paths must be clean.
+func isSubPath(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
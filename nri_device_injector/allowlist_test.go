@@ -0,0 +1,71 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := loadConfig(filepath.Join(dir, "missing.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, defaultConfig(), c)
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("allowlist: [foo]"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	_, err = loadConfig(invalid)
+	assert.Error(t, err)
+}
+
+func TestAllowlist(t *testing.T) {
+	a := &allowlist{
+		MountHostPaths:         []string{"/home/kubernetes/bin/nvidia/"},
+		WritableMountHostPaths: []string{"/var/cache/nvidia"},
+		EnvNames:               []string{"LD_LIBRARY_PATH", "NVIDIA_*"},
+		Hooks: []hookRule{{
+			Path:     "/usr/bin/nvidia-hook",
+			Args:     []string{"nvidia-hook", "prestart"},
+			EnvNames: []string{"DEBUG"},
+		}},
+	}
+
+	assert.True(t, a.allowsMount("/home/kubernetes/bin/nvidia", false))
+	assert.True(t, a.allowsMount("/home/kubernetes/bin/nvidia/lib64", false))
+	assert.False(t, a.allowsMount("/home/kubernetes/bin/nvidia2", false))
+	assert.False(t, a.allowsMount("/home/kubernetes/bin", false))
+	assert.False(t, a.allowsMount("/home/kubernetes/bin/nvidia", true))
+	assert.True(t, a.allowsMount("/var/cache/nvidia/kernels", true))
+	assert.True(t, a.allowsMount("/var/cache/nvidia/kernels", false))
+
+	assert.True(t, a.allowsEnv("LD_LIBRARY_PATH"))
+	assert.True(t, a.allowsEnv("NVIDIA_VISIBLE_DEVICES"))
+	assert.False(t, a.allowsEnv("LD_LIBRARY_PATH_2"))
+	assert.False(t, a.allowsEnv("CUDA_VISIBLE_DEVICES"))
+
+	assert.True(t, a.allowsHook("/usr/bin/nvidia-hook", []string{"nvidia-hook", "prestart"}, []string{"DEBUG=1"}))
+	assert.True(t, a.allowsHook("/usr/bin/nvidia-hook", []string{"nvidia-hook", "prestart"}, nil))
+	assert.False(t, a.allowsHook("/usr/bin/nvidia-hook2", []string{"nvidia-hook", "prestart"}, nil))
+	assert.False(t, a.allowsHook("/usr/bin/nvidia-hook", []string{"nvidia-hook", "--config=/tmp/config"}, nil))
+	assert.False(t, a.allowsHook("/usr/bin/nvidia-hook", nil, nil))
+	assert.False(t, a.allowsHook("/usr/bin/nvidia-hook", []string{"nvidia-hook", "prestart"}, []string{"LD_PRELOAD=/tmp/lib.so"}))
+}
@@ -0,0 +1,262 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultCDISpecDirs are the directories of the CDI spec files, by increasing priority.
+var defaultCDISpecDirs = []string{"/etc/cdi", "/var/run/cdi"}
+
+// cdiSpec is a Container Device Interface spec file, see
+// https://github.com/cncf-tags/container-device-interface/blob/main/SPEC.md.
+type cdiSpec struct {
+	Version        string            `json:"cdiVersion"`
+	Kind           string            `json:"kind"`
+	Devices        []cdiDevice       `json:"devices"`
+	ContainerEdits cdiContainerEdits `json:"containerEdits"`
+}
+
+type cdiDevice struct {
+	Name           string            `json:"name"`
+	ContainerEdits cdiContainerEdits `json:"containerEdits"`
+}
+
+type cdiContainerEdits struct {
+	Env         []string        `json:"env"`
+	DeviceNodes []cdiDeviceNode `json:"deviceNodes"`
+	Mounts      []cdiMount      `json:"mounts"`
+	Hooks       []cdiHook       `json:"hooks"`
+}
+
+type cdiDeviceNode struct {
+	Path     string `json:"path"`
+	HostPath string `json:"hostPath"`
+	FileMode uint32 `json:"fileMode"`
+	UID      uint32 `json:"uid"`
+	GID      uint32 `json:"gid"`
+}
+
+type cdiMount struct {
+	HostPath      string   `json:"hostPath"`
+	ContainerPath string   `json:"containerPath"`
+	Type          string   `json:"type"`
+	Options       []string `json:"options"`
+}
+
+type cdiHook struct {
+	HookName string   `json:"hookName"`
+	Path     string   `json:"path"`
+	Args     []string `json:"args"`
+	Env      []string `json:"env"`
+	Timeout  *int64   `json:"timeout"`
+}
+
+// cdiEdits are the mounts, environment variables and hooks of the CDI devices injected into a
+// container. They come from the spec files of the node, so they are not checked against the allowlist.
+type cdiEdits struct {
+	mounts []*api.Mount
+	env    []*api.KeyValue
+	hooks  *api.Hooks
+}
+
+// cdiRegistry resolves CDI device references, such as nvidia.com/gpu=0, from the spec files of the node.
+type cdiRegistry struct {
+	specDirs []string
+}
+
+func newCDIRegistry(specDirs []string) *cdiRegistry {
+	return &cdiRegistry{specDirs: specDirs}
+}
+
+// isCDIReference returns true if the device name is a CDI device reference, vendor.com/class=name.
+func isCDIReference(name string) bool {
+	kind, device, ok := strings.Cut(name, "=")
+	vendor, class, _ := strings.Cut(kind, "/")
+	return ok && vendor != "" && class != "" && device != ""
+}
+
+// resolve replaces the CDI device references of the injection by the device nodes of the CDI devices,
+// and adds their other edits to the injection.
+func (r *cdiRegistry) resolve(inj *injection) error {
+	var references []string
+	for _, d := range inj.Devices {
+		if isCDIReference(d.Name) {
+			references = append(references, d.Name)
+		}
+	}
+	if len(references) == 0 {
+		return nil
+	}
+	if r == nil {
+		return fmt.Errorf("CDI device reference %q is not supported", references[0])
+	}
+
+	specDevices := r.loadSpecs()
+	var (
+		devices   []device
+		specEdits = make(map[*cdiSpec]bool)
+	)
+	for _, d := range inj.Devices {
+		if !isCDIReference(d.Name) {
+			devices = append(devices, d)
+			continue
+		}
+		kind, name, _ := strings.Cut(d.Name, "=")
+		kindDevices, ok := specDevices[kind]
+		if !ok {
+			return fmt.Errorf("unresolvable CDI device %q, no spec of kind %s", d.Name, kind)
+		}
+		specDevice, ok := kindDevices[name]
+		if !ok {
+			return fmt.Errorf("unresolvable CDI device %q, no such device in specs of kind %s", d.Name, kind)
+		}
+		if !specEdits[specDevice.spec] {
+			// The edits of a spec apply once, whatever the number of its devices.
+			specEdits[specDevice.spec] = true
+			devices = append(devices, inj.addCDIEdits(specDevice.spec.ContainerEdits)...)
+		}
+		devices = append(devices, inj.addCDIEdits(specDevice.edits)...)
+	}
+	inj.Devices = dedupeDevices(devices)
+	return nil
+}
+
+// cdiSpecDevice is a CDI device along with the spec file defining it.
+type cdiSpecDevice struct {
+	spec  *cdiSpec
+	edits cdiContainerEdits
+}
+
+// loadSpecs returns the devices of the CDI specs of the node by kind and name. Several spec files may
+// define devices of the same kind. A device defined again overrides the earlier one, so that devices of
+// later directories take precedence, and invalid spec files are skipped.
+func (r *cdiRegistry) loadSpecs() map[string]map[string]cdiSpecDevice {
+	specDevices := make(map[string]map[string]cdiSpecDevice)
+	for _, dir := range r.specDirs {
+		var files []string
+		for _, pattern := range []string{"*.json", "*.yaml"} {
+			matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+		// definedIn is the file defining each device of the directory, by kind and name.
+		definedIn := make(map[string]string)
+		for _, file := range files {
+			spec, err := loadCDISpec(file)
+			if err != nil {
+				log.WithError(err).WithField("file", file).Warn("Skipping invalid CDI spec")
+				continue
+			}
+			if specDevices[spec.Kind] == nil {
+				specDevices[spec.Kind] = make(map[string]cdiSpecDevice)
+			}
+			for _, d := range spec.Devices {
+				qualifiedName := spec.Kind + "=" + d.Name
+				if previous, ok := definedIn[qualifiedName]; ok {
+					log.WithField("device", qualifiedName).Warnf("CDI device defined in both %s and %s, using %s", previous, file, file)
+				}
+				definedIn[qualifiedName] = file
+				specDevices[spec.Kind][d.Name] = cdiSpecDevice{spec: spec, edits: d.ContainerEdits}
+			}
+		}
+	}
+	return specDevices
+}
+
+func loadCDISpec(path string) (*cdiSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	spec := &cdiSpec{}
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+	if spec.Version == "" || !strings.Contains(spec.Kind, "/") {
+		return nil, fmt.Errorf("missing cdiVersion or invalid kind %q", spec.Kind)
+	}
+	return spec, nil
+}
+
+// addCDIEdits adds the mounts, environment variables and hooks of the CDI edits to the injection,
+// and returns their device nodes.
+func (inj *injection) addCDIEdits(edits cdiContainerEdits) []device {
+	if inj.cdi == nil {
+		inj.cdi = &cdiEdits{hooks: &api.Hooks{}}
+	}
+	for _, e := range edits.Env {
+		key, value, _ := strings.Cut(e, "=")
+		inj.cdi.env = append(inj.cdi.env, &api.KeyValue{Key: key, Value: value})
+	}
+	for _, m := range edits.Mounts {
+		inj.cdi.mounts = append(inj.cdi.mounts, &api.Mount{
+			Source:      m.HostPath,
+			Destination: m.ContainerPath,
+			Type:        m.Type,
+			Options:     m.Options,
+		})
+	}
+	for _, h := range edits.Hooks {
+		hook := &api.Hook{Path: h.Path, Args: h.Args, Env: h.Env}
+		if h.Timeout != nil {
+			hook.Timeout = &api.OptionalInt{Value: *h.Timeout}
+		}
+		switch h.HookName {
+		case "prestart":
+			inj.cdi.hooks.Prestart = append(inj.cdi.hooks.Prestart, hook)
+		case "createRuntime":
+			inj.cdi.hooks.CreateRuntime = append(inj.cdi.hooks.CreateRuntime, hook)
+		case "createContainer":
+			inj.cdi.hooks.CreateContainer = append(inj.cdi.hooks.CreateContainer, hook)
+		case "startContainer":
+			inj.cdi.hooks.StartContainer = append(inj.cdi.hooks.StartContainer, hook)
+		case "poststart":
+			inj.cdi.hooks.Poststart = append(inj.cdi.hooks.Poststart, hook)
+		case "poststop":
+			inj.cdi.hooks.Poststop = append(inj.cdi.hooks.Poststop, hook)
+		default:
+			log.WithField("hook", h.Path).Warnf("Skipping CDI hook with unknown name %q", h.HookName)
+		}
+	}
+	var devices []device
+	for _, n := range edits.DeviceNodes {
+		devices = append(devices, device{Path: n.Path, hostPath: n.HostPath, FileMode: n.FileMode, UID: n.UID, GID: n.GID})
+	}
+	return devices
+}
+
+// apply adds the CDI mounts, environment variables and hooks to the container adjustment.
+func (e *cdiEdits) apply(adjust *api.ContainerAdjustment) {
+	for _, m := range e.mounts {
+		adjust.AddMount(m)
+	}
+	for _, kv := range e.env {
+		adjust.AddEnv(kv.Key, kv.Value)
+	}
+	h := e.hooks
+	if len(h.Prestart)+len(h.CreateRuntime)+len(h.CreateContainer)+len(h.StartContainer)+len(h.Poststart)+len(h.Poststop) > 0 {
+		adjust.AddHooks(h)
+	}
+}
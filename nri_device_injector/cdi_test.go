@@ -0,0 +1,199 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCDISpec = `
+cdiVersion: 0.6.0
+kind: nvidia.com/gpu
+devices:
+- name: "0"
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia0
+    env:
+    - NVIDIA_VISIBLE_DEVICES=0
+- name: "1"
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia1
+      hostPath: /dev/nvidia-host1
+      fileMode: 438
+containerEdits:
+  deviceNodes:
+  - path: /dev/nvidiactl
+  mounts:
+  - hostPath: /home/kubernetes/bin/nvidia/lib64
+    containerPath: /usr/local/nvidia/lib64
+    options: [ro, nosuid, nodev, bind]
+  hooks:
+  - hookName: createContainer
+    path: /usr/bin/nvidia-cdi-hook
+    args: [nvidia-cdi-hook, update-ldcache]
+`
+
+func writeCDISpec(t *testing.T, dir, name, spec string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(spec), 0644); err != nil {
+		t.Fatalf("failed to write CDI spec: %v", err)
+	}
+}
+
+func TestIsCDIReference(t *testing.T) {
+	tests := map[string]bool{
+		"nvidia.com/gpu=0":   true,
+		"nvidia.com/gpu=all": true,
+		"gpu:all":            false,
+		"gpu:index=0":        false,
+		"nvidia.com/gpu":     false,
+		"nvidia.com/gpu=":    false,
+		"/gpu=0":             false,
+		"":                   false,
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, isCDIReference(name), name)
+	}
+}
+
+func TestCDIResolve(t *testing.T) {
+	etcDir, runDir := t.TempDir(), t.TempDir()
+	writeCDISpec(t, etcDir, "nvidia.yaml", testCDISpec)
+	writeCDISpec(t, etcDir, "invalid.json", `{"kind": "example.com/device"}`)
+	writeCDISpec(t, etcDir, "other.yaml", `
+cdiVersion: 0.6.0
+kind: example.com/device
+devices:
+- name: dev
+  containerEdits:
+    deviceNodes:
+    - path: /dev/example-old
+`)
+	// Devices of later directories override devices of the same kind and name.
+	writeCDISpec(t, runDir, "other.json", `{"cdiVersion": "0.6.0", "kind": "example.com/device", "devices": [{"name": "dev", "containerEdits": {"deviceNodes": [{"path": "/dev/example"}]}}]}`)
+	r := newCDIRegistry([]string{etcDir, runDir})
+
+	inj := &injection{Devices: []device{
+		{Name: "nvidia.com/gpu=0"},
+		{Name: "nvidia.com/gpu=1"},
+		{Path: "/dev/nvidiactl"},
+		{Name: "example.com/device=dev"},
+		{Name: "gpu:all"},
+	}}
+	assert.NoError(t, r.resolve(inj))
+	assert.Equal(t, []device{
+		{Path: "/dev/nvidiactl"},
+		{Path: "/dev/nvidia0"},
+		{Path: "/dev/nvidia1", hostPath: "/dev/nvidia-host1", FileMode: 438},
+		{Path: "/dev/example"},
+		{Name: "gpu:all"},
+	}, inj.Devices)
+
+	// The edits of the spec are applied once along with the edits of each device.
+	adjust := &api.ContainerAdjustment{}
+	inj.apply(adjust)
+	assert.Equal(t, []*api.Mount{{
+		Source:      "/home/kubernetes/bin/nvidia/lib64",
+		Destination: "/usr/local/nvidia/lib64",
+		Options:     []string{"ro", "nosuid", "nodev", "bind"},
+	}}, adjust.Mounts)
+	assert.Equal(t, []*api.KeyValue{{Key: "NVIDIA_VISIBLE_DEVICES", Value: "0"}}, adjust.Env)
+	assert.Equal(t, &api.Hooks{
+		CreateContainer: []*api.Hook{{Path: "/usr/bin/nvidia-cdi-hook", Args: []string{"nvidia-cdi-hook", "update-ldcache"}}},
+	}, adjust.Hooks)
+
+	for _, name := range []string{"nvidia.com/gpu=2", "unknown.com/device=0"} {
+		err := r.resolve(&injection{Devices: []device{{Name: name}}})
+		assert.Error(t, err, name)
+	}
+
+	// Without a registry, CDI device references are rejected.
+	var nilRegistry *cdiRegistry
+	assert.Error(t, nilRegistry.resolve(&injection{Devices: []device{{Name: "nvidia.com/gpu=0"}}}))
+	assert.NoError(t, nilRegistry.resolve(&injection{Devices: []device{{Path: "/dev/nvidia0"}}}))
+}
+
+func TestCDIResolveSpecsOfSameKind(t *testing.T) {
+	etcDir, runDir := t.TempDir(), t.TempDir()
+	writeCDISpec(t, etcDir, "nvidia.yaml", testCDISpec)
+	writeCDISpec(t, etcDir, "nvidia-gpu2.yaml", `
+cdiVersion: 0.6.0
+kind: nvidia.com/gpu
+devices:
+- name: "2"
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia2
+- name: "3"
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia3-old
+containerEdits:
+  env:
+  - NVIDIA_CTK_SPEC=gpu2
+`)
+	// Within a directory, the device of the later file in name order is used.
+	writeCDISpec(t, etcDir, "nvidia-gpu3.yaml", `
+cdiVersion: 0.6.0
+kind: nvidia.com/gpu
+devices:
+- name: "3"
+  containerEdits:
+    deviceNodes:
+    - path: /dev/nvidia3
+`)
+	// A spec of a later directory only overrides the devices it defines.
+	writeCDISpec(t, runDir, "nvidia.json", `{"cdiVersion": "0.6.0", "kind": "nvidia.com/gpu", "devices": [{"name": "1", "containerEdits": {"deviceNodes": [{"path": "/dev/nvidia1-run"}]}}]}`)
+	r := newCDIRegistry([]string{etcDir, runDir})
+
+	inj := &injection{Devices: []device{
+		{Name: "nvidia.com/gpu=0"},
+		{Name: "nvidia.com/gpu=1"},
+		{Name: "nvidia.com/gpu=2"},
+		{Name: "nvidia.com/gpu=3"},
+	}}
+	assert.NoError(t, r.resolve(inj))
+	assert.Equal(t, []device{
+		{Path: "/dev/nvidiactl"},
+		{Path: "/dev/nvidia0"},
+		{Path: "/dev/nvidia1-run"},
+		{Path: "/dev/nvidia2"},
+		{Path: "/dev/nvidia3"},
+	}, inj.Devices)
+
+	// The edits of each spec with a requested device are applied once.
+	adjust := &api.ContainerAdjustment{}
+	inj.apply(adjust)
+	assert.Equal(t, []*api.KeyValue{
+		{Key: "NVIDIA_VISIBLE_DEVICES", Value: "0"},
+		{Key: "NVIDIA_CTK_SPEC", Value: "gpu2"},
+	}, adjust.Env)
+}
+
+func TestAdmitCDIDevices(t *testing.T) {
+	p := &plugin{}
+	pod := &api.PodSandbox{Namespace: "default", Name: "pod"}
+	// The device policy applies to the path of the device on the host.
+	assert.NoError(t, p.admitDevices(context.Background(), pod, []device{{Path: "/dev/gpu0", hostPath: "/dev/nvidia0"}}))
+	assert.Error(t, p.admitDevices(context.Background(), pod, []device{{Path: "/dev/nvidia0", hostPath: "/dev/mem"}}))
+}
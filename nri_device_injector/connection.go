@@ -0,0 +1,115 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/containerd/nri/pkg/stub"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	initialReconnectBackoff = time.Second
+	maxReconnectBackoff     = 30 * time.Second
+)
+
+// connection keeps the plugin connected to the runtime through NRI. A stub cannot be started
+// twice, so a new one is created for each connection attempt.
+type connection struct {
+	newStub func() (stub.Stub, error)
+	// maxAttempts is the number of consecutive failed connection attempts before giving up.
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	mu        sync.Mutex
+	connected bool
+}
+
+func newConnection(newStub func() (stub.Stub, error), maxAttempts int) *connection {
+	return &connection{
+		newStub:        newStub,
+		maxAttempts:    maxAttempts,
+		initialBackoff: initialReconnectBackoff,
+		maxBackoff:     maxReconnectBackoff,
+	}
+}
+
+// run connects to the runtime and reconnects with an exponential backoff when the connection is
+// lost. It returns an error after maxAttempts consecutive failed attempts, or when the context is done.
+func (c *connection) run(ctx context.Context) error {
+	var (
+		backoff  = c.initialBackoff
+		failures = 0
+	)
+	for {
+		s, err := c.newStub()
+		if err == nil {
+			err = s.Start(ctx)
+		}
+		if err == nil {
+			c.setConnected(true)
+			failures, backoff = 0, c.initialBackoff
+			s.Wait()
+			c.setConnected(false)
+			err = fmt.Errorf("NRI connection closed")
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if failures >= c.maxAttempts {
+			return fmt.Errorf("%w, after %d reconnection attempts", err, failures)
+		}
+		failures++
+		log.WithError(err).Warnf("Reconnecting to NRI in %v, attempt %d of %d", backoff, failures, c.maxAttempts)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, c.maxBackoff)
+	}
+}
+
+func (c *connection) setConnected(connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = connected
+	if connected {
+		nriConnected.Set(1)
+	} else {
+		nriConnected.Set(0)
+	}
+}
+
+func (c *connection) isConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// ServeHTTP serves the health of the plugin, which is healthy while connected to the runtime.
+func (c *connection) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if !c.isConnected() {
+		http.Error(w, "not connected to NRI", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
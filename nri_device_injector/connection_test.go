@@ -0,0 +1,109 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/containerd/nri/pkg/stub"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStub fails to start with startErr, or starts and stays connected until the connection is closed.
+// onWait is called while connected.
+type fakeStub struct {
+	startErr error
+	closed   chan struct{}
+	onWait   func()
+}
+
+func (s *fakeStub) Run(ctx context.Context) error {
+	if err := s.Start(ctx); err != nil {
+		return err
+	}
+	s.Wait()
+	return nil
+}
+
+func (s *fakeStub) Start(context.Context) error { return s.startErr }
+func (s *fakeStub) Stop()                       { close(s.closed) }
+
+func (s *fakeStub) Wait() {
+	if s.onWait != nil {
+		s.onWait()
+	}
+	<-s.closed
+}
+
+func (s *fakeStub) UpdateContainers([]*api.ContainerUpdate) ([]*api.ContainerUpdate, error) {
+	return nil, nil
+}
+
+func TestConnectionRun(t *testing.T) {
+	// The connection is lost twice, then connecting fails until the attempts are exhausted.
+	var (
+		stubs = []*fakeStub{
+			{closed: make(chan struct{})},
+			{startErr: fmt.Errorf("connection refused")},
+			{closed: make(chan struct{})},
+			{startErr: fmt.Errorf("connection refused")},
+			{startErr: fmt.Errorf("connection refused")},
+		}
+		attempts = 0
+		health   = make(chan int, len(stubs))
+	)
+	c := newConnection(nil, 2)
+	c.initialBackoff, c.maxBackoff = 0, 0
+	c.newStub = func() (stub.Stub, error) {
+		s := stubs[attempts]
+		attempts++
+		// Report the health while connected, then lose the connection.
+		s.onWait = func() {
+			rec := httptest.NewRecorder()
+			c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			health <- rec.Code
+			s.Stop()
+		}
+		return s, nil
+	}
+
+	err := c.run(context.Background())
+	assert.ErrorContains(t, err, "connection refused, after 2 reconnection attempts")
+	// Failed attempts are only counted since the last connection.
+	assert.Equal(t, 5, attempts)
+	assert.Equal(t, http.StatusOK, <-health)
+	assert.Equal(t, http.StatusOK, <-health)
+
+	assert.False(t, c.isConnected())
+	assert.Equal(t, 0.0, testutil.ToFloat64(nriConnected))
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestConnectionRunWithoutReconnects(t *testing.T) {
+	s := &fakeStub{closed: make(chan struct{})}
+	close(s.closed)
+	c := newConnection(func() (stub.Stub, error) { return s, nil }, 0)
+
+	err := c.run(context.Background())
+	assert.ErrorContains(t, err, "NRI connection closed")
+}
@@ -0,0 +1,272 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/containerd/nri/pkg/api"
+	"sigs.k8s.io/yaml"
+)
+
+// injection is what a device injection annotation injects into a container. The
+// annotation is either a list of devices, or a map with devices, mounts, env and hooks.
+type injection struct {
+	Devices []device `json:"devices"`
+	Mounts  []mount  `json:"mounts"`
+	Env     []envVar `json:"env"`
+	Hooks   hooks    `json:"hooks"`
+
+	// cdi are the edits of the CDI devices, once resolved.
+	cdi *cdiEdits
+}
+
+// mount bind mounts a host path into the container, read-only unless writable is
+// set and the host path is allowed to be mounted writable.
+type mount struct {
+	HostPath      string `json:"host_path"`
+	ContainerPath string `json:"container_path"`
+	Writable      bool   `json:"writable"`
+}
+
+type envVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type hook struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+	// Timeout is in seconds, no timeout is set when 0.
+	Timeout int64 `json:"timeout"`
+}
+
+// hooks are the OCI hooks of a container by lifecycle stage.
+type hooks struct {
+	Prestart        []hook `json:"prestart"`
+	CreateRuntime   []hook `json:"create_runtime"`
+	CreateContainer []hook `json:"create_container"`
+	StartContainer  []hook `json:"start_container"`
+	Poststart       []hook `json:"poststart"`
+	Poststop        []hook `json:"poststop"`
+}
+
+func (h *hooks) all() [][]hook {
+	return [][]hook{h.Prestart, h.CreateRuntime, h.CreateContainer, h.StartContainer, h.Poststart, h.Poststop}
+}
+
+// podInjection is what the pod-wide device injection annotation injects into the containers of a pod.
+type podInjection struct {
+	injection
+	// ExcludeContainers are the containers the pod-wide annotation is not applied to.
+	ExcludeContainers []string `json:"exclude_containers"`
+	// InitContainers are the init containers the pod-wide annotation is applied to, none by default.
+	InitContainers []string `json:"init_containers"`
+}
+
+// getInjection returns the parsed device injection annotation of a container, or nil if there is none.
+// When multiple devices have the same path, only the first one is kept.
+func getInjection(ctrName string, podAnnotations map[string]string) (*injection, error) {
+	deviceKey := ctrDeviceKeyPrefix + ctrName
+	value, ok := podAnnotations[deviceKey]
+	if !ok {
+		return nil, nil
+	}
+	inj := &injection{}
+	if err := parseAnnotation(value, &inj.Devices, inj); err != nil {
+		return nil, fmt.Errorf("invalid device annotation %q: %w", deviceKey, err)
+	}
+	inj.Devices = dedupeDevices(inj.Devices)
+	return inj, nil
+}
+
+// getPodInjection returns the parsed pod-wide device injection annotation, or nil if there is none.
+func getPodInjection(podAnnotations map[string]string) (*podInjection, error) {
+	value, ok := podAnnotations[podDeviceKey]
+	if !ok {
+		return nil, nil
+	}
+	inj := &podInjection{}
+	if err := parseAnnotation(value, &inj.Devices, inj); err != nil {
+		return nil, fmt.Errorf("invalid device annotation %q: %w", podDeviceKey, err)
+	}
+	inj.Devices = dedupeDevices(inj.Devices)
+	return inj, nil
+}
+
+// getContainerInjection returns what the container and pod-wide annotations inject into a container, or
+// nil if there is none. The pod-wide annotation is applied to every container which it does not exclude,
+// and to the init containers it opts in. Devices of the container annotation come first.
+func (p *plugin) getContainerInjection(ctx context.Context, pod *api.PodSandbox, ctrName string) (*injection, error) {
+	inj, err := getInjection(ctrName, pod.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	podInj, err := getPodInjection(pod.Annotations)
+	if err != nil || podInj == nil {
+		return inj, err
+	}
+	if slices.Contains(podInj.ExcludeContainers, ctrName) {
+		return inj, nil
+	}
+	if !slices.Contains(podInj.InitContainers, ctrName) && p.isInitContainer(ctx, pod, ctrName) {
+		return inj, nil
+	}
+	if inj == nil {
+		inj = &injection{}
+	}
+	inj.merge(&podInj.injection)
+	return inj, nil
+}
+
+// parseAnnotation parses an annotation listing devices, or a map with devices, mounts, env and hooks.
+func parseAnnotation(value string, devices *[]device, inj interface{}) error {
+	annotation, err := yaml.YAMLToJSON([]byte(value))
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(annotation), []byte("[")) {
+		// The annotation only lists devices.
+		return yaml.Unmarshal(annotation, devices)
+	}
+	return yaml.Unmarshal(annotation, inj)
+}
+
+// dedupeDevices keeps the first device of each path.
+func dedupeDevices(devices []device) []device {
+	paths := make(map[string]bool)
+	var deduped []device
+	for _, d := range devices {
+		if d.Name != "" {
+			// Symbolic names are deduplicated once resolved.
+			deduped = append(deduped, d)
+		} else if !paths[d.Path] {
+			paths[d.Path] = true
+			deduped = append(deduped, d)
+		}
+	}
+	return deduped
+}
+
+// merge adds the devices, mounts, environment variables and hooks of other. Devices
+// already injected with the same path are kept.
+func (inj *injection) merge(other *injection) {
+	inj.Devices = dedupeDevices(append(inj.Devices, other.Devices...))
+	inj.Mounts = append(inj.Mounts, other.Mounts...)
+	inj.Env = append(inj.Env, other.Env...)
+	inj.Hooks.Prestart = append(inj.Hooks.Prestart, other.Hooks.Prestart...)
+	inj.Hooks.CreateRuntime = append(inj.Hooks.CreateRuntime, other.Hooks.CreateRuntime...)
+	inj.Hooks.CreateContainer = append(inj.Hooks.CreateContainer, other.Hooks.CreateContainer...)
+	inj.Hooks.StartContainer = append(inj.Hooks.StartContainer, other.Hooks.StartContainer...)
+	inj.Hooks.Poststart = append(inj.Hooks.Poststart, other.Hooks.Poststart...)
+	inj.Hooks.Poststop = append(inj.Hooks.Poststop, other.Hooks.Poststop...)
+}
+
+// validate checks the mounts, environment variables and hooks against the allowlist.
+func (inj *injection) validate(a *allowlist) error {
+	for _, m := range inj.Mounts {
+		if !filepath.IsAbs(m.HostPath) || !filepath.IsAbs(m.ContainerPath) {
+			return fmt.Errorf("invalid mount %s:%s, paths must be absolute", m.HostPath, m.ContainerPath)
+		}
+		if !a.allowsMount(filepath.Clean(m.HostPath), m.Writable) {
+			if m.Writable {
+				return fmt.Errorf("writable mount of host path %s is not allowed", m.HostPath)
+			}
+			return fmt.Errorf("mount of host path %s is not allowed", m.HostPath)
+		}
+	}
+	for _, e := range inj.Env {
+		if e.Name == "" {
+			return fmt.Errorf("invalid environment variable without name")
+		}
+		if !a.allowsEnv(e.Name) {
+			return fmt.Errorf("environment variable %s is not allowed", e.Name)
+		}
+	}
+	for _, stage := range inj.Hooks.all() {
+		for _, h := range stage {
+			if !filepath.IsAbs(h.Path) {
+				return fmt.Errorf("invalid hook %s, path must be absolute", h.Path)
+			}
+			if !a.allowsHook(filepath.Clean(h.Path), h.Args, h.Env) {
+				return fmt.Errorf("hook %s is not allowed with its args and env", h.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// empty returns true if the injection injects nothing.
+func (inj *injection) empty() bool {
+	for _, stage := range inj.Hooks.all() {
+		if len(stage) > 0 {
+			return false
+		}
+	}
+	return len(inj.Devices) == 0 && len(inj.Mounts) == 0 && len(inj.Env) == 0 && inj.cdi == nil
+}
+
+// apply adds the mounts, environment variables and hooks, including the edits of CDI devices, to the container adjustment.
+func (inj *injection) apply(adjust *api.ContainerAdjustment) {
+	for _, m := range inj.Mounts {
+		options := []string{"rbind", "nosuid", "nodev"}
+		if !m.Writable {
+			options = append(options, "ro")
+		}
+		adjust.AddMount(&api.Mount{
+			Source:      filepath.Clean(m.HostPath),
+			Destination: filepath.Clean(m.ContainerPath),
+			Type:        "bind",
+			Options:     options,
+		})
+	}
+	for _, e := range inj.Env {
+		adjust.AddEnv(e.Name, e.Value)
+	}
+	h := &api.Hooks{
+		Prestart:        toNRIHooks(inj.Hooks.Prestart),
+		CreateRuntime:   toNRIHooks(inj.Hooks.CreateRuntime),
+		CreateContainer: toNRIHooks(inj.Hooks.CreateContainer),
+		StartContainer:  toNRIHooks(inj.Hooks.StartContainer),
+		Poststart:       toNRIHooks(inj.Hooks.Poststart),
+		Poststop:        toNRIHooks(inj.Hooks.Poststop),
+	}
+	for _, stage := range inj.Hooks.all() {
+		if len(stage) > 0 {
+			adjust.AddHooks(h)
+			break
+		}
+	}
+	if inj.cdi != nil {
+		inj.cdi.apply(adjust)
+	}
+}
+
+func toNRIHooks(hooks []hook) []*api.Hook {
+	var nriHooks []*api.Hook
+	for _, h := range hooks {
+		nriHook := &api.Hook{Path: filepath.Clean(h.Path), Args: h.Args, Env: h.Env}
+		if h.Timeout > 0 {
+			nriHook.Timeout = &api.OptionalInt{Value: h.Timeout}
+		}
+		nriHooks = append(nriHooks, nriHook)
+	}
+	return nriHooks
+}
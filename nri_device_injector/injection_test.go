@@ -0,0 +1,317 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGetInjection(t *testing.T) {
+	annotations := map[string]string{
+		"devices.gke.io/container.test": `
+mounts:
+- host_path: /home/kubernetes/bin/nvidia/lib64
+  container_path: /usr/local/nvidia/lib64
+env:
+- name: NVIDIA_VISIBLE_DEVICES
+  value: all
+hooks:
+  create_runtime:
+  - path: /usr/bin/nvidia-hook
+    args: ["nvidia-hook", "prestart"]
+    timeout: 5
+`}
+	want := &injection{
+		Mounts: []mount{{HostPath: "/home/kubernetes/bin/nvidia/lib64", ContainerPath: "/usr/local/nvidia/lib64"}},
+		Env:    []envVar{{Name: "NVIDIA_VISIBLE_DEVICES", Value: "all"}},
+		Hooks: hooks{
+			CreateRuntime: []hook{{Path: "/usr/bin/nvidia-hook", Args: []string{"nvidia-hook", "prestart"}, Timeout: 5}},
+		},
+	}
+
+	inj, err := getInjection("test", annotations)
+	assert.NoError(t, err)
+	assert.Equal(t, want, inj)
+
+	inj, err = getInjection("other", annotations)
+	assert.NoError(t, err)
+	assert.Nil(t, inj)
+}
+
+func TestInjectionValidate(t *testing.T) {
+	a := &allowlist{
+		MountHostPaths:         []string{"/home/kubernetes/bin/nvidia"},
+		WritableMountHostPaths: []string{"/home/kubernetes/bin/nvidia/cache"},
+		EnvNames:               []string{"LD_LIBRARY_PATH", "NVIDIA_*"},
+		Hooks:                  []hookRule{{Path: "/usr/bin/nvidia-hook", Args: []string{"nvidia-hook"}}},
+	}
+	tests := map[string]struct {
+		inj     injection
+		wantErr bool
+	}{
+		"Nothing injected": {},
+		"Allowed injection": {
+			inj: injection{
+				Mounts: []mount{
+					{HostPath: "/home/kubernetes/bin/nvidia/lib64", ContainerPath: "/usr/local/nvidia/lib64"},
+					{HostPath: "/home/kubernetes/bin/nvidia/cache", ContainerPath: "/cache", Writable: true},
+				},
+				Env:   []envVar{{Name: "LD_LIBRARY_PATH"}, {Name: "NVIDIA_DRIVER_CAPABILITIES", Value: "compute"}},
+				Hooks: hooks{Poststop: []hook{{Path: "/usr/bin/nvidia-hook", Args: []string{"nvidia-hook"}}}},
+			},
+		},
+		"Writable mount not allowed": {
+			inj:     injection{Mounts: []mount{{HostPath: "/home/kubernetes/bin/nvidia/lib64", ContainerPath: "/usr/local/nvidia/lib64", Writable: true}}},
+			wantErr: true,
+		},
+		"Mount outside of allowed directory": {
+			inj:     injection{Mounts: []mount{{HostPath: "/home/kubernetes/bin/nvidia-smi", ContainerPath: "/bin/nvidia-smi"}}},
+			wantErr: true,
+		},
+		"Mount escaping allowed directory": {
+			inj:     injection{Mounts: []mount{{HostPath: "/home/kubernetes/bin/nvidia/../../../etc", ContainerPath: "/etc"}}},
+			wantErr: true,
+		},
+		"Relative mount path": {
+			inj:     injection{Mounts: []mount{{HostPath: "/home/kubernetes/bin/nvidia", ContainerPath: "nvidia"}}},
+			wantErr: true,
+		},
+		"Environment variable not allowed": {
+			inj:     injection{Env: []envVar{{Name: "LD_PRELOAD", Value: "/tmp/lib.so"}}},
+			wantErr: true,
+		},
+		"Hook not allowed": {
+			inj:     injection{Hooks: hooks{Prestart: []hook{{Path: "/bin/sh"}}}},
+			wantErr: true,
+		},
+		"Hook with args not allowed": {
+			inj:     injection{Hooks: hooks{Prestart: []hook{{Path: "/usr/bin/nvidia-hook", Args: []string{"nvidia-hook", "--debug"}}}}},
+			wantErr: true,
+		},
+		"Hook with env not allowed": {
+			inj:     injection{Hooks: hooks{Prestart: []hook{{Path: "/usr/bin/nvidia-hook", Args: []string{"nvidia-hook"}, Env: []string{"LD_PRELOAD=/tmp/lib.so"}}}}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.inj.validate(a)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestInjectionApply(t *testing.T) {
+	inj := &injection{
+		Mounts: []mount{
+			{HostPath: "/home/kubernetes/bin/nvidia/lib64/", ContainerPath: "/usr/local/nvidia/lib64"},
+			{HostPath: "/home/kubernetes/bin/nvidia/cache", ContainerPath: "/cache", Writable: true},
+		},
+		Env:   []envVar{{Name: "NVIDIA_VISIBLE_DEVICES", Value: "all"}},
+		Hooks: hooks{Prestart: []hook{{Path: "/usr/bin/nvidia-hook", Timeout: 5}}},
+	}
+	adjust := &api.ContainerAdjustment{}
+	inj.apply(adjust)
+
+	assert.Equal(t, []*api.Mount{{
+		Source:      "/home/kubernetes/bin/nvidia/lib64",
+		Destination: "/usr/local/nvidia/lib64",
+		Type:        "bind",
+		Options:     []string{"rbind", "nosuid", "nodev", "ro"},
+	}, {
+		Source:      "/home/kubernetes/bin/nvidia/cache",
+		Destination: "/cache",
+		Type:        "bind",
+		Options:     []string{"rbind", "nosuid", "nodev"},
+	}}, adjust.Mounts)
+	assert.Equal(t, []*api.KeyValue{{Key: "NVIDIA_VISIBLE_DEVICES", Value: "all"}}, adjust.Env)
+	assert.Equal(t, &api.Hooks{
+		Prestart: []*api.Hook{{Path: "/usr/bin/nvidia-hook", Timeout: &api.OptionalInt{Value: 5}}},
+	}, adjust.Hooks)
+
+	adjust = &api.ContainerAdjustment{}
+	(&injection{}).apply(adjust)
+	assert.Nil(t, adjust.Hooks)
+}
+
+func TestCreateContainerAllowlist(t *testing.T) {
+	annotations := map[string]string{
+		"devices.gke.io/container.allowed": `
+mounts:
+- host_path: /home/kubernetes/bin/nvidia
+  container_path: /usr/local/nvidia
+env:
+- name: LD_LIBRARY_PATH
+  value: /usr/local/nvidia/lib64
+`,
+		"devices.gke.io/container.rejected": `
+env:
+- name: LD_PRELOAD
+  value: /tmp/lib.so
+`,
+	}
+	pod := &api.PodSandbox{Name: "pod", Namespace: "default", Annotations: annotations}
+	p := &plugin{}
+
+	adjust, _, err := p.CreateContainer(context.Background(), pod, &api.Container{Name: "allowed"})
+	assert.NoError(t, err)
+	assert.Len(t, adjust.Mounts, 1)
+	assert.Equal(t, []*api.KeyValue{{Key: "LD_LIBRARY_PATH", Value: "/usr/local/nvidia/lib64"}}, adjust.Env)
+
+	_, _, err = p.CreateContainer(context.Background(), pod, &api.Container{Name: "rejected"})
+	assert.Error(t, err)
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("allowlist:\n  env_names: [\"LD_*\"]\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	p.config, err = loadConfig(configPath)
+	assert.NoError(t, err)
+
+	adjust, _, err = p.CreateContainer(context.Background(), pod, &api.Container{Name: "rejected"})
+	assert.NoError(t, err)
+	assert.Equal(t, []*api.KeyValue{{Key: "LD_PRELOAD", Value: "/tmp/lib.so"}}, adjust.Env)
+	_, _, err = p.CreateContainer(context.Background(), pod, &api.Container{Name: "allowed"})
+	assert.Error(t, err)
+}
+
+func TestGetContainerInjection(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod", UID: "uid"},
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "init"}, {Name: "setup"}},
+			Containers:     []v1.Container{{Name: "main"}, {Name: "worker"}, {Name: "sidecar"}},
+		},
+	})
+	gets := 0
+	kubeClient.PrependReactor("get", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+	p := &plugin{kubeClient: kubeClient}
+	pod := &api.PodSandbox{
+		Id:        "sandbox",
+		Namespace: "default",
+		Name:      "pod",
+		Uid:       "uid",
+		Annotations: map[string]string{
+			"devices.gke.io/pod": `
+devices:
+- path: /dev/nvidia0
+- path: /dev/nvidiactl
+env:
+- name: NVIDIA_VISIBLE_DEVICES
+  value: "0"
+exclude_containers: [sidecar]
+init_containers: [setup]
+`,
+			"devices.gke.io/container.worker": `
+- path: /dev/nvidia1
+- path: /dev/nvidiactl
+  file_mode: 438
+`,
+		},
+	}
+	podInj := &injection{
+		Devices: []device{{Path: "/dev/nvidia0"}, {Path: "/dev/nvidiactl"}},
+		Env:     []envVar{{Name: "NVIDIA_VISIBLE_DEVICES", Value: "0"}},
+	}
+
+	tests := map[string]struct {
+		container string
+		want      *injection
+	}{
+		"Container": {
+			container: "main",
+			want:      podInj,
+		},
+		"Container merged with its own annotation": {
+			container: "worker",
+			want: &injection{
+				Devices: []device{{Path: "/dev/nvidia1"}, {Path: "/dev/nvidiactl", FileMode: 438}, {Path: "/dev/nvidia0"}},
+				Env:     []envVar{{Name: "NVIDIA_VISIBLE_DEVICES", Value: "0"}},
+			},
+		},
+		"Excluded container": {
+			container: "sidecar",
+		},
+		"Init container": {
+			container: "init",
+		},
+		"Opted in init container": {
+			container: "setup",
+			want:      podInj,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			inj, err := p.getContainerInjection(context.Background(), pod, tc.container)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, inj)
+		})
+	}
+
+	// The init containers of the pod are read once.
+	assert.Equal(t, 1, gets)
+
+	// Without the pod spec, init containers cannot be told apart, and get the pod-wide annotation.
+	assert.NoError(t, p.RemovePodSandbox(context.Background(), pod))
+	p.kubeClient = nil
+	inj, err := p.getContainerInjection(context.Background(), pod, "init")
+	assert.NoError(t, err)
+	assert.Equal(t, podInj, inj)
+	inj, err = p.getContainerInjection(context.Background(), pod, "setup")
+	assert.NoError(t, err)
+	assert.Equal(t, podInj, inj)
+
+	// The same happens when the API server fails, and the init containers are read again afterwards.
+	failing := fake.NewSimpleClientset()
+	failing.PrependReactor("get", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("connection refused")
+	})
+	p.kubeClient = failing
+	inj, err = p.getContainerInjection(context.Background(), pod, "init")
+	assert.NoError(t, err)
+	assert.Equal(t, podInj, inj)
+	p.kubeClient = kubeClient
+	inj, err = p.getContainerInjection(context.Background(), pod, "init")
+	assert.NoError(t, err)
+	assert.Nil(t, inj)
+
+	// Pod-wide annotations only listing devices do not opt in any init container.
+	p.kubeClient = kubeClient
+	pod.Annotations = map[string]string{"devices.gke.io/pod": "- gpu:all"}
+	inj, err = p.getContainerInjection(context.Background(), pod, "setup")
+	assert.NoError(t, err)
+	assert.Nil(t, inj)
+	inj, err = p.getContainerInjection(context.Background(), pod, "main")
+	assert.NoError(t, err)
+	assert.Equal(t, &injection{Devices: []device{{Name: "gpu:all"}}}, inj)
+}
@@ -0,0 +1,132 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/containerd/nri/pkg/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// containerDevices are the devices injected into a container.
+type containerDevices struct {
+	ID        string   `json:"id"`
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+	Container string   `json:"container"`
+	Devices   []string `json:"devices"`
+	Stopped   bool     `json:"stopped"`
+
+	// rules are the cgroup rules allowing access to the devices.
+	rules []*api.LinuxDeviceCgroup
+}
+
+// inventoryStatus is the inventory served on the status endpoint.
+type inventoryStatus struct {
+	Containers []containerDevices `json:"containers"`
+	// Devices are the IDs of the running containers using each device.
+	Devices map[string][]string `json:"devices"`
+}
+
+// inventory tracks which devices are injected into which containers, from their
+// creation until their removal.
+type inventory struct {
+	mu         sync.Mutex
+	containers map[string]*containerDevices
+}
+
+func (i *inventory) add(c *containerDevices) {
+	if len(c.Devices) == 0 {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.containers == nil {
+		i.containers = make(map[string]*containerDevices)
+	}
+	i.containers[c.ID] = c
+}
+
+// cgroupRules returns the cgroup rules of the devices injected into a container.
+func (i *inventory) cgroupRules(id string) []*api.LinuxDeviceCgroup {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if c, ok := i.containers[id]; ok {
+		return c.rules
+	}
+	return nil
+}
+
+// stop marks a container stopped, and returns false if the container has no injected devices.
+func (i *inventory) stop(id string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	c, ok := i.containers[id]
+	if ok {
+		c.Stopped = true
+	}
+	return ok
+}
+
+// remove forgets a container, and returns false if the container has no injected devices.
+func (i *inventory) remove(id string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, ok := i.containers[id]
+	delete(i.containers, id)
+	return ok
+}
+
+func (i *inventory) status() inventoryStatus {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	status := inventoryStatus{
+		Containers: []containerDevices{},
+		Devices:    make(map[string][]string),
+	}
+	for _, c := range i.containers {
+		status.Containers = append(status.Containers, *c)
+		if c.Stopped {
+			continue
+		}
+		for _, d := range c.Devices {
+			status.Devices[d] = append(status.Devices[d], c.ID)
+		}
+	}
+	sort.Slice(status.Containers, func(a, b int) bool { return status.Containers[a].ID < status.Containers[b].ID })
+	for _, ids := range status.Devices {
+		sort.Strings(ids)
+	}
+	return status
+}
+
+// reset forgets all the containers.
+func (i *inventory) reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.containers = nil
+}
+
+// ServeHTTP serves the inventory as JSON.
+func (i *inventory) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(i.status()); err != nil {
+		log.WithError(err).Warn("Failed to write inventory status")
+	}
+}
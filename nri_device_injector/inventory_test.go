@@ -0,0 +1,106 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgroupRule(t *testing.T) {
+	rule := cgroupRule(&api.LinuxDevice{Path: "/dev/nvidia0", Type: charDevice, Major: 195, Minor: 0})
+	assert.Equal(t, &api.LinuxDeviceCgroup{Allow: true, Type: "c", Major: api.Int64(195), Minor: api.Int64(0), Access: "rw"}, rule)
+
+	rule = cgroupRule(&api.LinuxDevice{Path: "/dev/sdb", Type: blockDevice, Major: 8, Minor: 16})
+	assert.Equal(t, "rwm", rule.Access)
+
+	adjust := &api.ContainerAdjustment{}
+	addCgroupRule(adjust, rule)
+	assert.Equal(t, []*api.LinuxDeviceCgroup{rule}, adjust.Linux.Resources.Devices)
+}
+
+func TestInventoryLifecycle(t *testing.T) {
+	nvidia0 := &api.LinuxDeviceCgroup{Allow: true, Type: "c", Major: api.Int64(195), Minor: api.Int64(0), Access: "rw"}
+	nvidiactl := &api.LinuxDeviceCgroup{Allow: true, Type: "c", Major: api.Int64(195), Minor: api.Int64(255), Access: "rw"}
+	p := &plugin{}
+	p.inventory.add(&containerDevices{
+		ID: "ctr1", Namespace: "default", Pod: "pod1", Container: "test",
+		Devices: []string{"/dev/nvidia0", "/dev/nvidiactl"},
+		rules:   []*api.LinuxDeviceCgroup{nvidia0, nvidiactl},
+	})
+	p.inventory.add(&containerDevices{
+		ID: "ctr2", Namespace: "default", Pod: "pod2", Container: "test",
+		Devices: []string{"/dev/nvidiactl"},
+		rules:   []*api.LinuxDeviceCgroup{nvidiactl},
+	})
+	p.inventory.add(&containerDevices{ID: "ctr3", Namespace: "default", Pod: "pod3", Container: "test"})
+	pod := &api.PodSandbox{Namespace: "default", Name: "pod1"}
+	ctr1 := &api.Container{Id: "ctr1", Name: "test"}
+
+	// Updates without device rules are left untouched.
+	updates, err := p.UpdateContainer(context.Background(), pod, ctr1, &api.LinuxResources{})
+	assert.NoError(t, err)
+	assert.Nil(t, updates)
+
+	// Updates with device rules get the rules of the injected devices back.
+	resources := &api.LinuxResources{Devices: []*api.LinuxDeviceCgroup{
+		{Allow: false, Access: "rwm"},
+		nvidia0,
+	}}
+	updates, err = p.UpdateContainer(context.Background(), pod, ctr1, resources)
+	assert.NoError(t, err)
+	if assert.Len(t, updates, 1) {
+		assert.Equal(t, "ctr1", updates[0].ContainerId)
+		assert.Equal(t, []*api.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}, nvidia0, nvidiactl}, updates[0].Linux.Resources.Devices)
+	}
+
+	// Containers without injected devices are not updated.
+	updates, err = p.UpdateContainer(context.Background(), pod, &api.Container{Id: "ctr3"}, &api.LinuxResources{Devices: []*api.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}}})
+	assert.NoError(t, err)
+	assert.Nil(t, updates)
+
+	_, err = p.StopContainer(context.Background(), pod, ctr1)
+	assert.NoError(t, err)
+	status := p.inventory.status()
+	assert.Equal(t, []string{"ctr1", "ctr2"}, []string{status.Containers[0].ID, status.Containers[1].ID})
+	assert.True(t, status.Containers[0].Stopped)
+	assert.Equal(t, map[string][]string{"/dev/nvidiactl": {"ctr2"}}, status.Devices)
+
+	assert.NoError(t, p.RemoveContainer(context.Background(), pod, ctr1))
+	status = p.inventory.status()
+	assert.Len(t, status.Containers, 1)
+	assert.Nil(t, p.inventory.cgroupRules("ctr1"))
+}
+
+func TestInventoryServeHTTP(t *testing.T) {
+	inv := &inventory{}
+	inv.add(&containerDevices{ID: "ctr1", Namespace: "default", Pod: "pod1", Container: "test", Devices: []string{"/dev/nvidia0"}})
+
+	w := httptest.NewRecorder()
+	inv.ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var status inventoryStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, inventoryStatus{
+		Containers: []containerDevices{{ID: "ctr1", Namespace: "default", Pod: "pod1", Container: "test", Devices: []string{"/dev/nvidia0"}}},
+		Devices:    map[string][]string{"/dev/nvidia0": {"ctr1"}},
+	}, status)
+}
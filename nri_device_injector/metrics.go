@@ -0,0 +1,54 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons of the failed injections.
+const (
+	invalidAnnotationFailure = "invalid_annotation"
+	unresolvedDeviceFailure  = "unresolved_device"
+	deniedFailure            = "denied"
+	invalidMPSLimitsFailure  = "invalid_mps_limits"
+	deviceNotFoundFailure    = "device_not_found"
+)
+
+var (
+	// injections counts the containers created with injected devices, mounts, environment variables or hooks.
+	injections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "device_injector_injections_total",
+			Help: "Number of containers created with injected devices, mounts, environment variables or hooks",
+		},
+		[]string{"namespace"})
+
+	// injectionFailures counts the container creations failed by the plugin.
+	injectionFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "device_injector_injection_failures_total",
+			Help: "Number of container creations failed by the device injector",
+		},
+		[]string{"namespace", "reason"})
+
+	// nriConnected reports the state of the connection to the runtime.
+	nriConnected = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "device_injector_nri_connected",
+			Help: "Whether the device injector is connected to the runtime through NRI",
+		})
+)
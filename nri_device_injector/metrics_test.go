@@ -0,0 +1,55 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateContainerMetrics(t *testing.T) {
+	const namespace = "metrics"
+	pod := &api.PodSandbox{Name: "pod", Namespace: namespace, Annotations: map[string]string{
+		"devices.gke.io/container.env": `
+env:
+- name: NVIDIA_VISIBLE_DEVICES
+  value: all
+`,
+		"devices.gke.io/container.invalid":    "devices: {",
+		"devices.gke.io/container.denied":     "- path: /dev/mem",
+		"devices.gke.io/container.missing":    "- path: /dev/nvidia-missing",
+		"devices.gke.io/container.unresolved": "- gpu:all",
+	}}
+	p := &plugin{}
+
+	for _, ctr := range []string{"env", "unannotated"} {
+		_, _, err := p.CreateContainer(context.Background(), pod, &api.Container{Name: ctr})
+		assert.NoError(t, err, ctr)
+	}
+	for _, ctr := range []string{"invalid", "denied", "missing", "unresolved"} {
+		_, _, err := p.CreateContainer(context.Background(), pod, &api.Container{Name: ctr})
+		assert.Error(t, err, ctr)
+	}
+
+	// Containers without injections are not counted.
+	assert.Equal(t, 1.0, testutil.ToFloat64(injections.WithLabelValues(namespace)))
+	for _, reason := range []string{invalidAnnotationFailure, deniedFailure, deviceNotFoundFailure, unresolvedDeviceFailure} {
+		assert.Equal(t, 1.0, testutil.ToFloat64(injectionFailures.WithLabelValues(namespace, reason)), reason)
+	}
+}
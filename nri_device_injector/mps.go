@@ -0,0 +1,173 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	mpsKeyPrefix = "mps.gke.io"
+	// Key prefix for MPS limit overrides of a container, followed by container name
+	ctrMPSKeyPrefix = mpsKeyPrefix + "/container."
+
+	// Environment variables set by the GPU device plugin for MPS containers.
+	mpsThreadLimitEnv = "CUDA_MPS_ACTIVE_THREAD_PERCENTAGE"
+	mpsMemLimitEnv    = "CUDA_MPS_PINNED_DEVICE_MEM_LIMIT"
+)
+
+// mpsLimits overrides the MPS limits the device plugin allocated to a container.
+type mpsLimits struct {
+	// ActiveThreadPercentage may only lower the active thread percentage
+	// allocated by the device plugin.
+	ActiveThreadPercentage int `json:"active_thread_percentage"`
+	// PinnedDeviceMemoryLimit is either a single limit for all GPUs of the
+	// container, e.g. 4G, or a limit per GPU, e.g. 0=4096M,1=2G. It may only
+	// lower the memory limit allocated by the device plugin.
+	PinnedDeviceMemoryLimit string `json:"pinned_device_memory_limit"`
+}
+
+// getMPSLimits returns the parsed MPS limit overrides from pod annotations.
+func getMPSLimits(ctrName string, podAnnotations map[string]string) (*mpsLimits, error) {
+	mpsKey := ctrMPSKeyPrefix + ctrName
+	value, ok := podAnnotations[mpsKey]
+	if !ok {
+		return nil, nil
+	}
+	limits := &mpsLimits{}
+	if err := yaml.Unmarshal([]byte(value), limits); err != nil {
+		return nil, fmt.Errorf("invalid MPS annotation %q: %w", mpsKey, err)
+	}
+	return limits, nil
+}
+
+// mpsEnv returns the MPS environment variables for a container with the
+// given environment, after applying the limit overrides.
+func mpsEnv(limits *mpsLimits, env []string) (map[string]string, error) {
+	allocated := make(map[string]string)
+	for _, e := range env {
+		key, value, _ := strings.Cut(e, "=")
+		if key == mpsThreadLimitEnv || key == mpsMemLimitEnv {
+			allocated[key] = value
+		}
+	}
+	if len(allocated) == 0 {
+		return nil, fmt.Errorf("MPS limits annotated on a container without MPS GPUs")
+	}
+
+	adjusted := make(map[string]string)
+	if limits.ActiveThreadPercentage != 0 {
+		if limits.ActiveThreadPercentage < 1 || limits.ActiveThreadPercentage > 100 {
+			return nil, fmt.Errorf("invalid active thread percentage %d, must be between 1 and 100", limits.ActiveThreadPercentage)
+		}
+		allocatedPercentage, err := strconv.Atoi(allocated[mpsThreadLimitEnv])
+		if err != nil {
+			return nil, fmt.Errorf("invalid allocated %s: %v", mpsThreadLimitEnv, err)
+		}
+		if limits.ActiveThreadPercentage > allocatedPercentage {
+			return nil, fmt.Errorf("active thread percentage %d exceeds the allocated %d", limits.ActiveThreadPercentage, allocatedPercentage)
+		}
+		adjusted[mpsThreadLimitEnv] = strconv.Itoa(limits.ActiveThreadPercentage)
+	}
+	if limits.PinnedDeviceMemoryLimit != "" {
+		allocatedMemory, err := parseMemoryLimits(allocated[mpsMemLimitEnv])
+		if err != nil {
+			return nil, fmt.Errorf("invalid allocated %s: %v", mpsMemLimitEnv, err)
+		}
+		requested := make(map[int]int64)
+		if strings.Contains(limits.PinnedDeviceMemoryLimit, "=") {
+			if requested, err = parseMemoryLimits(limits.PinnedDeviceMemoryLimit); err != nil {
+				return nil, err
+			}
+		} else {
+			limitMB, err := parseMemoryMB(limits.PinnedDeviceMemoryLimit)
+			if err != nil {
+				return nil, err
+			}
+			for device := range allocatedMemory {
+				requested[device] = limitMB
+			}
+		}
+		for device, limitMB := range requested {
+			allocatedMB, ok := allocatedMemory[device]
+			if !ok {
+				return nil, fmt.Errorf("memory limit set for GPU %d, which is not allocated to the container", device)
+			}
+			if limitMB > allocatedMB {
+				return nil, fmt.Errorf("memory limit %dM for GPU %d exceeds the allocated %dM", limitMB, device, allocatedMB)
+			}
+			allocatedMemory[device] = limitMB
+		}
+		adjusted[mpsMemLimitEnv] = formatMemoryLimits(allocatedMemory)
+	}
+	return adjusted, nil
+}
+
+// parseMemoryLimits parses per-GPU memory limits such as 0=4096M,1=2G into MiB per GPU index.
+func parseMemoryLimits(value string) (map[int]int64, error) {
+	limits := make(map[int]int64)
+	for _, limit := range strings.Split(value, ",") {
+		device, memory, ok := strings.Cut(strings.TrimSpace(limit), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid memory limit %q, must be <GPU index>=<limit>", limit)
+		}
+		index, err := strconv.Atoi(device)
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid GPU index %q", device)
+		}
+		if limits[index], err = parseMemoryMB(memory); err != nil {
+			return nil, err
+		}
+	}
+	return limits, nil
+}
+
+// parseMemoryMB parses a memory limit with an M or G suffix into MiB.
+func parseMemoryMB(value string) (int64, error) {
+	value = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1024
+		value = strings.TrimSuffix(value, "G")
+	case strings.HasSuffix(value, "M"):
+		value = strings.TrimSuffix(value, "M")
+	default:
+		return 0, fmt.Errorf("invalid memory limit %q, must end with M or G", value)
+	}
+	memory, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || memory <= 0 {
+		return 0, fmt.Errorf("invalid memory limit %q", value)
+	}
+	return memory * multiplier, nil
+}
+
+func formatMemoryLimits(limits map[int]int64) string {
+	devices := make([]int, 0, len(limits))
+	for device := range limits {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+	formatted := make([]string, 0, len(devices))
+	for _, device := range devices {
+		formatted = append(formatted, fmt.Sprintf("%d=%dM", device, limits[device]))
+	}
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,127 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMPSEnv(t *testing.T) {
+	allocated := []string{
+		"PATH=/usr/bin",
+		"CUDA_MPS_ACTIVE_THREAD_PERCENTAGE=20",
+		"CUDA_MPS_PINNED_DEVICE_MEM_LIMIT=0=16384M,1=8192M",
+	}
+	tests := map[string]struct {
+		limits  mpsLimits
+		env     []string
+		want    map[string]string
+		wantErr bool
+	}{
+		"Lower thread percentage": {
+			limits: mpsLimits{ActiveThreadPercentage: 15},
+			env:    allocated,
+			want:   map[string]string{mpsThreadLimitEnv: "15"},
+		},
+		"Thread percentage above allocation": {
+			limits:  mpsLimits{ActiveThreadPercentage: 60},
+			env:     allocated,
+			wantErr: true,
+		},
+		"Thread percentage without allocated percentage": {
+			limits:  mpsLimits{ActiveThreadPercentage: 10},
+			env:     []string{"CUDA_MPS_PINNED_DEVICE_MEM_LIMIT=0=16384M"},
+			wantErr: true,
+		},
+		"Invalid thread percentage": {
+			limits:  mpsLimits{ActiveThreadPercentage: 101},
+			env:     allocated,
+			wantErr: true,
+		},
+		"Single memory limit for all GPUs": {
+			limits: mpsLimits{PinnedDeviceMemoryLimit: "4G"},
+			env:    allocated,
+			want:   map[string]string{mpsMemLimitEnv: "0=4096M,1=4096M"},
+		},
+		"Memory limit per GPU": {
+			limits: mpsLimits{ActiveThreadPercentage: 10, PinnedDeviceMemoryLimit: "1=2048MB"},
+			env:    allocated,
+			want:   map[string]string{mpsThreadLimitEnv: "10", mpsMemLimitEnv: "0=16384M,1=2048M"},
+		},
+		"Memory limit above allocation": {
+			limits:  mpsLimits{PinnedDeviceMemoryLimit: "10G"},
+			env:     allocated,
+			wantErr: true,
+		},
+		"Memory limit for GPU not allocated": {
+			limits:  mpsLimits{PinnedDeviceMemoryLimit: "2=1G"},
+			env:     allocated,
+			wantErr: true,
+		},
+		"Memory limit without unit": {
+			limits:  mpsLimits{PinnedDeviceMemoryLimit: "4096"},
+			env:     allocated,
+			wantErr: true,
+		},
+		"Container without MPS GPUs": {
+			limits:  mpsLimits{ActiveThreadPercentage: 50},
+			env:     []string{"PATH=/usr/bin"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			env, err := mpsEnv(&tc.limits, tc.env)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("mpsEnv() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr {
+				assert.Equal(t, tc.want, env)
+			}
+		})
+	}
+}
+
+func TestCreateContainerMPSLimits(t *testing.T) {
+	p := &plugin{}
+	pod := &api.PodSandbox{
+		Name:      "inference",
+		Namespace: "default",
+		Annotations: map[string]string{
+			"mps.gke.io/container.server": "active_thread_percentage: 5\npinned_device_memory_limit: 2G\n",
+		},
+	}
+	container := &api.Container{
+		Name: "server",
+		Env:  []string{"CUDA_MPS_ACTIVE_THREAD_PERCENTAGE=10", "CUDA_MPS_PINNED_DEVICE_MEM_LIMIT=0=8192M"},
+	}
+	adjust, _, err := p.CreateContainer(context.Background(), pod, container)
+	assert.NoError(t, err)
+	env := make(map[string]string)
+	for _, kv := range adjust.Env {
+		env[kv.Key] = kv.Value
+	}
+	assert.Equal(t, map[string]string{mpsThreadLimitEnv: "5", mpsMemLimitEnv: "0=2048M"}, env)
+
+	// Other containers of the pod are not adjusted.
+	adjust, _, err = p.CreateContainer(context.Background(), pod, &api.Container{Name: "sidecar"})
+	assert.NoError(t, err)
+	assert.Empty(t, adjust.Env)
+}
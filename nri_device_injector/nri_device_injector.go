@@ -16,23 +16,35 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
 
 	"golang.org/x/sys/unix"
-	"sigs.k8s.io/yaml"
 
 	"github.com/containerd/nri/pkg/api"
 	"github.com/containerd/nri/pkg/stub"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/nvmlutil"
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/util"
 )
 
 const (
 	deviceKeyPrefix = "devices.gke.io"
 	// Key prefix for device injection to a container, followed by container name
 	ctrDeviceKeyPrefix = deviceKeyPrefix + "/container."
-	pluginName         = "device_injector_nri"
-	pluginIdx          = "10"
+	// Key for device injection to all containers of a pod
+	podDeviceKey      = deviceKeyPrefix + "/pod"
+	pluginName        = "device_injector_nri"
+	pluginIdx         = "10"
+	defaultConfigPath = "/etc/nri-device-injector/config.yaml"
 	// Device types.
 	blockDevice = "b"
 	charDevice  = "c"
@@ -40,6 +52,8 @@ const (
 )
 
 type device struct {
+	// Name is a symbolic device name, such as gpu:all, resolved on the node into device paths.
+	Name     string `json:"name"`
 	Path     string `json:"path"`
 	Type     string `json:"type"`
 	Major    int64  `json:"major"`
@@ -47,43 +61,111 @@ type device struct {
 	FileMode uint32 `json:"file_mode"`
 	UID      uint32 `json:"uid"`
 	GID      uint32 `json:"gid"`
+
+	// hostPath is the path of the device on the host, when different from its path in the container.
+	hostPath string
+}
+
+// UnmarshalJSON parses a device, which can also be annotated with only its symbolic name.
+func (d *device) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*d = device{Name: name}
+		return nil
+	}
+	type plainDevice device
+	return json.Unmarshal(data, (*plainDevice)(d))
 }
 
 type plugin struct {
-	stub stub.Stub
+	stub   stub.Stub
+	config *config
+	// kubeClient gets the service accounts of pods, and recorder reports denied injections as pod events.
+	// Both are nil when not running in a cluster.
+	kubeClient kubernetes.Interface
+	recorder   record.EventRecorder
+	// resolver resolves symbolic device names, and cdi CDI device references. Both are rejected when nil.
+	resolver *deviceResolver
+	cdi      *cdiRegistry
+	// inventory tracks the devices injected into containers.
+	inventory inventory
+	// initContainers caches the init container names of the pods with the pod-wide device annotation, by pod sandbox ID.
+	initContainers initContainerCache
 }
 
 func main() {
 	var (
+		configPath    = flag.String("config", defaultConfigPath, "Path of the configuration file with the allowlist of injected mounts, environment variables and hooks. The defaults are used when the file does not exist.")
+		cdiSpecDirs   = flag.String("cdi-spec-dirs", strings.Join(defaultCDISpecDirs, ","), "Comma-separated directories of the CDI spec files resolving CDI device references, by increasing priority.")
+		statusAddress = flag.String("status-address", "127.0.0.1:2113", "Address of the status endpoint serving the devices injected into containers on /status, the metrics on /metrics and the health on /healthz, disabled when empty.")
+		reconnects    = flag.Int("max-reconnect-attempts", 10, "Number of consecutive failed attempts to reconnect to NRI, with an exponential backoff, before exiting. The plugin exits as soon as the connection is lost when 0.")
+
 		opts []stub.Option
 		err  error
 	)
+	flag.Parse()
 
 	opts = append(opts, stub.WithPluginName(pluginName))
 	opts = append(opts, stub.WithPluginIdx(pluginIdx))
 
 	p := &plugin{}
-
-	if p.stub, err = stub.New(p, append(opts, stub.WithOnClose(p.onClose))...); err != nil {
-		log.Errorf("Failed to create plugin stub: %v", err)
+	if p.config, err = loadConfig(*configPath); err != nil {
+		log.Errorf("Failed to load config: %v", err)
 		os.Exit(1)
 	}
+	if p.kubeClient, err = util.BuildKubeClient(); err != nil {
+		log.Warnf("Failed to build kube client, denied injections are not reported as events and device policy rules with service accounts deny all devices: %v", err)
+	} else {
+		p.recorder = newEventRecorder(p.kubeClient)
+	}
+	p.resolver = newDeviceResolver(&nvmlutil.DeviceInfo{}, loadNVML)
+	p.cdi = newCDIRegistry(strings.Split(*cdiSpecDirs, ","))
 
-	err = p.stub.Run(context.Background())
-	if err != nil {
+	conn := newConnection(func() (stub.Stub, error) {
+		s, err := stub.New(p, append(opts, stub.WithOnClose(p.onClose))...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create plugin stub: %w", err)
+		}
+		p.stub = s
+		return s, nil
+	}, *reconnects)
+
+	if *statusAddress != "" {
+		go serveStatus(*statusAddress, &p.inventory, conn)
+	}
+
+	if err = conn.run(context.Background()); err != nil {
 		log.Errorf("plugin exited with error %v", err)
 		os.Exit(1)
 	}
 }
 
+// serveStatus serves the inventory of the injected devices for debugging, the metrics and the health of the plugin.
+func serveStatus(address string, inv *inventory, conn *connection) {
+	mux := http.NewServeMux()
+	mux.Handle("/status", inv)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", conn)
+	log.Infof("Serving status on %s/status, metrics on %s/metrics and health on %s/healthz", address, address, address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		log.Errorf("Failed to serve status: %v", err)
+		os.Exit(1)
+	}
+}
+
 func (p *plugin) onClose() {
-	log.Info("NRI connection closed")
+	log.Warn("NRI connection closed")
 }
 
 // CreateContainer handles CreateContainer requests relayed to the plugin by containerd NRI.
-// The plugin makes adjustment on containers with device injection annotations.
+// The plugin makes adjustment on containers with device injection or MPS limit annotations.
+// The pod-wide device injection annotation is merged after the annotation of the container.
 // When multiple annotations annotate devices with the same path, only the first one will be injected.
-func (p *plugin) CreateContainer(_ context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
+// Symbolic device names and CDI device references are resolved into devices on the node. Devices are only injected when
+// allowed by the device policy, along with the cgroup rules allowing their access, and mounts,
+// environment variables and hooks when allowed by the allowlist. Denied injections fail the container
+// creation and are reported as pod events. The devices injected are tracked until the container is removed.
+func (p *plugin) CreateContainer(ctx context.Context, pod *api.PodSandbox, container *api.Container) (*api.ContainerAdjustment, []*api.ContainerUpdate, error) {
 	if pod == nil {
 		return nil, nil, nil
 	}
@@ -92,66 +174,220 @@ func (p *plugin) CreateContainer(_ context.Context, pod *api.PodSandbox, contain
 		ctrName = container.Name
 		l       = log.WithFields(log.Fields{"container": ctrName, "pod": pod.Name, "namespace": pod.Namespace})
 
-		devices []device
-		err     error
+		inj *injection
+		err error
 	)
 
 	defer l.Info("Finished CreateContainer")
 	l.Info("Started CreateContainer")
-	devices, err = getDevices(ctrName, pod.Annotations)
+	inj, err = p.getContainerInjection(ctx, pod, ctrName)
 	if err != nil {
 		l.WithError(err).Warn("Failed to get device from pod annotation")
+		injectionFailures.WithLabelValues(pod.Namespace, invalidAnnotationFailure).Inc()
 		return nil, nil, err
 	}
 	adjust := &api.ContainerAdjustment{}
+	if inj == nil {
+		inj = &injection{}
+	}
+	if err = p.resolveDevices(inj); err != nil {
+		l.WithError(err).Warn("Failed to resolve annotated devices")
+		injectionFailures.WithLabelValues(pod.Namespace, unresolvedDeviceFailure).Inc()
+		return nil, nil, err
+	}
+	err = inj.validate(&p.getConfig().Allowlist)
+	if err == nil {
+		err = p.admitDevices(ctx, pod, inj.Devices)
+	}
+	if err != nil {
+		l.WithError(err).Warn("Rejected device injection annotation")
+		p.recordWarning(pod, ctrName, injectionDeniedReason, err.Error())
+		injectionFailures.WithLabelValues(pod.Namespace, deniedFailure).Inc()
+		return nil, nil, err
+	}
+	inj.apply(adjust)
+	for _, m := range inj.Mounts {
+		l.WithField("mount", m.HostPath+":"+m.ContainerPath).Info("Injected mount")
+	}
+	for _, e := range inj.Env {
+		l.WithField("env", e.Name).Info("Injected environment variable")
+	}
+	for _, stage := range inj.Hooks.all() {
+		for _, h := range stage {
+			l.WithField("hook", h.Path).Info("Injected hook")
+		}
+	}
+
+	limits, err := getMPSLimits(ctrName, pod.Annotations)
+	if err != nil {
+		l.WithError(err).Warn("Failed to get MPS limits from pod annotation")
+		injectionFailures.WithLabelValues(pod.Namespace, invalidMPSLimitsFailure).Inc()
+		return nil, nil, err
+	}
+	if limits != nil {
+		env, err := mpsEnv(limits, container.Env)
+		if err != nil {
+			l.WithError(err).Warn("Failed to apply MPS limits")
+			injectionFailures.WithLabelValues(pod.Namespace, invalidMPSLimitsFailure).Inc()
+			return nil, nil, err
+		}
+		for key, value := range env {
+			adjust.AddEnv(key, value)
+			l.WithField(key, value).Info("Adjusted MPS limit")
+		}
+	}
 
-	if len(devices) == 0 {
+	if len(inj.Devices) == 0 {
 		l.Debug("No devices annotated...")
+		if !inj.empty() {
+			injections.WithLabelValues(pod.Namespace).Inc()
+		}
 		return adjust, nil, nil
 	}
-	for _, d := range devices {
+	injected := &containerDevices{
+		ID:        container.Id,
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: ctrName,
+	}
+	for _, d := range inj.Devices {
 		l.WithField("device", d.Path).Info("Annotated device")
 		deviceNRI, err := d.toNRIDevice()
 		if err != nil {
 			l.WithField("device", d.Path).WithError(err).Warn("Failed to get device from path")
+			injectionFailures.WithLabelValues(pod.Namespace, deviceNotFoundFailure).Inc()
 			return nil, nil, err
 		}
 		adjust.AddDevice(deviceNRI)
-		l.WithField("device", d.Path).Info("Injected device")
+		rule := cgroupRule(deviceNRI)
+		addCgroupRule(adjust, rule)
+		injected.Devices = append(injected.Devices, d.Path)
+		injected.rules = append(injected.rules, rule)
+		l.WithField("device", d.Path).WithField("access", rule.Access).Info("Injected device")
 	}
+	p.inventory.add(injected)
+	injections.WithLabelValues(pod.Namespace).Inc()
 	return adjust, nil, nil
 }
 
+// UpdateContainer handles UpdateContainer requests relayed to the plugin by containerd NRI.
+// When the updated resources carry cgroup device rules, the rules of the injected devices
+// are added back so that the update does not revoke their access.
+func (p *plugin) UpdateContainer(_ context.Context, pod *api.PodSandbox, container *api.Container, resources *api.LinuxResources) ([]*api.ContainerUpdate, error) {
+	rules := p.inventory.cgroupRules(container.Id)
+	if len(rules) == 0 || resources == nil || len(resources.Devices) == 0 {
+		return nil, nil
+	}
+	l := log.WithFields(log.Fields{"container": container.Name, "pod": pod.GetName(), "namespace": pod.GetNamespace()})
+	missing := missingCgroupRules(resources.Devices, rules)
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	l.WithField("rules", len(missing)).Info("Restored cgroup rules of injected devices")
+	resources.Devices = append(resources.Devices, missing...)
+	return []*api.ContainerUpdate{{
+		ContainerId: container.Id,
+		Linux:       &api.LinuxContainerUpdate{Resources: resources},
+	}}, nil
+}
+
+// StopContainer handles StopContainer requests relayed to the plugin by containerd NRI.
+func (p *plugin) StopContainer(_ context.Context, pod *api.PodSandbox, container *api.Container) ([]*api.ContainerUpdate, error) {
+	if p.inventory.stop(container.Id) {
+		log.WithFields(log.Fields{"container": container.Name, "pod": pod.GetName(), "namespace": pod.GetNamespace()}).Info("Container with injected devices stopped")
+	}
+	return nil, nil
+}
+
+// RemoveContainer handles RemoveContainer events relayed to the plugin by containerd NRI.
+func (p *plugin) RemoveContainer(_ context.Context, pod *api.PodSandbox, container *api.Container) error {
+	if p.inventory.remove(container.Id) {
+		log.WithFields(log.Fields{"container": container.Name, "pod": pod.GetName(), "namespace": pod.GetNamespace()}).Info("Container with injected devices removed")
+	}
+	return nil
+}
+
+// RemovePodSandbox handles RemovePodSandbox events relayed to the plugin by containerd NRI.
+func (p *plugin) RemovePodSandbox(_ context.Context, pod *api.PodSandbox) error {
+	p.initContainers.remove(pod.Id)
+	return nil
+}
+
+// resolveDevices resolves the CDI device references and the symbolic device names of the injection.
+func (p *plugin) resolveDevices(inj *injection) error {
+	if err := p.cdi.resolve(inj); err != nil {
+		return err
+	}
+	devices, err := p.resolver.resolve(inj.Devices)
+	if err != nil {
+		return err
+	}
+	inj.Devices = devices
+	return nil
+}
+
+// getConfig returns the configuration of the plugin, or the default one when not configured.
+func (p *plugin) getConfig() *config {
+	if p.config == nil {
+		return defaultConfig()
+	}
+	return p.config
+}
+
 // getDevices returns parsed devices from pod annotations of device injections.
 func getDevices(ctrName string, podAnnotations map[string]string) ([]device, error) {
-	var (
-		deviceKey string = ctrDeviceKeyPrefix + ctrName
+	inj, err := getInjection(ctrName, podAnnotations)
+	if err != nil || inj == nil {
+		return nil, err
+	}
+	return inj.Devices, nil
+}
 
-		annotation    []byte
-		parsedDevices []device
-		devices       []device
-	)
+// cgroupRule returns the cgroup rule allowing access to the device, with the access the runtime grants to injected devices.
+func cgroupRule(d *api.LinuxDevice) *api.LinuxDeviceCgroup {
+	return &api.LinuxDeviceCgroup{
+		Allow:  true,
+		Type:   d.Type,
+		Major:  api.Int64(d.Major),
+		Minor:  api.Int64(d.Minor),
+		Access: d.AccessString(),
+	}
+}
 
-	if value, ok := podAnnotations[deviceKey]; ok {
-		annotation = []byte(value)
+func addCgroupRule(adjust *api.ContainerAdjustment, rule *api.LinuxDeviceCgroup) {
+	if adjust.Linux == nil {
+		adjust.Linux = &api.LinuxContainerAdjustment{}
 	}
-	if annotation == nil {
-		return nil, nil
+	if adjust.Linux.Resources == nil {
+		adjust.Linux.Resources = &api.LinuxResources{}
 	}
+	adjust.Linux.Resources.Devices = append(adjust.Linux.Resources.Devices, rule)
+}
 
-	if err := yaml.Unmarshal(annotation, &parsedDevices); err != nil {
-		return nil, fmt.Errorf("invalid device annotation %q: %w", deviceKey, err)
-	}
-	paths := make(map[string]bool)
-	for _, d := range parsedDevices {
-		if _, got := paths[d.Path]; got {
-			continue
-		} else {
-			paths[d.Path] = true
-			devices = append(devices, d)
+// missingCgroupRules returns the rules which are not in the cgroup rules of a container.
+func missingCgroupRules(current, rules []*api.LinuxDeviceCgroup) []*api.LinuxDeviceCgroup {
+	var missing []*api.LinuxDeviceCgroup
+	for _, rule := range rules {
+		found := false
+		for _, c := range current {
+			if c.Allow && c.Type == rule.Type && c.Major.GetValue() == rule.Major.GetValue() && c.Minor.GetValue() == rule.Minor.GetValue() && c.Access == rule.Access {
+				found = true
+				break
+			}
 		}
+		if !found {
+			missing = append(missing, rule)
+		}
+	}
+	return missing
+}
+
+// sourcePath returns the path of the device on the host.
+func (d *device) sourcePath() string {
+	if d.hostPath != "" {
+		return d.hostPath
 	}
-	return devices, nil
+	return d.Path
 }
 
 // toNRIDevice retrieves device's major, minor and type from its path, and returns a NRI device
@@ -159,8 +395,8 @@ func (d *device) toNRIDevice() (*api.LinuxDevice, error) {
 	var (
 		stat unix.Stat_t
 	)
-	if err := unix.Lstat(d.Path, &stat); err != nil {
-		return nil, fmt.Errorf("failed to get info from device path %s: %v", d.Path, err)
+	if err := unix.Lstat(d.sourcePath(), &stat); err != nil {
+		return nil, fmt.Errorf("failed to get info from device path %s: %v", d.sourcePath(), err)
 	}
 
 	var (
@@ -178,7 +414,7 @@ func (d *device) toNRIDevice() (*api.LinuxDevice, error) {
 	case unix.S_IFIFO:
 		devType = fifoDevice
 	default:
-		return nil, fmt.Errorf("invalid device type %v from device path %v", mode, d.Path)
+		return nil, fmt.Errorf("invalid device type %v from device path %v", mode, d.sourcePath())
 	}
 	apiDev := &api.LinuxDevice{
 		Path:  d.Path,
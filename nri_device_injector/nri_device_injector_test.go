@@ -155,6 +155,40 @@ func TestGetDevices(t *testing.T) {
 				Path: "/dev/test0",
 			}},
 		},
+		"Devices in an annotation with mounts": {
+			container: "test",
+			annotations: map[string]string{
+				"devices.gke.io/container.test": `
+devices:
+- path: /dev/test0
+- path: /dev/test0
+mounts:
+- host_path: /home/kubernetes/bin/nvidia
+  container_path: /usr/local/nvidia
+`}, want: []device{{
+				Path: "/dev/test0",
+			}},
+		},
+		"Symbolic device names": {
+			container: "test",
+			annotations: map[string]string{
+				"devices.gke.io/container.test": `
+- gpu:index=0
+- gpu:index=0
+- name: gpu:uuid=GPU-0
+  file_mode: 438
+- path: /dev/test0
+`}, want: []device{{
+				Name: "gpu:index=0",
+			}, {
+				Name: "gpu:index=0",
+			}, {
+				Name:     "gpu:uuid=GPU-0",
+				FileMode: 438,
+			}, {
+				Path: "/dev/test0",
+			}},
+		},
 		"Invalid device annotation": {
 			container: "test",
 			annotations: map[string]string{
@@ -0,0 +1,215 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/containerd/nri/pkg/api"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	clientv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	injectionDeniedReason = "DeviceInjectionDenied"
+	eventSource           = "nri-device-injector"
+	defaultServiceAccount = "default"
+)
+
+// deviceRule allows the pods of the namespaces and service accounts to request the devices matching the paths.
+type deviceRule struct {
+	// Namespaces the rule applies to, any namespace when empty.
+	Namespaces []string `json:"namespaces"`
+	// ServiceAccounts the rule applies to, any service account when empty.
+	ServiceAccounts []string `json:"service_accounts"`
+	// DevicePaths are the globs of the allowed device paths, with the syntax of filepath.Match.
+	DevicePaths []string `json:"device_paths"`
+}
+
+func (r *deviceRule) validate() error {
+	if len(r.DevicePaths) == 0 {
+		return fmt.Errorf("device policy rule without device paths")
+	}
+	for _, pattern := range r.DevicePaths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid device path glob %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// allowsPath returns true if the device path matches one of the globs of the rule.
+func (r *deviceRule) allowsPath(path string) bool {
+	for _, pattern := range r.DevicePaths {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// admitDevices checks that the device policy allows the pod to request each device, by its path on the host.
+// The service account of the pod is only looked up when a rule restricts service accounts.
+func (p *plugin) admitDevices(ctx context.Context, pod *api.PodSandbox, devices []device) error {
+	var (
+		serviceAccount string
+		lookupErr      error
+		lookedUp       bool
+	)
+	allows := func(rule deviceRule) bool {
+		if len(rule.Namespaces) > 0 && !slices.Contains(rule.Namespaces, pod.Namespace) {
+			return false
+		}
+		if len(rule.ServiceAccounts) == 0 {
+			return true
+		}
+		if !lookedUp {
+			serviceAccount, lookupErr = p.serviceAccount(ctx, pod)
+			lookedUp = true
+		}
+		return lookupErr == nil && slices.Contains(rule.ServiceAccounts, serviceAccount)
+	}
+
+	for _, d := range devices {
+		path := d.sourcePath()
+		if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+			return fmt.Errorf("invalid device path %q, must be absolute and clean", path)
+		}
+		allowed := false
+		for _, rule := range p.getConfig().DevicePolicy {
+			if rule.allowsPath(path) && allows(rule) {
+				allowed = true
+				break
+			}
+		}
+		if allowed {
+			continue
+		}
+		switch {
+		case lookupErr != nil:
+			return fmt.Errorf("device %s is not allowed for pods of namespace %s, failed to get the service account of the pod: %w", path, pod.Namespace, lookupErr)
+		case lookedUp:
+			return fmt.Errorf("device %s is not allowed for service account %s/%s", path, pod.Namespace, serviceAccount)
+		default:
+			return fmt.Errorf("device %s is not allowed for pods of namespace %s", path, pod.Namespace)
+		}
+	}
+	return nil
+}
+
+// serviceAccount returns the name of the service account of the pod from the API server.
+func (p *plugin) serviceAccount(ctx context.Context, pod *api.PodSandbox) (string, error) {
+	kubePod, err := p.getPod(ctx, pod)
+	if err != nil {
+		return "", err
+	}
+	if kubePod.Spec.ServiceAccountName == "" {
+		return defaultServiceAccount, nil
+	}
+	return kubePod.Spec.ServiceAccountName, nil
+}
+
+// isInitContainer returns true if the container is an init container of the pod, from the API server. The init
+// containers of a pod are only read once. When they cannot be read, the container is not taken for an init container,
+// so that the containers of the pod can still be created.
+func (p *plugin) isInitContainer(ctx context.Context, pod *api.PodSandbox, ctrName string) bool {
+	names, ok := p.initContainers.get(pod.Id)
+	if !ok {
+		kubePod, err := p.getPod(ctx, pod)
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"container": ctrName, "pod": pod.Name, "namespace": pod.Namespace}).
+				Warnf("Failed to get the init containers of the pod, applying %s as to an app container", podDeviceKey)
+			return false
+		}
+		for _, c := range kubePod.Spec.InitContainers {
+			names = append(names, c.Name)
+		}
+		p.initContainers.set(pod.Id, names)
+	}
+	return slices.Contains(names, ctrName)
+}
+
+// initContainerCache holds the init container names of pods by pod sandbox ID.
+type initContainerCache struct {
+	mu    sync.Mutex
+	names map[string][]string
+}
+
+func (c *initContainerCache) get(podID string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names, ok := c.names[podID]
+	return names, ok
+}
+
+func (c *initContainerCache) set(podID string, names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.names == nil {
+		c.names = make(map[string][]string)
+	}
+	c.names[podID] = names
+}
+
+func (c *initContainerCache) remove(podID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.names, podID)
+}
+
+func (p *plugin) getPod(ctx context.Context, pod *api.PodSandbox) (*v1.Pod, error) {
+	if p.kubeClient == nil {
+		return nil, fmt.Errorf("no kube client")
+	}
+	kubePod, err := p.kubeClient.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	if pod.Uid != "" && string(kubePod.UID) != pod.Uid {
+		return nil, fmt.Errorf("pod %s/%s has UID %s, expected %s", pod.Namespace, pod.Name, kubePod.UID, pod.Uid)
+	}
+	return kubePod, nil
+}
+
+func newEventRecorder(kubeClient kubernetes.Interface) record.EventRecorder {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&clientv1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventSource})
+}
+
+// recordWarning reports a warning event about the container on its pod.
+func (p *plugin) recordWarning(pod *api.PodSandbox, ctrName, reason, message string) {
+	if p.recorder == nil {
+		return
+	}
+	ref := &v1.ObjectReference{
+		Kind:      "Pod",
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		UID:       types.UID(pod.Uid),
+		FieldPath: fmt.Sprintf("spec.containers{%s}", ctrName),
+	}
+	p.recorder.Event(ref, v1.EventTypeWarning, reason, message)
+}
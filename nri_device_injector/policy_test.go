@@ -0,0 +1,173 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDeviceRuleAllowsPath(t *testing.T) {
+	rule := &deviceRule{DevicePaths: []string{"/dev/nvidia*", "/dev/nvidia-caps/*", "/dev/accel[0-3]"}}
+	tests := map[string]bool{
+		"/dev/nvidia0":                      true,
+		"/dev/nvidiactl":                    true,
+		"/dev/nvidia-uvm":                   true,
+		"/dev/nvidia-caps/nvidia-cap1":      true,
+		"/dev/accel3":                       true,
+		"/dev/accel4":                       false,
+		"/dev/sda":                          false,
+		"/dev/nvidia-caps/nested/cap":       false,
+		"/home/dev/nvidia0":                 false,
+		"/dev/nvidia-caps/../../etc/shadow": false,
+	}
+	for path, want := range tests {
+		assert.Equalf(t, want, rule.allowsPath(path), "allowsPath(%q)", path)
+	}
+
+	assert.Error(t, (&deviceRule{}).validate())
+	assert.Error(t, (&deviceRule{DevicePaths: []string{"/dev/nvidia["}}).validate())
+	assert.NoError(t, rule.validate())
+}
+
+func TestAdmitDevices(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ml", Name: "trainer", UID: "uid-trainer"},
+			Spec:       v1.PodSpec{ServiceAccountName: "gpu-runner"},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ml", Name: "notebook", UID: "uid-notebook"},
+		},
+	)
+	p := &plugin{
+		config: &config{DevicePolicy: []deviceRule{{
+			DevicePaths: []string{"/dev/nvidia*"},
+		}, {
+			Namespaces:      []string{"ml"},
+			ServiceAccounts: []string{"gpu-runner"},
+			DevicePaths:     []string{"/dev/accel*"},
+		}, {
+			Namespaces:  []string{"storage"},
+			DevicePaths: []string{"/dev/nvme0n1"},
+		}}},
+		kubeClient: kubeClient,
+	}
+
+	tests := map[string]struct {
+		pod        *api.PodSandbox
+		devices    []device
+		kubeClient bool
+		wantErr    string
+	}{
+		"No devices": {
+			pod: &api.PodSandbox{Namespace: "default", Name: "pod"},
+		},
+		"Device allowed for all pods": {
+			pod:     &api.PodSandbox{Namespace: "default", Name: "pod"},
+			devices: []device{{Path: "/dev/nvidia0"}, {Path: "/dev/nvidiactl"}},
+		},
+		"Device not allowed by any rule": {
+			pod:     &api.PodSandbox{Namespace: "default", Name: "pod"},
+			devices: []device{{Path: "/dev/nvidia0"}, {Path: "/dev/sda"}},
+			wantErr: "device /dev/sda is not allowed for pods of namespace default",
+		},
+		"Unclean device path": {
+			pod:     &api.PodSandbox{Namespace: "default", Name: "pod"},
+			devices: []device{{Path: "/dev/nvidia0/../sda"}},
+			wantErr: "invalid device path",
+		},
+		"Device allowed for namespace": {
+			pod:     &api.PodSandbox{Namespace: "storage", Name: "pod"},
+			devices: []device{{Path: "/dev/nvme0n1"}},
+		},
+		"Device allowed for another namespace": {
+			pod:     &api.PodSandbox{Namespace: "default", Name: "pod"},
+			devices: []device{{Path: "/dev/nvme0n1"}},
+			wantErr: "device /dev/nvme0n1 is not allowed for pods of namespace default",
+		},
+		"Device allowed for service account": {
+			pod:     &api.PodSandbox{Namespace: "ml", Name: "trainer", Uid: "uid-trainer"},
+			devices: []device{{Path: "/dev/accel0"}},
+		},
+		"Device allowed for another service account": {
+			pod:     &api.PodSandbox{Namespace: "ml", Name: "notebook", Uid: "uid-notebook"},
+			devices: []device{{Path: "/dev/accel0"}},
+			wantErr: "device /dev/accel0 is not allowed for service account ml/default",
+		},
+		"Recreated pod": {
+			pod:     &api.PodSandbox{Namespace: "ml", Name: "trainer", Uid: "uid-old"},
+			devices: []device{{Path: "/dev/accel0"}},
+			wantErr: "failed to get the service account of the pod",
+		},
+		"Unknown pod": {
+			pod:     &api.PodSandbox{Namespace: "ml", Name: "unknown"},
+			devices: []device{{Path: "/dev/accel0"}},
+			wantErr: "failed to get the service account of the pod",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := p.admitDevices(context.Background(), tc.pod, tc.devices)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.wantErr)
+			}
+		})
+	}
+
+	p.kubeClient = nil
+	err := p.admitDevices(context.Background(), &api.PodSandbox{Namespace: "ml", Name: "trainer"}, []device{{Path: "/dev/accel0"}})
+	assert.Error(t, err)
+}
+
+func TestCreateContainerDeniedDevice(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	p := &plugin{recorder: recorder}
+	pod := &api.PodSandbox{
+		Name:      "pod",
+		Namespace: "default",
+		Annotations: map[string]string{
+			"devices.gke.io/container.test": `
+- path: /dev/nvidia0
+- path: /dev/sda
+`,
+		},
+	}
+
+	adjust, _, err := p.CreateContainer(context.Background(), pod, &api.Container{Name: "test"})
+	assert.Nil(t, adjust)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "device /dev/sda is not allowed")
+	}
+	select {
+	case event := <-recorder.Events:
+		assert.True(t, strings.HasPrefix(event, "Warning DeviceInjectionDenied device /dev/sda is not allowed"), event)
+	default:
+		t.Error("no event recorded for the denied device")
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/nvmlutil"
+)
+
+const (
+	gpuDeviceClass  = "gpu"
+	rdmaDeviceClass = "rdma"
+)
+
+// gpuCompanionDevices are injected along with any GPU resolved from a symbolic name, when present on the node.
+var gpuCompanionDevices = []string{"nvidiactl", "nvidia-uvm", "nvidia-uvm-tools"}
+
+// deviceResolver resolves symbolic device names, such as gpu:index=2, into the device nodes of the node.
+// GPUs are looked up with NVML and the other devices in sysfs.
+type deviceResolver struct {
+	nvmlOps nvmlutil.NvmlOperations
+	// nvmlInit initializes NVML, which is only needed once symbolic GPU names are used.
+	nvmlInit  func() error
+	devDir    string
+	sysfsRoot string
+
+	mu              sync.Mutex
+	nvmlInitialized bool
+}
+
+func newDeviceResolver(nvmlOps nvmlutil.NvmlOperations, nvmlInit func() error) *deviceResolver {
+	return &deviceResolver{
+		nvmlOps:   nvmlOps,
+		nvmlInit:  nvmlInit,
+		devDir:    "/dev",
+		sysfsRoot: "/sys",
+	}
+}
+
+// resolve replaces the devices with symbolic names by the device nodes they name, keeping the
+// other fields of the annotated device. When multiple devices have the same path, only the first
+// one is kept.
+func (r *deviceResolver) resolve(devices []device) ([]device, error) {
+	var (
+		resolved []device
+		paths    = make(map[string]bool)
+	)
+	add := func(d device) {
+		if !paths[d.Path] {
+			paths[d.Path] = true
+			resolved = append(resolved, d)
+		}
+	}
+	for _, d := range devices {
+		if d.Name == "" {
+			add(d)
+			continue
+		}
+		if r == nil {
+			return nil, fmt.Errorf("symbolic device name %q is not supported", d.Name)
+		}
+		devPaths, err := r.resolveName(d.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve device %q: %w", d.Name, err)
+		}
+		for _, path := range devPaths {
+			resolvedDevice := d
+			resolvedDevice.Name = ""
+			resolvedDevice.Path = path
+			add(resolvedDevice)
+		}
+	}
+	return resolved, nil
+}
+
+// resolveName returns the paths of the device nodes named by a symbolic device name.
+func (r *deviceResolver) resolveName(name string) ([]string, error) {
+	class, selector, _ := strings.Cut(name, ":")
+	key, value, _ := strings.Cut(selector, "=")
+	switch {
+	case class == gpuDeviceClass && key == "all" && value == "":
+		return r.gpus(func(int, nvml.Device) (bool, error) { return true, nil })
+	case class == gpuDeviceClass && key == "index":
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid GPU index %q", value)
+		}
+		return r.gpus(func(i int, _ nvml.Device) (bool, error) { return i == index, nil })
+	case class == gpuDeviceClass && key == "uuid" && value != "":
+		return r.gpus(func(_ int, d nvml.Device) (bool, error) {
+			uuid, ret := r.nvmlOps.UUID(d)
+			if ret != nvml.SUCCESS {
+				return false, fmt.Errorf("failed to get GPU UUID: %v", nvml.ErrorString(ret))
+			}
+			return uuid == value, nil
+		})
+	case class == rdmaDeviceClass && key == "all" && value == "":
+		return r.rdmaDevices()
+	default:
+		return nil, fmt.Errorf("unknown symbolic device name, should be one of gpu:all, gpu:index=<index>, gpu:uuid=<uuid> or rdma:all")
+	}
+}
+
+// gpus returns the device nodes of the GPUs selected by match, along with their companion devices.
+func (r *deviceResolver) gpus(match func(index int, d nvml.Device) (bool, error)) ([]string, error) {
+	if err := r.initNVML(); err != nil {
+		return nil, err
+	}
+	count, ret := r.nvmlOps.DeviceCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get GPU count: %v", nvml.ErrorString(ret))
+	}
+	var paths []string
+	for i := 0; i < count; i++ {
+		d, ret := r.nvmlOps.DeviceHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get GPU %d: %v", i, nvml.ErrorString(ret))
+		}
+		matched, err := match(i, d)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+		minor, ret := r.nvmlOps.MinorNumber(d)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get minor number of GPU %d: %v", i, nvml.ErrorString(ret))
+		}
+		paths = append(paths, filepath.Join(r.devDir, fmt.Sprintf("nvidia%d", minor)))
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no matching GPU among %d GPUs", count)
+	}
+	for _, name := range gpuCompanionDevices {
+		if path := filepath.Join(r.devDir, name); fileExists(path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// rdmaDevices returns the InfiniBand verbs device nodes listed in sysfs, along with the RDMA connection manager.
+func (r *deviceResolver) rdmaDevices() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.sysfsRoot, "class", "infiniband_verbs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list RDMA devices: %w", err)
+	}
+	var paths []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "uverbs") {
+			paths = append(paths, filepath.Join(r.devDir, "infiniband", entry.Name()))
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no RDMA devices")
+	}
+	sort.Strings(paths)
+	if path := filepath.Join(r.devDir, "infiniband", "rdma_cm"); fileExists(path) {
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// initNVML initializes NVML on first use, and retries on the next use when it fails,
+// e.g. when the driver is not installed yet.
+func (r *deviceResolver) initNVML() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nvmlInitialized {
+		return nil
+	}
+	if err := r.nvmlInit(); err != nil {
+		return fmt.Errorf("failed to initialize NVML: %w", err)
+	}
+	r.nvmlInitialized = true
+	return nil
+}
+
+// loadNVML loads and initializes the NVML library.
+func loadNVML() error {
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return fmt.Errorf("%v", nvml.ErrorString(ret))
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
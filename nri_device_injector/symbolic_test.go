@@ -0,0 +1,143 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/nvmlutil"
+)
+
+func newTestResolver(t *testing.T, devices ...string) *deviceResolver {
+	t.Helper()
+	devDir := t.TempDir()
+	sysfsRoot := t.TempDir()
+	for _, d := range devices {
+		path := filepath.Join(devDir, d)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", path, err)
+		}
+		if dir, name := filepath.Split(d); dir == "infiniband/" && name != "rdma_cm" {
+			if err := os.MkdirAll(filepath.Join(sysfsRoot, "class", "infiniband_verbs", name), 0755); err != nil {
+				t.Fatalf("failed to create sysfs entry of %s: %v", name, err)
+			}
+		}
+	}
+	r := newDeviceResolver(&nvmlutil.MockDeviceInfo{TestDevDir: devDir}, func() error { return nil })
+	r.devDir = devDir
+	r.sysfsRoot = sysfsRoot
+	return r
+}
+
+func TestResolveDevices(t *testing.T) {
+	r := newTestResolver(t, "nvidia0", "nvidia1", "nvidia2", "nvidiactl", "nvidia-uvm", "infiniband/uverbs1", "infiniband/uverbs0", "infiniband/rdma_cm")
+	dev := func(name string) string { return filepath.Join(r.devDir, name) }
+
+	tests := map[string]struct {
+		devices []device
+		want    []device
+		wantErr bool
+	}{
+		"Device paths": {
+			devices: []device{{Path: "/dev/foo"}},
+			want:    []device{{Path: "/dev/foo"}},
+		},
+		"All GPUs": {
+			devices: []device{{Name: "gpu:all", FileMode: 0666}},
+			want: []device{
+				{Path: dev("nvidia0"), FileMode: 0666},
+				{Path: dev("nvidia1"), FileMode: 0666},
+				{Path: dev("nvidia2"), FileMode: 0666},
+				{Path: dev("nvidiactl"), FileMode: 0666},
+				{Path: dev("nvidia-uvm"), FileMode: 0666},
+			},
+		},
+		"GPUs by index and UUID": {
+			devices: []device{{Name: "gpu:index=2"}, {Name: "gpu:uuid=GPU-0"}, {Path: dev("nvidia2")}},
+			want: []device{
+				{Path: dev("nvidia2")},
+				{Path: dev("nvidiactl")},
+				{Path: dev("nvidia-uvm")},
+				{Path: dev("nvidia0")},
+			},
+		},
+		"GPU index out of range": {
+			devices: []device{{Name: "gpu:index=3"}},
+			wantErr: true,
+		},
+		"Invalid GPU index": {
+			devices: []device{{Name: "gpu:index=first"}},
+			wantErr: true,
+		},
+		"Unknown GPU UUID": {
+			devices: []device{{Name: "gpu:uuid=GPU-unknown"}},
+			wantErr: true,
+		},
+		"All RDMA devices": {
+			devices: []device{{Name: "rdma:all"}},
+			want: []device{
+				{Path: dev("infiniband/uverbs0")},
+				{Path: dev("infiniband/uverbs1")},
+				{Path: dev("infiniband/rdma_cm")},
+			},
+		},
+		"Unknown device class": {
+			devices: []device{{Name: "tpu:all"}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			devices, err := r.resolve(tc.devices)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("resolve() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			assert.Equal(t, tc.want, devices)
+		})
+	}
+}
+
+func TestResolveDevicesWithoutResolver(t *testing.T) {
+	var r *deviceResolver
+	devices, err := r.resolve([]device{{Path: "/dev/nvidia0"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []device{{Path: "/dev/nvidia0"}}, devices)
+
+	_, err = r.resolve([]device{{Name: "gpu:all"}})
+	assert.Error(t, err)
+}
+
+func TestResolveDevicesNVMLInit(t *testing.T) {
+	r := newTestResolver(t, "nvidia0")
+	initErr := errors.New("libnvidia-ml.so.1 not found")
+	r.nvmlInit = func() error { return initErr }
+
+	_, err := r.resolve([]device{{Name: "gpu:all"}})
+	assert.Error(t, err)
+
+	initErr = nil
+	devices, err := r.resolve([]device{{Name: "gpu:all"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []device{{Path: filepath.Join(r.devDir, "nvidia0")}}, devices)
+}
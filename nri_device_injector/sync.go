@@ -0,0 +1,110 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+const missingDevicesReason = "DeviceInjectionMissing"
+
+// missingDevices reports the containers missing annotated devices at the last synchronization.
+var missingDevices = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "device_injector_missing_devices",
+		Help: "Number of annotated devices missing from the container at the last synchronization with the runtime",
+	},
+	[]string{"namespace", "pod", "container"})
+
+// Synchronize handles the synchronization of the plugin with the existing pods and containers, when
+// the plugin connects to the runtime. The devices of each container are compared with its annotations
+// and the containers missing annotated devices, e.g. created while the plugin was not running, are
+// reported. NRI cannot inject devices into existing containers, so no updates are requested. The
+// inventory is rebuilt from the annotated devices found in the containers, also dropping the containers
+// removed while the plugin was reconnecting.
+func (p *plugin) Synchronize(ctx context.Context, pods []*api.PodSandbox, containers []*api.Container) ([]*api.ContainerUpdate, error) {
+	podsByID := make(map[string]*api.PodSandbox)
+	for _, pod := range pods {
+		podsByID[pod.Id] = pod
+	}
+
+	missingDevices.Reset()
+	p.inventory.reset()
+	mismatches := 0
+	for _, ctr := range containers {
+		pod, ok := podsByID[ctr.PodSandboxId]
+		if !ok || ctr.State == api.ContainerState_CONTAINER_STOPPED {
+			continue
+		}
+		l := log.WithFields(log.Fields{"container": ctr.Name, "pod": pod.Name, "namespace": pod.Namespace})
+		missing, injected, err := p.checkDevices(ctx, pod, ctr)
+		if err != nil {
+			l.WithError(err).Warn("Failed to check the devices of container")
+			continue
+		}
+		if len(injected) > 0 {
+			c := &containerDevices{ID: ctr.Id, Namespace: pod.Namespace, Pod: pod.Name, Container: ctr.Name}
+			for _, d := range injected {
+				c.Devices = append(c.Devices, d.Path)
+				c.rules = append(c.rules, cgroupRule(d))
+			}
+			p.inventory.add(c)
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		mismatches++
+		l.WithField("devices", missing).Warn("Container is missing annotated devices")
+		missingDevices.WithLabelValues(pod.Namespace, pod.Name, ctr.Name).Set(float64(len(missing)))
+		p.recordWarning(pod, ctr.Name, missingDevicesReason, fmt.Sprintf("Container is missing annotated devices %s, it was likely created while the device injector was not running and must be restarted", strings.Join(missing, ", ")))
+	}
+	log.Infof("Synchronized %d containers, %d missing annotated devices", len(containers), mismatches)
+	return nil, nil
+}
+
+// checkDevices returns the paths of the devices annotated for the container which it is missing, and
+// the annotated devices it has.
+func (p *plugin) checkDevices(ctx context.Context, pod *api.PodSandbox, ctr *api.Container) ([]string, []*api.LinuxDevice, error) {
+	inj, err := p.getContainerInjection(ctx, pod, ctr.Name)
+	if err != nil || inj == nil {
+		return nil, nil, err
+	}
+	if err := p.resolveDevices(inj); err != nil {
+		return nil, nil, err
+	}
+	present := make(map[string]*api.LinuxDevice)
+	for _, d := range ctr.GetLinux().GetDevices() {
+		present[d.Path] = d
+	}
+	var (
+		missing  []string
+		injected []*api.LinuxDevice
+	)
+	for _, d := range inj.Devices {
+		if dev, ok := present[d.Path]; ok {
+			injected = append(injected, dev)
+		} else {
+			missing = append(missing, d.Path)
+		}
+	}
+	return missing, injected, nil
+}
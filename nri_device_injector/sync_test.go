@@ -0,0 +1,86 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSynchronize(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	p := &plugin{recorder: recorder}
+	annotations := map[string]string{
+		"devices.gke.io/container.injected": `
+- path: /dev/nvidia0
+- path: /dev/nvidiactl
+`,
+		"devices.gke.io/container.missing": `
+- path: /dev/nvidia1
+- path: /dev/nvidiactl
+`,
+		"devices.gke.io/container.stopped": `
+- path: /dev/nvidia2
+`,
+	}
+	pods := []*api.PodSandbox{{Id: "pod1", Namespace: "default", Name: "pod", Annotations: annotations}}
+	nvidia0 := &api.LinuxDevice{Path: "/dev/nvidia0", Type: charDevice, Major: 195, Minor: 0}
+	nvidiactl := &api.LinuxDevice{Path: "/dev/nvidiactl", Type: charDevice, Major: 195, Minor: 255}
+	containers := []*api.Container{{
+		Id: "ctr1", PodSandboxId: "pod1", Name: "injected", State: api.ContainerState_CONTAINER_RUNNING,
+		Linux: &api.LinuxContainer{Devices: []*api.LinuxDevice{nvidia0, nvidiactl}},
+	}, {
+		Id: "ctr2", PodSandboxId: "pod1", Name: "missing", State: api.ContainerState_CONTAINER_RUNNING,
+		Linux: &api.LinuxContainer{Devices: []*api.LinuxDevice{nvidiactl}},
+	}, {
+		Id: "ctr3", PodSandboxId: "pod1", Name: "stopped", State: api.ContainerState_CONTAINER_STOPPED,
+	}, {
+		Id: "ctr4", PodSandboxId: "pod1", Name: "unannotated", State: api.ContainerState_CONTAINER_RUNNING,
+	}, {
+		Id: "ctr5", PodSandboxId: "unknown", Name: "missing", State: api.ContainerState_CONTAINER_RUNNING,
+	}}
+
+	updates, err := p.Synchronize(context.Background(), pods, containers)
+	assert.NoError(t, err)
+	assert.Nil(t, updates)
+
+	status := p.inventory.status()
+	assert.Equal(t, map[string][]string{
+		"/dev/nvidia0":   {"ctr1"},
+		"/dev/nvidiactl": {"ctr1", "ctr2"},
+	}, status.Devices)
+	assert.Equal(t, []*api.LinuxDeviceCgroup{cgroupRule(nvidia0), cgroupRule(nvidiactl)}, p.inventory.cgroupRules("ctr1"))
+
+	assert.Equal(t, 1, testutil.CollectAndCount(missingDevices))
+	assert.Equal(t, 1.0, testutil.ToFloat64(missingDevices.WithLabelValues("default", "pod", "missing")))
+	select {
+	case event := <-recorder.Events:
+		assert.Contains(t, event, "Warning DeviceInjectionMissing Container is missing annotated devices /dev/nvidia1")
+	default:
+		t.Error("no event recorded for the container missing devices")
+	}
+	assert.Empty(t, recorder.Events)
+
+	// Mismatches fixed since the last synchronization are not reported anymore.
+	containers[1].Linux.Devices = append(containers[1].Linux.Devices, &api.LinuxDevice{Path: "/dev/nvidia1", Type: charDevice, Major: 195, Minor: 1})
+	_, err = p.Synchronize(context.Background(), pods, containers)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, testutil.CollectAndCount(missingDevices))
+}
@@ -0,0 +1,272 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// attestationAnnotation is the node annotation with the summary of the attestation evidence.
+	attestationAnnotation = "cloud.google.com/cgpu-attestation"
+	fieldManager          = "nvidia-persistenced-installer"
+	attestationNonceSize  = 32
+
+	// The attestation report of a GPU starts with the SPDM GET_MEASUREMENTS request it answers, signed
+	// along with the response, which carries the nonce after the version, the request code and 2 params.
+	spdmGetMeasurementsCode     = 0xE0
+	spdmMeasurementsNonceOffset = 4
+	spdmMeasurementsRequestSize = 37
+
+	ccModeCheck        = "cc_mode"
+	ccEnvironmentCheck = "cc_environment"
+	attestationCheck   = "attestation_reports"
+)
+
+var (
+	// fetchAttestationReports fetches the attestation report of each GPU for the nonce.
+	fetchAttestationReports = nvmlAttestationReports
+	now                     = time.Now
+)
+
+// gpuAttestationReport is the attestation report of a GPU.
+type gpuAttestationReport struct {
+	Index     int    `json:"index"`
+	UUID      string `json:"uuid"`
+	Report    []byte `json:"report"`
+	CECReport []byte `json:"cecReport,omitempty"`
+}
+
+// checkResult is the result of a check of the confidential GPU.
+type checkResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// attestationEvidence is the evidence that the GPUs run in confidential computing mode, written on the node.
+type attestationEvidence struct {
+	Timestamp     time.Time              `json:"timestamp"`
+	CCMode        string                 `json:"ccMode"`
+	CCEnvironment string                 `json:"ccEnvironment"`
+	Nonce         []byte                 `json:"nonce"`
+	Reports       []gpuAttestationReport `json:"reports"`
+	Checks        []checkResult          `json:"checks"`
+}
+
+// attestationSummary summarizes the attestation evidence in the node annotation.
+type attestationSummary struct {
+	Timestamp      time.Time `json:"timestamp"`
+	CCMode         string    `json:"ccMode"`
+	CCEnvironment  string    `json:"ccEnvironment"`
+	GPUs           int       `json:"gpus"`
+	Passed         bool      `json:"passed"`
+	FailedChecks   []string  `json:"failedChecks,omitempty"`
+	EvidenceSHA256 string    `json:"evidenceSha256"`
+}
+
+// passed returns true if all the checks passed.
+func (e *attestationEvidence) passed() bool {
+	return len(e.failedChecks()) == 0
+}
+
+func (e *attestationEvidence) failedChecks() []string {
+	var failed []string
+	for _, c := range e.Checks {
+		if !c.Passed {
+			failed = append(failed, c.Name)
+		}
+	}
+	return failed
+}
+
+func (e *attestationEvidence) addCheck(name string, err error) {
+	c := checkResult{Name: name, Passed: err == nil}
+	if err != nil {
+		c.Message = err.Error()
+	}
+	e.Checks = append(e.Checks, c)
+}
+
+// collectAttestationEvidence queries the confidential computing mode and environment of the GPUs and fetches
+// their attestation reports for a fresh nonce. The evidence records the result of each check, an expected
+// environment of "" accepting any environment.
+func collectAttestationEvidence(ctx context.Context, expectedEnvironment string) *attestationEvidence {
+	e := &attestationEvidence{Timestamp: now().UTC()}
+
+	mode, err := queryConfCompute(ctx, "-f")
+	e.CCMode = mode
+	if err == nil && !strings.EqualFold(mode, "ON") {
+		err = fmt.Errorf("confidential computing mode is %q, expected ON", mode)
+	}
+	e.addCheck(ccModeCheck, err)
+
+	environment, err := queryConfCompute(ctx, "-e")
+	e.CCEnvironment = environment
+	if err == nil && expectedEnvironment != "" && !strings.EqualFold(environment, expectedEnvironment) {
+		err = fmt.Errorf("confidential computing environment is %q, expected %s", environment, expectedEnvironment)
+	}
+	e.addCheck(ccEnvironmentCheck, err)
+
+	e.Nonce = make([]byte, attestationNonceSize)
+	if _, err = rand.Read(e.Nonce); err == nil {
+		e.Reports, err = fetchAttestationReports(e.Nonce)
+	}
+	if err == nil {
+		err = verifyAttestationReports(e.Nonce, e.Reports)
+	}
+	e.addCheck(attestationCheck, err)
+	return e
+}
+
+// queryConfCompute returns the value reported by nvidia-smi conf-compute for the flag, e.g. ON for
+// "CC status: ON".
+func queryConfCompute(ctx context.Context, flag string) (string, error) {
+	output, err := runner.Output(ctx, *containerPathPrefix+"/bin/nvidia-smi", "conf-compute", flag)
+	if err != nil {
+		return "", fmt.Errorf("nvidia-smi conf-compute %s failed: %w, output: %s", flag, err, output)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if _, value, found := strings.Cut(line, ":"); found {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("unexpected output of nvidia-smi conf-compute %s: %q", flag, output)
+}
+
+// verifyAttestationReports checks that each GPU returned a report whose SPDM request carries the nonce. The
+// signature of the reports is not verified here, it is left to verifiers of the evidence.
+func verifyAttestationReports(nonce []byte, reports []gpuAttestationReport) error {
+	if len(reports) == 0 {
+		return fmt.Errorf("no GPU attestation reports")
+	}
+	for _, r := range reports {
+		if len(r.Report) == 0 {
+			return fmt.Errorf("empty attestation report for GPU %d (%s)", r.Index, r.UUID)
+		}
+		reportNonce, err := spdmRequestNonce(r.Report)
+		if err != nil {
+			return fmt.Errorf("invalid attestation report for GPU %d (%s): %w", r.Index, r.UUID, err)
+		}
+		if !bytes.Equal(reportNonce, nonce) {
+			return fmt.Errorf("attestation report of GPU %d (%s) is not for the requested nonce", r.Index, r.UUID)
+		}
+	}
+	return nil
+}
+
+// spdmRequestNonce returns the nonce of the SPDM GET_MEASUREMENTS request at the start of an attestation report.
+func spdmRequestNonce(report []byte) ([]byte, error) {
+	if len(report) < spdmMeasurementsRequestSize {
+		return nil, fmt.Errorf("report of %d bytes is shorter than an SPDM GET_MEASUREMENTS request", len(report))
+	}
+	if report[1] != spdmGetMeasurementsCode {
+		return nil, fmt.Errorf("unexpected SPDM request code 0x%X, expected GET_MEASUREMENTS", report[1])
+	}
+	return report[spdmMeasurementsNonceOffset : spdmMeasurementsNonceOffset+attestationNonceSize], nil
+}
+
+// writeAttestationEvidence writes the evidence as JSON to the file, atomically, and returns its SHA-256.
+func writeAttestationEvidence(path string, e *attestationEvidence) (string, error) {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal attestation evidence: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory of attestation evidence: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write attestation evidence: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to write attestation evidence: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// attestGPUs collects the attestation evidence of the GPUs, writes it to the evidence file and publishes its
+// summary on the node, when a kube client is available. It returns an error if any check failed, or if the
+// evidence could not be written.
+func attestGPUs(ctx context.Context, kubeClient kubernetes.Interface, nodeName string) error {
+	e := collectAttestationEvidence(ctx, *expectedCCEnvironment)
+	for _, c := range e.Checks {
+		if c.Passed {
+			glog.InfoContextf(ctx, "Confidential GPU check %s passed", c.Name)
+		} else {
+			glog.ErrorContextf(ctx, "Confidential GPU check %s failed: %s", c.Name, c.Message)
+		}
+	}
+	evidenceSHA256, err := writeAttestationEvidence(*attestationEvidenceFile, e)
+	if err != nil {
+		return err
+	}
+	glog.InfoContextf(ctx, "Wrote attestation evidence of %d GPUs to %s", len(e.Reports), *attestationEvidenceFile)
+	if kubeClient != nil {
+		if err := publishAttestationSummary(ctx, kubeClient, nodeName, e, evidenceSHA256); err != nil {
+			glog.ErrorContextf(ctx, "Failed to publish attestation summary: %v", err)
+		}
+	}
+	if !e.passed() {
+		return fmt.Errorf("failed checks: %s", strings.Join(e.failedChecks(), ", "))
+	}
+	return nil
+}
+
+// publishAttestationSummary annotates the node with the summary of the evidence.
+func publishAttestationSummary(ctx context.Context, kubeClient kubernetes.Interface, nodeName string, e *attestationEvidence, evidenceSHA256 string) error {
+	if nodeName == "" {
+		return fmt.Errorf("node name is empty")
+	}
+	summary, err := json.Marshal(attestationSummary{
+		Timestamp:      e.Timestamp,
+		CCMode:         e.CCMode,
+		CCEnvironment:  e.CCEnvironment,
+		GPUs:           len(e.Reports),
+		Passed:         e.passed(),
+		FailedChecks:   e.failedChecks(),
+		EvidenceSHA256: evidenceSHA256,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal attestation summary: %w", err)
+	}
+
+	glog.InfoContextf(ctx, "Applying node %s annotation %s: %s", nodeName, attestationAnnotation, summary)
+	_, err = kubeClient.CoreV1().Nodes().Apply(
+		ctx,
+		corev1apply.Node(nodeName).WithAnnotations(map[string]string{attestationAnnotation: string(summary)}),
+		metav1.ApplyOptions{FieldManager: fieldManager, Force: true},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to apply node %s annotation: %w", nodeName, err)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeOutput struct {
+	output string
+	err    error
+}
+
+// fakeRunner returns the outputs of the commands by their arguments, and fails unknown commands. Started
+// processes are sent to started, and run until killed or exited by the test.
+type fakeRunner struct {
+	outputs map[string]fakeOutput
+	started chan *fakeProcess
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *fakeRunner) Output(_ context.Context, name string, args ...string) (string, error) {
+	call := strings.Join(args, " ")
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+	o, ok := r.outputs[call]
+	if !ok {
+		return "", fmt.Errorf("unexpected command %s %s", name, call)
+	}
+	return o.output, o.err
+}
+
+func (r *fakeRunner) Start(ctx context.Context, name string, args ...string) (process, error) {
+	if r.started == nil {
+		return nil, fmt.Errorf("unexpected command %s %s", name, strings.Join(args, " "))
+	}
+	p := &fakeProcess{name: name, args: args, done: make(chan struct{})}
+	go func() {
+		<-ctx.Done()
+		p.exitWith(fmt.Errorf("signal: killed"))
+	}()
+	r.started <- p
+	return p, nil
+}
+
+func (r *fakeRunner) getCalls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+type fakeProcess struct {
+	name string
+	args []string
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func (p *fakeProcess) Wait() error {
+	<-p.done
+	return p.err
+}
+
+func (p *fakeProcess) exitWith(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.done)
+	})
+}
+
+func confComputeRunner(mode, environment string) *fakeRunner {
+	return &fakeRunner{outputs: map[string]fakeOutput{
+		"conf-compute -f":     {output: "CC status: " + mode + "\n"},
+		"conf-compute -e":     {output: "CC Environment: " + environment + "\n"},
+		"conf-compute -srs 1": {output: "Confidential Compute GPUs Ready state: ready\n"},
+	}}
+}
+
+// spdmReport returns an attestation report starting with the SPDM GET_MEASUREMENTS request for the nonce.
+func spdmReport(nonce []byte) []byte {
+	report := []byte{0x11, spdmGetMeasurementsCode, 0x01, 0xFF}
+	report = append(report, nonce...)
+	return append(report, 0x00, 0x11, 0x60)
+}
+
+func echoReports(gpus int) func(nonce []byte) ([]gpuAttestationReport, error) {
+	return func(nonce []byte) ([]gpuAttestationReport, error) {
+		var reports []gpuAttestationReport
+		for i := 0; i < gpus; i++ {
+			reports = append(reports, gpuAttestationReport{Index: i, UUID: fmt.Sprintf("GPU-%d", i), Report: spdmReport(nonce)})
+		}
+		return reports, nil
+	}
+}
+
+func TestCollectAttestationEvidence(t *testing.T) {
+	testcases := []struct {
+		name                string
+		runner              *fakeRunner
+		fetchReports        func(nonce []byte) ([]gpuAttestationReport, error)
+		expectedEnvironment string
+		wantFailedChecks    []string
+	}{
+		{
+			name:                "all checks passed",
+			runner:              confComputeRunner("ON", "PRODUCTION"),
+			fetchReports:        echoReports(2),
+			expectedEnvironment: "PRODUCTION",
+		},
+		{
+			name:                "cc mode off",
+			runner:              confComputeRunner("OFF", "PRODUCTION"),
+			fetchReports:        echoReports(2),
+			expectedEnvironment: "PRODUCTION",
+			wantFailedChecks:    []string{ccModeCheck},
+		},
+		{
+			name:                "unexpected environment",
+			runner:              confComputeRunner("ON", "INTERNAL"),
+			fetchReports:        echoReports(2),
+			expectedEnvironment: "PRODUCTION",
+			wantFailedChecks:    []string{ccEnvironmentCheck},
+		},
+		{
+			name:         "any environment",
+			runner:       confComputeRunner("ON", "INTERNAL"),
+			fetchReports: echoReports(2),
+		},
+		{
+			name:         "nvidia-smi failed",
+			runner:       &fakeRunner{},
+			fetchReports: echoReports(2),
+			wantFailedChecks: []string{
+				ccModeCheck,
+				ccEnvironmentCheck,
+			},
+		},
+		{
+			name:   "failed to fetch reports",
+			runner: confComputeRunner("ON", "PRODUCTION"),
+			fetchReports: func([]byte) ([]gpuAttestationReport, error) {
+				return nil, fmt.Errorf("NVML not found")
+			},
+			wantFailedChecks: []string{attestationCheck},
+		},
+		{
+			name:             "no GPUs",
+			runner:           confComputeRunner("ON", "PRODUCTION"),
+			fetchReports:     echoReports(0),
+			wantFailedChecks: []string{attestationCheck},
+		},
+		{
+			name:   "report for another nonce",
+			runner: confComputeRunner("ON", "PRODUCTION"),
+			fetchReports: func([]byte) ([]gpuAttestationReport, error) {
+				return echoReports(1)(make([]byte, attestationNonceSize))
+			},
+			wantFailedChecks: []string{attestationCheck},
+		},
+		{
+			name:   "empty report",
+			runner: confComputeRunner("ON", "PRODUCTION"),
+			fetchReports: func([]byte) ([]gpuAttestationReport, error) {
+				return []gpuAttestationReport{{UUID: "GPU-0"}}, nil
+			},
+			wantFailedChecks: []string{attestationCheck},
+		},
+		{
+			name:   "report without SPDM request",
+			runner: confComputeRunner("ON", "PRODUCTION"),
+			fetchReports: func(nonce []byte) ([]gpuAttestationReport, error) {
+				report := spdmReport(nonce)
+				report[1] = 0x60
+				return []gpuAttestationReport{{UUID: "GPU-0", Report: report}}, nil
+			},
+			wantFailedChecks: []string{attestationCheck},
+		},
+		{
+			name:   "truncated report",
+			runner: confComputeRunner("ON", "PRODUCTION"),
+			fetchReports: func(nonce []byte) ([]gpuAttestationReport, error) {
+				return []gpuAttestationReport{{UUID: "GPU-0", Report: spdmReport(nonce)[:20]}}, nil
+			},
+			wantFailedChecks: []string{attestationCheck},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			runner = tc.runner
+			fetchAttestationReports = tc.fetchReports
+
+			e := collectAttestationEvidence(context.Background(), tc.expectedEnvironment)
+
+			if got := e.failedChecks(); !reflect.DeepEqual(got, tc.wantFailedChecks) {
+				t.Errorf("collectAttestationEvidence failed checks: want %v, got %v (checks %+v)", tc.wantFailedChecks, got, e.Checks)
+			}
+			if len(e.Checks) != 3 {
+				t.Errorf("collectAttestationEvidence returned %d checks, want 3", len(e.Checks))
+			}
+			if len(e.Nonce) != attestationNonceSize {
+				t.Errorf("collectAttestationEvidence returned nonce of size %d, want %d", len(e.Nonce), attestationNonceSize)
+			}
+		})
+	}
+}
+
+func TestAttestGPUs(t *testing.T) {
+	const nodeName = "test-node"
+	*attestationEvidenceFile = filepath.Join(t.TempDir(), "attestation", "evidence.json")
+	*expectedCCEnvironment = "PRODUCTION"
+	fetchAttestationReports = echoReports(2)
+	kubeClient := fake.NewSimpleClientset()
+	if _, err := kubeClient.CoreV1().Nodes().Create(context.Background(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+
+	for _, mode := range []string{"ON", "OFF"} {
+		runner = confComputeRunner(mode, "PRODUCTION")
+		wantPassed := mode == "ON"
+
+		err := attestGPUs(context.Background(), kubeClient, nodeName)
+		if (err == nil) != wantPassed {
+			t.Errorf("attestGPUs with cc mode %s returned error %v", mode, err)
+		}
+
+		data, err := os.ReadFile(*attestationEvidenceFile)
+		if err != nil {
+			t.Fatalf("failed to read attestation evidence: %v", err)
+		}
+		var evidence attestationEvidence
+		if err := json.Unmarshal(data, &evidence); err != nil {
+			t.Fatalf("invalid attestation evidence: %v", err)
+		}
+		if evidence.CCMode != mode || len(evidence.Reports) != 2 {
+			t.Errorf("unexpected attestation evidence with cc mode %s: %s", mode, data)
+		}
+
+		node, err := kubeClient.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get node: %v", err)
+		}
+		var summary attestationSummary
+		if err := json.Unmarshal([]byte(node.Annotations[attestationAnnotation]), &summary); err != nil {
+			t.Fatalf("invalid attestation annotation %q: %v", node.Annotations[attestationAnnotation], err)
+		}
+		sum := sha256.Sum256(data)
+		if summary.Passed != wantPassed || summary.GPUs != 2 || summary.EvidenceSHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("unexpected attestation summary with cc mode %s: %+v", mode, summary)
+		}
+	}
+
+	// The ready state is not set by the checks.
+	for _, call := range runner.(*fakeRunner).getCalls() {
+		if strings.Contains(call, "-srs") {
+			t.Errorf("attestGPUs set the ready state")
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/util"
+	"github.com/golang/glog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// persistencedCondition is the node condition reporting whether persistenced runs and the GPUs are set up.
+	persistencedCondition = "NvidiaPersistencedReady"
+
+	runningReason     = "PersistencedRunning"
+	exitedReason      = "PersistencedExited"
+	setupFailedReason = "SetupFailed"
+	stoppedReason     = "Stopped"
+
+	initialRestartBackoff = time.Second
+	maxRestartBackoff     = 5 * time.Minute
+	// stableDuration is how long persistenced must run for the restart backoff to be reset.
+	stableDuration = 10 * time.Minute
+)
+
+// setupError is a failure to set up the GPUs, which stops the supervision.
+type setupError struct {
+	step string
+	err  error
+}
+
+func (e *setupError) Error() string {
+	return fmt.Sprintf("%s: %v", e.step, e.err)
+}
+
+func (e *setupError) Unwrap() error {
+	return e.err
+}
+
+var buildKubeClient = func() (kubernetes.Interface, error) {
+	return util.BuildKubeClient()
+}
+
+// installer sets up the GPUs of confidential nodes and supervises the NVIDIA persistence daemon.
+type installer struct {
+	kubeClient    kubernetes.Interface
+	nodeName      string
+	readinessFile string
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	stableDuration time.Duration
+	readyDelay     time.Duration
+
+	// ready is the last status reported.
+	ready *bool
+}
+
+func newInstaller(nodeName, readinessFile string, readyDelay time.Duration) *installer {
+	return &installer{
+		nodeName:       nodeName,
+		readinessFile:  readinessFile,
+		initialBackoff: initialRestartBackoff,
+		maxBackoff:     maxRestartBackoff,
+		stableDuration: stableDuration,
+		readyDelay:     readyDelay,
+	}
+}
+
+// run runs the NVIDIA persistence daemon on confidential nodes until the context is done, and sets up their GPUs.
+// It returns an error if the GPUs cannot be set up.
+func (i *installer) run(ctx context.Context) error {
+	nodeType, err := readConfidentialNodeType(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read confidential node type: %w", err)
+	}
+	if nodeType == nonConfidentialNode {
+		glog.InfoContext(ctx, "Confidential GPU is NOT enabled, skipping nvidia persistenced enablement.")
+		// Don't exit as this is intended for a side car which would cause it to restart infinitely.
+		<-ctx.Done()
+		return nil
+	}
+	glog.InfoContextf(ctx, "Confidential node type is %s", nodeType)
+
+	if i.kubeClient, err = buildKubeClient(); err != nil {
+		glog.WarningContextf(ctx, "Failed to build kube client, skipping node condition and attestation summary: %v", err)
+	}
+	// This is necessary to be able to use nvidia smi from the container to set the GPU to a ready state.
+	if err := updateContainerLdCache(ctx); err != nil {
+		return err
+	}
+	args, err := persistencedArgs(ctx)
+	if err != nil {
+		return err
+	}
+	return i.supervise(ctx, nodeType, args)
+}
+
+// supervise runs the NVIDIA persistence daemon in the foreground, and sets up the GPUs once it is running.
+// The daemon is restarted with an exponential backoff when it exits, and the GPUs set up again. The status
+// is reported through the readiness file and the node condition.
+func (i *installer) supervise(ctx context.Context, nodeType confidentialNodeType, args []string) error {
+	backoff := i.initialBackoff
+	for {
+		started := time.Now()
+		err := i.runPersistenced(ctx, nodeType, args)
+		if ctx.Err() != nil {
+			i.reportStatus(ctx, false, stoppedReason, "The installer is stopped")
+			return nil
+		}
+		var setupErr *setupError
+		if errors.As(err, &setupErr) {
+			i.reportStatus(ctx, false, setupFailedReason, err.Error())
+			return err
+		}
+		if time.Since(started) >= i.stableDuration {
+			backoff = i.initialBackoff
+		}
+		message := fmt.Sprintf("nvidia-persistenced exited: %v, restarting in %v", err, backoff)
+		glog.ErrorContext(ctx, message)
+		i.reportStatus(ctx, false, exitedReason, message)
+		select {
+		case <-ctx.Done():
+			i.reportStatus(ctx, false, stoppedReason, "The installer is stopped")
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, i.maxBackoff)
+	}
+}
+
+// runPersistenced runs the NVIDIA persistence daemon and sets up the GPUs once it is running. It returns
+// why the daemon exited, or a setupError if the GPUs could not be set up, the daemon being killed.
+func (i *installer) runPersistenced(ctx context.Context, nodeType confidentialNodeType, args []string) error {
+	glog.InfoContext(ctx, "Starting NVIDIA persistence daemon.")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p, err := runner.Start(ctx, *containerPathPrefix+"/bin/nvidia-persistenced", args...)
+	if err != nil {
+		return err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- p.Wait()
+	}()
+
+	// Add small delay before setting the ready state for consistency.
+	// If the workload starts too close to when the persistence daemon has started sometimes there can be errors.
+	select {
+	case err := <-exited:
+		return err
+	case <-ctx.Done():
+		return <-exited
+	case <-time.After(i.readyDelay):
+	}
+	glog.InfoContext(ctx, "NVIDIA Persistence Mode Enabled.")
+
+	for _, step := range nodeType.setupSteps() {
+		if err := step.run(ctx, i); err != nil {
+			cancel()
+			<-exited
+			return &setupError{step: step.name, err: err}
+		}
+	}
+	i.reportStatus(ctx, true, runningReason, fmt.Sprintf("nvidia-persistenced is running and the GPUs of the %s node are set up", nodeType))
+	return <-exited
+}
+
+// reportStatus reports whether persistenced runs and the GPUs are set up through the readiness file, which
+// exists only while ready, and the node condition.
+func (i *installer) reportStatus(ctx context.Context, ready bool, reason, message string) {
+	if ready {
+		err := os.MkdirAll(filepath.Dir(i.readinessFile), 0755)
+		if err == nil {
+			err = os.WriteFile(i.readinessFile, []byte(message+"\n"), 0644)
+		}
+		if err != nil {
+			glog.ErrorContextf(ctx, "Failed to write readiness file: %v", err)
+		}
+	} else if err := os.Remove(i.readinessFile); err != nil && !os.IsNotExist(err) {
+		glog.ErrorContextf(ctx, "Failed to remove readiness file: %v", err)
+	}
+
+	transitioned := i.ready == nil || *i.ready != ready
+	i.ready = &ready
+	if i.kubeClient == nil || i.nodeName == "" {
+		return
+	}
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	condition := v1.NodeCondition{
+		Type:              persistencedCondition,
+		Status:            status,
+		LastHeartbeatTime: metav1.Now(),
+		Reason:            reason,
+		Message:           message,
+	}
+	if transitioned {
+		condition.LastTransitionTime = condition.LastHeartbeatTime
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{"conditions": []v1.NodeCondition{condition}},
+	})
+	if err == nil {
+		// The background context lets the stopped status be reported on shutdown.
+		_, err = i.kubeClient.CoreV1().Nodes().PatchStatus(context.Background(), i.nodeName, patch)
+	}
+	if err != nil {
+		glog.ErrorContextf(ctx, "Failed to update node %s condition %s: %v", i.nodeName, persistencedCondition, err)
+	}
+}
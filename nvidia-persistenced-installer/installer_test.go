@@ -0,0 +1,307 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNodeName = "test-node"
+
+// setupFakeNode fakes a node of the confidential node type, with a R550 driver, and returns its kube client.
+func setupFakeNode(t *testing.T, nodeType string) *fake.Clientset {
+	t.Helper()
+	readFile = func(name string) ([]byte, error) {
+		switch name {
+		case *cgpuConfigFile:
+			if nodeType == "" {
+				return nil, os.ErrNotExist
+			}
+			return []byte(nodeType), nil
+		case "/proc/driver/nvidia/version":
+			return []byte("NVRM version: NVIDIA UNIX x86_64 Kernel Module  550.90.07  Fri May 31 09:35:42 UTC 2024"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	statFile = func(name string) (os.FileInfo, error) {
+		if name == "/dev/tdx_guest" && nodeType == "tdx" || name == "/dev/sev-guest" && nodeType == "sev_snp" {
+			return nil, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	reboot = func() error {
+		t.Errorf("unexpected node reboot")
+		return nil
+	}
+	dir := t.TempDir()
+	ldConfigFile = filepath.Join(dir, "nvidia.conf")
+	*attestationEvidenceFile = filepath.Join(dir, "evidence.json")
+	*expectedCCEnvironment = "PRODUCTION"
+
+	kubeClient := fake.NewSimpleClientset(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: testNodeName}})
+	buildKubeClient = func() (kubernetes.Interface, error) {
+		return kubeClient, nil
+	}
+	return kubeClient
+}
+
+func newTestInstaller(t *testing.T) *installer {
+	i := newInstaller(testNodeName, filepath.Join(t.TempDir(), "ready"), 0)
+	i.initialBackoff, i.maxBackoff = 0, 0
+	return i
+}
+
+func newSupervisedRunner(mode string) *fakeRunner {
+	r := confComputeRunner(mode, "PRODUCTION")
+	r.outputs[""] = fakeOutput{} // ldconfig
+	r.started = make(chan *fakeProcess, 10)
+	return r
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if condition() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// conditionReasons returns the reasons of the node conditions reported, in order.
+func conditionReasons(kubeClient *fake.Clientset) []string {
+	var reasons []string
+	for _, action := range kubeClient.Actions() {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetSubresource() != "status" {
+			continue
+		}
+		if _, reason, found := strings.Cut(string(patch.GetPatch()), `"reason":"`); found {
+			reason, _, _ = strings.Cut(reason, `"`)
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+func TestInstallerSupervisesPersistenced(t *testing.T) {
+	kubeClient := setupFakeNode(t, "tdx")
+	r := newSupervisedRunner("ON")
+	runner = r
+	attestations := 0
+	fetchAttestationReports = func(nonce []byte) ([]gpuAttestationReport, error) {
+		attestations++
+		return echoReports(1)(nonce)
+	}
+	i := newTestInstaller(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errC := make(chan error, 1)
+	go func() {
+		errC <- i.run(ctx)
+	}()
+
+	p := <-r.started
+	wantArgs := []string{"--foreground", "--uvm-persistence-mode", "--nvidia-cfg-path=/usr/local/nvidia/lib64"}
+	if p.name != "/usr/local/nvidia/bin/nvidia-persistenced" || !reflect.DeepEqual(p.args, wantArgs) {
+		t.Errorf("unexpected persistenced command %s %v, want args %v", p.name, p.args, wantArgs)
+	}
+	waitFor(t, "readiness file", func() bool { return fileExists(i.readinessFile) })
+
+	// persistenced is restarted when it exits, and the GPUs set up again.
+	p.exitWith(fmt.Errorf("exit status 1"))
+	p = <-r.started
+	waitFor(t, "GPUs set up again", func() bool { return len(conditionReasons(kubeClient)) == 3 })
+	if !fileExists(i.readinessFile) {
+		t.Errorf("readiness file does not exist after restart")
+	}
+	if attestations != 2 {
+		t.Errorf("GPUs attested %d times, want 2", attestations)
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Errorf("run returned unexpected error %v", err)
+	}
+	if fileExists(i.readinessFile) {
+		t.Errorf("readiness file exists after shutdown")
+	}
+	wantReasons := []string{runningReason, exitedReason, runningReason, stoppedReason}
+	if got := conditionReasons(kubeClient); !reflect.DeepEqual(got, wantReasons) {
+		t.Errorf("unexpected node condition reasons: want %v, got %v", wantReasons, got)
+	}
+	node, err := kubeClient.CoreV1().Nodes().Get(context.Background(), testNodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	if len(node.Status.Conditions) != 1 || node.Status.Conditions[0].Type != persistencedCondition || node.Status.Conditions[0].Status != v1.ConditionFalse {
+		t.Errorf("unexpected node conditions %+v", node.Status.Conditions)
+	}
+	data, err := os.ReadFile(ldConfigFile)
+	if err != nil || string(data) != "/usr/local/nvidia/lib64" {
+		t.Errorf("unexpected ld config %q, error %v", data, err)
+	}
+}
+
+func TestInstallerSetupSteps(t *testing.T) {
+	testcases := []struct {
+		name            string
+		nodeType        string
+		ccMode          string
+		wantErr         string
+		noGuestDevice   bool
+		wantAttestation bool
+		wantReadyState  bool
+	}{
+		{
+			name:            "tdx",
+			nodeType:        "tdx",
+			ccMode:          "ON",
+			wantAttestation: true,
+			wantReadyState:  true,
+		},
+		{
+			name:            "sev_snp",
+			nodeType:        "sev_snp",
+			ccMode:          "ON",
+			wantAttestation: true,
+			wantReadyState:  true,
+		},
+		{
+			name:            "sev",
+			nodeType:        "sev",
+			ccMode:          "ON",
+			wantAttestation: true,
+			wantReadyState:  true,
+		},
+		{
+			name:            "sev failed attestation",
+			nodeType:        "sev",
+			ccMode:          "OFF",
+			wantErr:         "attest: failed checks: cc_mode",
+			wantAttestation: true,
+		},
+		{
+			name:            "failed attestation",
+			nodeType:        "tdx",
+			ccMode:          "OFF",
+			wantErr:         "attest: failed checks: cc_mode",
+			wantAttestation: true,
+		},
+		{
+			name:          "tdx without guest device",
+			nodeType:      "tdx",
+			ccMode:        "ON",
+			noGuestDevice: true,
+			wantErr:       "platform: node is not a TDX guest",
+		},
+		{
+			name:          "sev_snp without guest device",
+			nodeType:      "sev_snp",
+			ccMode:        "ON",
+			noGuestDevice: true,
+			wantErr:       "platform: node is not a SEV-SNP guest",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			kubeClient := setupFakeNode(t, tc.nodeType)
+			if tc.noGuestDevice {
+				statFile = func(string) (os.FileInfo, error) { return nil, os.ErrNotExist }
+			}
+			r := newSupervisedRunner(tc.ccMode)
+			runner = r
+			attested := false
+			fetchAttestationReports = func(nonce []byte) ([]gpuAttestationReport, error) {
+				attested = true
+				return echoReports(1)(nonce)
+			}
+			i := newTestInstaller(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errC := make(chan error, 1)
+			go func() {
+				errC <- i.run(ctx)
+			}()
+
+			p := <-r.started
+			if tc.wantErr == "" {
+				waitFor(t, "readiness file", func() bool { return fileExists(i.readinessFile) })
+				cancel()
+			}
+			err := <-errC
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("run returned unexpected error %v", err)
+			}
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("run returned error %v, want %q", err, tc.wantErr)
+				}
+				// persistenced is killed when the GPUs cannot be set up.
+				if err := p.Wait(); err == nil {
+					t.Errorf("persistenced was not killed")
+				}
+				if got := conditionReasons(kubeClient); !reflect.DeepEqual(got, []string{setupFailedReason}) {
+					t.Errorf("unexpected node condition reasons %v", got)
+				}
+			}
+			if attested != tc.wantAttestation {
+				t.Errorf("GPUs attested %v, want %v", attested, tc.wantAttestation)
+			}
+			readyState := false
+			for _, call := range r.getCalls() {
+				readyState = readyState || call == "conf-compute -srs 1"
+			}
+			if readyState != tc.wantReadyState {
+				t.Errorf("GPU ready state set %v, want %v", readyState, tc.wantReadyState)
+			}
+		})
+	}
+}
+
+func TestInstallerNonConfidentialNode(t *testing.T) {
+	setupFakeNode(t, "")
+	r := &fakeRunner{}
+	runner = r
+	i := newTestInstaller(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := i.run(ctx); err != nil {
+		t.Errorf("run returned unexpected error %v", err)
+	}
+	if calls := r.getCalls(); len(calls) != 0 {
+		t.Errorf("unexpected commands %v on non confidential node", calls)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// confidentialNodeType is the confidential computing technology of the node.
+type confidentialNodeType int
+
+const (
+	nonConfidentialNode confidentialNodeType = iota
+	tdxNode
+	sevNode
+	sevSNPNode
+)
+
+func (t confidentialNodeType) String() string {
+	switch t {
+	case tdxNode:
+		return "TDX"
+	case sevNode:
+		return "SEV"
+	case sevSNPNode:
+		return "SEV-SNP"
+	default:
+		return "none"
+	}
+}
+
+// parseConfidentialNodeType parses the confidential node type of the config file, e.g. tdx or sev_snp.
+// Unknown types are not confidential.
+func parseConfidentialNodeType(s string) confidentialNodeType {
+	// Remove any trailing spaces and null strings to avoid issues in comparison.
+	switch strings.ToLower(strings.Trim(s, " \r\n\x00")) {
+	case "tdx":
+		return tdxNode
+	case "sev":
+		return sevNode
+	case "sev_snp", "sev-snp":
+		return sevSNPNode
+	default:
+		return nonConfidentialNode
+	}
+}
+
+// setupStep sets up the GPUs once the NVIDIA persistence daemon is running.
+type setupStep struct {
+	name string
+	run  func(ctx context.Context, i *installer) error
+}
+
+var (
+	attestStep = setupStep{
+		name: "attest",
+		run: func(ctx context.Context, i *installer) error {
+			// Only set the ready state once the GPUs are verified to run in confidential computing mode.
+			return attestGPUs(ctx, i.kubeClient, i.nodeName)
+		},
+	}
+	readyStateStep = setupStep{
+		name: "ready-state",
+		run: func(ctx context.Context, _ *installer) error {
+			// Mark GPU with ready state. If encounter no devices were found issue, reboot the node.
+			output, err := setGPUReadyState(ctx)
+			if err == nil {
+				return nil
+			}
+			if strings.Contains(output, "No devices were found") {
+				glog.InfoContext(ctx, "No devices were found, rebooting node to resolve")
+				if err := reboot(); err != nil {
+					glog.ErrorContextf(ctx, "Failed to trigger node reboot: %v", err)
+				}
+			}
+			return fmt.Errorf("failed to set gpu to ready state: %w, output: %s", err, output)
+		},
+	}
+)
+
+// guestDeviceStep checks that the node runs as a guest of the confidential computing technology, through the
+// device of its guest driver, before the GPUs are trusted in confidential computing mode.
+func guestDeviceStep(t confidentialNodeType, path string) setupStep {
+	return setupStep{
+		name: "platform",
+		run: func(ctx context.Context, _ *installer) error {
+			if _, err := statFile(path); err != nil {
+				return fmt.Errorf("node is not a %s guest: %w", t, err)
+			}
+			return nil
+		},
+	}
+}
+
+// setupSteps returns the steps setting up the GPUs of the node type. TDX and SEV-SNP guests expose a guest device,
+// checked before the GPUs are attested and set to ready state. SEV guests have no such device, so their GPUs are
+// only attested and set to ready state.
+func (t confidentialNodeType) setupSteps() []setupStep {
+	switch t {
+	case tdxNode:
+		return []setupStep{guestDeviceStep(t, "/dev/tdx_guest"), attestStep, readyStateStep}
+	case sevSNPNode:
+		return []setupStep{guestDeviceStep(t, "/dev/sev-guest"), attestStep, readyStateStep}
+	case sevNode:
+		return []setupStep{attestStep, readyStateStep}
+	default:
+		return nil
+	}
+}
@@ -19,7 +19,6 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
 	"os/signal"
 	"regexp"
 	"strconv"
@@ -36,109 +35,87 @@ const (
 )
 
 var (
-	readFile = os.ReadFile
+	readFile     = os.ReadFile
+	statFile     = os.Stat
+	reboot       = rebootNode
+	ldConfigFile = "/etc/ld.so.conf.d/nvidia.conf"
 
 	containerPathPrefix = flag.String("container-path", "/usr/local/nvidia", "Path on the container that mounts host nvidia install directory")
 	cgpuConfigFile      = flag.String("cgpu-config", "/etc/nvidia/confidential_node_type.txt", "File with Confidential Node Type used on Node")
 	readyDelay          = flag.Int64("ready-delay-ms", 1000, "How much time to wait before setting GPU to ready state. Adding a delay helps to reduce the chances of a start up error.")
+	readinessFile       = flag.String("readiness-file", "/run/nvidia-persistenced-installer/ready", "File existing only while the persistence daemon runs and the GPUs are set up")
+	checkReady          = flag.Bool("check-ready", false, "Exit successfully if the readiness file exists and with an error otherwise, to probe a running installer")
+
+	attestationEvidenceFile = flag.String("attestation-evidence-file", "/etc/nvidia/cgpu_attestation_evidence.json", "File on the node to write the attestation evidence of the confidential GPUs to")
+	expectedCCEnvironment   = flag.String("expected-cc-environment", "PRODUCTION", "Confidential computing environment the GPUs must report before being set to ready state, any environment when empty")
 )
 
 func main() {
 	flag.Parse()
-	ctx := context.Background()
-
-	// Only run persistence daemon on confidential GPU nodes.
-	enabled, err := checkConfidentialGPUEnablement(ctx)
-	if err != nil {
-		glog.ExitContextf(ctx, "parseCGPUConfig failed: %v", err)
-	}
-
-	if enabled {
-		// This is necessary to be able to use nvidia smi from the container to set the GPU to a ready state.
-		if err := updateContainerLdCache(); err != nil {
-			glog.ExitContextf(ctx, "updateContainerLdCache failed: %v", err)
-		}
-
-		if err := enablePersistenceMode(ctx); err != nil {
-			glog.ExitContextf(ctx, "failed to start persistence mode: %v", err)
-		}
-		// Add small delay before setting the ready state for consistency.
-		// If the workload starts too close to when the persistence daemon has started sometimes there can be errors.
-		time.Sleep(time.Duration(*readyDelay) * time.Millisecond)
-
-		// Mark GPU with ready state. If encounter no devices were found issue, reboot the node.
-		if output, err := setGPUReadyState(ctx); err != nil {
-			glog.Infof("failed to set gpu to ready state: %v, output: %s", err, output)
-			if strings.Contains(output, "No devices were found") {
-				glog.Infof("No devices were found, rebooting node to resolve")
-				if err := rebootNode(); err != nil {
-					glog.Errorf("Failed to trigger node reboot: %v", err)
-				}
-			}
-			// Exit, since we cannot proceed when encounter error.
+	if *checkReady {
+		// The image has no shell, so the readiness probe runs the installer itself.
+		if err := checkReadiness(*readinessFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
-	} else {
-		glog.InfoContext(ctx, "Confidential GPU is NOT enabled, skipping nvidia persistenced enablement.")
-		// Don't exit as this is intended for a side car which would cause it to restart infinitely.
+		return
 	}
+	// Need to keep the container running so that the nvidia persistence daemon can keep running,
+	// until a termination signal (SIGINT and SIGTERM) is received.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	i := newInstaller(os.Getenv("NODE_NAME"), *readinessFile, time.Duration(*readyDelay)*time.Millisecond)
+	if err := i.run(ctx); err != nil {
+		// Exit, since we cannot proceed when encounter error.
+		glog.ExitContextf(ctx, "nvidia persistenced installer failed: %v", err)
+	}
+	glog.InfoContext(ctx, "Received termination signal. Shutting down...")
+}
 
-	// Need to keep the container running so that the nvidia persistence daemon can keep running.
-	// Create a channel to listen for termination signals (SIGINT and SIGTERM)
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Block indefinitely until a signal is received
-	sig := <-sigChan
-	fmt.Printf("Received signal: %v. Shutting down...\n", sig)
+// checkReadiness returns an error if the readiness file does not exist.
+func checkReadiness(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("nvidia persistenced installer is not ready: %w", err)
+	}
+	return nil
 }
 
-func enablePersistenceMode(ctx context.Context) error {
-	glog.InfoContext(ctx, "Starting NVIDIA persistence daemon.")
-	cmdArgs := []string{}
+// persistencedArgs returns the arguments running the NVIDIA persistence daemon in the foreground, so that it can be supervised.
+func persistencedArgs(ctx context.Context) ([]string, error) {
+	cmdArgs := []string{"--foreground"}
 	if versionMajor, err := nvidiaVersionMajor(ctx); err != nil {
-		return err
+		return nil, err
 	} else if versionMajor >= minUVMSupportedVersion {
 		// UVM persistence mode is only available starting at R550.
 		cmdArgs = append(cmdArgs, "--uvm-persistence-mode")
 		glog.InfoContext(ctx, "using --uvm-persistence-mode")
 	}
 	cmdArgs = append(cmdArgs, "--nvidia-cfg-path="+*containerPathPrefix+"/lib64")
-	persistencedCMD := exec.Command(*containerPathPrefix+"/bin/nvidia-persistenced", cmdArgs...)
-	if err := persistencedCMD.Run(); err != nil {
-		return err
-	}
-	glog.InfoContext(ctx, "NVIDIA Persistence Mode Enabled.")
-	return nil
+	return cmdArgs, nil
 }
 
 func setGPUReadyState(ctx context.Context) (string, error) {
-	gpuReadyCMD := exec.Command(*containerPathPrefix+"/bin/nvidia-smi", "conf-compute", "-srs", "1")
-	if output, err := gpuReadyCMD.CombinedOutput(); err != nil {
-		return string(output), err
+	if output, err := runner.Output(ctx, *containerPathPrefix+"/bin/nvidia-smi", "conf-compute", "-srs", "1"); err != nil {
+		return output, err
 	}
 	glog.InfoContext(ctx, "Confidential GPU is ready.")
 	return "", nil
 }
 
-func updateContainerLdCache() error {
-	f, err := os.Create("/etc/ld.so.conf.d/nvidia.conf")
-	if err != nil {
-		f.Close()
+func updateContainerLdCache(ctx context.Context) error {
+	if err := os.WriteFile(ldConfigFile, []byte(*containerPathPrefix+"/lib64"), 0644); err != nil {
 		return fmt.Errorf("failed to update ld cache: %w", err)
 	}
-	f.WriteString(*containerPathPrefix + "/lib64")
-	f.Close()
-	err = exec.Command("ldconfig").Run()
-	if err != nil {
-		return fmt.Errorf("failed to update ld cache: %w", err)
+	if output, err := runner.Output(ctx, "ldconfig"); err != nil {
+		return fmt.Errorf("failed to update ld cache: %w, output: %s", err, output)
 	}
 	return nil
 }
 
 func getLoadedNVIDIAKernelModuleVersion(ctx context.Context, versionFilePath string) string {
 	glog.InfoContextf(ctx, "Attempting to read nvidia gpu driver version from: %s", versionFilePath)
-	content, err := os.ReadFile(versionFilePath)
+	content, err := readFile(versionFilePath)
 	if err != nil {
 		glog.ErrorContextf(ctx, "Failed to read version file: %v", err)
 		return ""
@@ -169,19 +146,17 @@ func nvidiaVersionMajor(ctx context.Context) (int, error) {
 	return versionMajor, nil
 }
 
-func checkConfidentialGPUEnablement(ctx context.Context) (bool, error) {
+func readConfidentialNodeType(ctx context.Context) (confidentialNodeType, error) {
 	file, err := readFile(*cgpuConfigFile)
 	if err != nil {
 		// Treat non existence of file as disabled.
 		if os.IsNotExist(err) {
 			glog.InfoContextf(ctx, "confidential node type file not found at %v, skipping persistenced installation", *cgpuConfigFile)
-			return false, nil
+			return nonConfidentialNode, nil
 		}
-		return false, err
+		return nonConfidentialNode, err
 	}
-	// Remove any trailing spaces and null strings to avoid issues in comparison.
-	confidentialNodeType := strings.ToLower(strings.Trim(string(file), " \r\n\x00"))
-	return confidentialNodeType == "tdx" || confidentialNodeType == "sev", nil
+	return parseConfidentialNodeType(string(file)), nil
 }
 
 func rebootNode() error {
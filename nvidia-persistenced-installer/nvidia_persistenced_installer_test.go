@@ -17,16 +17,18 @@ package main
 import (
 	"context"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
 type fakeReadFileFunc func(name string) ([]byte, error)
 
-func TestCheckConfidentialGPUEnabled(t *testing.T) {
+func TestReadConfidentialNodeType(t *testing.T) {
 	testcases := []struct {
 		name         string
 		readFileFunc fakeReadFileFunc
-		wantEnabled  bool
+		wantType     confidentialNodeType
 		wantErr      bool
 	}{
 		{
@@ -34,7 +36,7 @@ func TestCheckConfidentialGPUEnabled(t *testing.T) {
 			readFileFunc: func(name string) ([]byte, error) {
 				return nil, os.ErrNotExist
 			},
-			wantEnabled: false,
+			wantType: nonConfidentialNode,
 		},
 		{
 			name: "failed to read file",
@@ -48,35 +50,49 @@ func TestCheckConfidentialGPUEnabled(t *testing.T) {
 			readFileFunc: func(name string) ([]byte, error) {
 				return []byte{}, nil
 			},
-			wantEnabled: false,
+			wantType: nonConfidentialNode,
 		},
 		{
 			name: "tdx",
 			readFileFunc: func(name string) ([]byte, error) {
 				return []byte("TDX"), nil
 			},
-			wantEnabled: true,
+			wantType: tdxNode,
 		},
 		{
 			name: "snp_sev",
 			readFileFunc: func(name string) ([]byte, error) {
 				return []byte("snp_sev"), nil
 			},
-			wantEnabled: false,
+			wantType: nonConfidentialNode,
+		},
+		{
+			name: "sev",
+			readFileFunc: func(name string) ([]byte, error) {
+				return []byte("sev\n"), nil
+			},
+			wantType: sevNode,
+		},
+		{
+			name: "sev_snp",
+			readFileFunc: func(name string) ([]byte, error) {
+				return []byte("SEV_SNP"), nil
+			},
+			wantType: sevSNPNode,
 		},
 		{
 			name: "trailing spaces - enabled",
 			readFileFunc: func(name string) ([]byte, error) {
 				return []byte("tdx  "), nil
 			},
-			wantEnabled: true,
+			wantType: tdxNode,
 		},
 		{
 			name: "trailing spaces - disabled",
 			readFileFunc: func(name string) ([]byte, error) {
 				return []byte("other  "), nil
 			},
-			wantEnabled: false,
+			wantType: nonConfidentialNode,
 		},
 	}
 
@@ -84,15 +100,45 @@ func TestCheckConfidentialGPUEnabled(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			readFile = tc.readFileFunc
 
-			enabled, err := checkConfidentialGPUEnablement(context.Background())
+			nodeType, err := readConfidentialNodeType(context.Background())
 
 			if err != nil && !tc.wantErr {
-				t.Errorf("checkConfidentialGPUEnablement returned unexpected error %v", err)
+				t.Errorf("readConfidentialNodeType returned unexpected error %v", err)
 			}
 
-			if enabled != tc.wantEnabled {
-				t.Errorf("checkConfidentialGPUEnablement returned unexpected enablement: want %v, got %v", tc.wantEnabled, enabled)
+			if nodeType != tc.wantType {
+				t.Errorf("readConfidentialNodeType returned unexpected node type: want %v, got %v", tc.wantType, nodeType)
 			}
 		})
 	}
 }
+
+func TestCheckReadiness(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ready")
+	if err := checkReadiness(path); err == nil {
+		t.Errorf("checkReadiness succeeded without readiness file")
+	}
+	if err := os.WriteFile(path, []byte("ready\n"), 0644); err != nil {
+		t.Fatalf("failed to write readiness file: %v", err)
+	}
+	if err := checkReadiness(path); err != nil {
+		t.Errorf("checkReadiness failed with readiness file: %v", err)
+	}
+}
+
+func TestSetupSteps(t *testing.T) {
+	for nodeType, want := range map[confidentialNodeType][]string{
+		tdxNode:             {"platform", "attest", "ready-state"},
+		sevSNPNode:          {"platform", "attest", "ready-state"},
+		sevNode:             {"attest", "ready-state"},
+		nonConfidentialNode: nil,
+	} {
+		var got []string
+		for _, step := range nodeType.setupSteps() {
+			got = append(got, step.name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("setupSteps() of %s = %v, want %v", nodeType, got, want)
+		}
+	}
+}
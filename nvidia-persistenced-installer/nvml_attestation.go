@@ -0,0 +1,148 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cgo
+
+package main
+
+// The vendored go-nvml does not bind the confidential computing API of NVML, so the attestation
+// reports are fetched by loading NVML directly. The layout of the report follows nvml.h of R535+.
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+
+#define CC_NONCE_SIZE 0x20
+#define CC_REPORT_SIZE 0x2000
+#define CC_CEC_REPORT_SIZE 0x1000
+#define UUID_SIZE 96
+
+#define ERROR_LIBRARY_NOT_FOUND -1
+#define ERROR_FUNCTION_NOT_FOUND -2
+
+typedef struct {
+	unsigned int isCecAttestationReportPresent;
+	unsigned int attestationReportSize;
+	unsigned int cecAttestationReportSize;
+	unsigned char nonce[CC_NONCE_SIZE];
+	unsigned char attestationReport[CC_REPORT_SIZE];
+	unsigned char cecAttestationReport[CC_CEC_REPORT_SIZE];
+} ccAttestationReport;
+
+typedef void *nvmlDevice;
+
+static void *nvml;
+static int (*nvmlInit)(void);
+static int (*nvmlShutdown)(void);
+static int (*nvmlDeviceGetCount)(unsigned int *);
+static int (*nvmlDeviceGetHandleByIndex)(unsigned int, nvmlDevice *);
+static int (*nvmlDeviceGetUUID)(nvmlDevice, char *, unsigned int);
+static int (*nvmlDeviceGetConfComputeGpuAttestationReport)(nvmlDevice, ccAttestationReport *);
+static const char *(*nvmlErrorString)(int);
+
+static int ccInit(void) {
+	if (!nvml) {
+		nvml = dlopen("libnvidia-ml.so.1", RTLD_NOW | RTLD_LOCAL);
+		if (!nvml) {
+			return ERROR_LIBRARY_NOT_FOUND;
+		}
+	}
+	nvmlInit = dlsym(nvml, "nvmlInit_v2");
+	nvmlShutdown = dlsym(nvml, "nvmlShutdown");
+	nvmlDeviceGetCount = dlsym(nvml, "nvmlDeviceGetCount_v2");
+	nvmlDeviceGetHandleByIndex = dlsym(nvml, "nvmlDeviceGetHandleByIndex_v2");
+	nvmlDeviceGetUUID = dlsym(nvml, "nvmlDeviceGetUUID");
+	nvmlDeviceGetConfComputeGpuAttestationReport = dlsym(nvml, "nvmlDeviceGetConfComputeGpuAttestationReport");
+	nvmlErrorString = dlsym(nvml, "nvmlErrorString");
+	if (!nvmlInit || !nvmlShutdown || !nvmlDeviceGetCount || !nvmlDeviceGetHandleByIndex || !nvmlDeviceGetUUID ||
+		!nvmlDeviceGetConfComputeGpuAttestationReport || !nvmlErrorString) {
+		return ERROR_FUNCTION_NOT_FOUND;
+	}
+	return nvmlInit();
+}
+
+static void ccShutdown(void) {
+	nvmlShutdown();
+}
+
+static int ccDeviceCount(unsigned int *count) {
+	return nvmlDeviceGetCount(count);
+}
+
+static int ccDeviceReport(unsigned int index, char *uuid, ccAttestationReport *report) {
+	nvmlDevice device;
+	int ret = nvmlDeviceGetHandleByIndex(index, &device);
+	if (ret) {
+		return ret;
+	}
+	ret = nvmlDeviceGetUUID(device, uuid, UUID_SIZE);
+	if (ret) {
+		return ret;
+	}
+	return nvmlDeviceGetConfComputeGpuAttestationReport(device, report);
+}
+
+static const char *ccErrorString(int ret) {
+	if (ret == ERROR_LIBRARY_NOT_FOUND) {
+		return "libnvidia-ml.so.1 not found";
+	}
+	if (ret == ERROR_FUNCTION_NOT_FOUND) {
+		return "confidential computing functions not found in NVML, driver R535 or later is required";
+	}
+	return nvmlErrorString(ret);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// nvmlAttestationReports fetches the attestation report of each GPU for the nonce, using NVML.
+func nvmlAttestationReports(nonce []byte) ([]gpuAttestationReport, error) {
+	if len(nonce) != C.CC_NONCE_SIZE {
+		return nil, fmt.Errorf("invalid nonce size %d, expected %d", len(nonce), C.CC_NONCE_SIZE)
+	}
+	if ret := C.ccInit(); ret != 0 {
+		return nil, fmt.Errorf("failed to initialize NVML: %s", C.GoString(C.ccErrorString(ret)))
+	}
+	defer C.ccShutdown()
+
+	var count C.uint
+	if ret := C.ccDeviceCount(&count); ret != 0 {
+		return nil, fmt.Errorf("failed to get GPU count: %s", C.GoString(C.ccErrorString(ret)))
+	}
+	reports := make([]gpuAttestationReport, 0, int(count))
+	for i := 0; i < int(count); i++ {
+		var (
+			uuid   [C.UUID_SIZE]C.char
+			report C.ccAttestationReport
+		)
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(&report.nonce[0])), C.CC_NONCE_SIZE), nonce)
+		if ret := C.ccDeviceReport(C.uint(i), &uuid[0], &report); ret != 0 {
+			return nil, fmt.Errorf("failed to get the attestation report of GPU %d: %s", i, C.GoString(C.ccErrorString(ret)))
+		}
+		r := gpuAttestationReport{
+			Index:  i,
+			UUID:   C.GoString(&uuid[0]),
+			Report: C.GoBytes(unsafe.Pointer(&report.attestationReport[0]), C.int(min(report.attestationReportSize, C.CC_REPORT_SIZE))),
+		}
+		if report.isCecAttestationReportPresent != 0 {
+			r.CECReport = C.GoBytes(unsafe.Pointer(&report.cecAttestationReport[0]), C.int(min(report.cecAttestationReportSize, C.CC_CEC_REPORT_SIZE)))
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// commandRunner runs commands, so that they can be faked in tests.
+type commandRunner interface {
+	// Output runs the command and returns its combined standard output and standard error.
+	Output(ctx context.Context, name string, args ...string) (string, error)
+	// Start starts the command, which is killed when the context is done.
+	Start(ctx context.Context, name string, args ...string) (process, error)
+}
+
+// process is a started command.
+type process interface {
+	// Wait waits for the command to exit.
+	Wait() error
+}
+
+type execRunner struct{}
+
+func (execRunner) Output(ctx context.Context, name string, args ...string) (string, error) {
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	return string(output), err
+}
+
+func (execRunner) Start(ctx context.Context, name string, args ...string) (process, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+var runner commandRunner = execRunner{}
@@ -29,15 +29,22 @@ import (
 )
 
 type pluginServiceV1Beta1 struct {
-	ngm *nvidiaGPUManager
+	ngm    *nvidiaGPUManager
+	server *grpc.Server
+	// resourceName is the extended resource of the devices served, or all devices when empty.
+	resourceName string
 }
 
 func (s *pluginServiceV1Beta1) GetDevicePluginOptions(ctx context.Context, e *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
-	return &pluginapi.DevicePluginOptions{}, nil
+	return &pluginapi.DevicePluginOptions{
+		GetPreferredAllocationAvailable: s.ngm.gpuConfig.GPUSharingConfig.AllowMultiGPURequests,
+	}, nil
 }
 
 func (s *pluginServiceV1Beta1) ListAndWatch(emtpy *pluginapi.Empty, stream pluginapi.DevicePlugin_ListAndWatchServer) error {
 	glog.Infoln("device-plugin: ListAndWatch start")
+	updates := s.ngm.watchDeviceUpdates()
+	defer s.ngm.stopWatchingDeviceUpdates(updates)
 	if err := s.sendDevices(stream); err != nil {
 		return err
 	}
@@ -46,6 +53,9 @@ func (s *pluginServiceV1Beta1) ListAndWatch(emtpy *pluginapi.Empty, stream plugi
 		case d := <-s.ngm.Health:
 			glog.Infof("device-plugin: %s device marked as %s", d.ID, d.Health)
 			s.ngm.SetDeviceHealth(d.ID, d.Health, d.Topology)
+			// Health changes are received by a single stream, but all resources need to send their devices.
+			s.ngm.notifyDeviceUpdates()
+		case <-updates:
 			if err := s.sendDevices(stream); err != nil {
 				return err
 			}
@@ -57,7 +67,14 @@ func (s *pluginServiceV1Beta1) Allocate(ctx context.Context, requests *pluginapi
 	resps := new(pluginapi.AllocateResponse)
 	for _, rqt := range requests.ContainerRequests {
 		// Validate if the request is for shared GPUs and check if the request meets the GPU sharing conditions.
-		if err := gpusharing.ValidateRequest(rqt.DevicesIDs, len(s.ngm.ListPhysicalDevices())); err != nil {
+		if s.ngm.gpuConfig.GPUSharingConfig.AllowMultiGPURequests {
+			if err := gpusharing.ValidateMultiDeviceRequest(rqt.DevicesIDs); err != nil {
+				return nil, err
+			}
+		} else if err := gpusharing.ValidateRequest(rqt.DevicesIDs, len(s.ngm.ListPhysicalDevices()), s.ngm.gpuConfig.sharedStrategy()); err != nil {
+			return nil, err
+		}
+		if err := s.ngm.ValidateMemoryRequest(rqt.DevicesIDs); err != nil {
 			return nil, err
 		}
 
@@ -82,11 +99,12 @@ func (s *pluginServiceV1Beta1) Allocate(ctx context.Context, requests *pluginapi
 			})
 		}
 
-		for i := range s.ngm.mountPaths {
-			resp.Mounts = append(resp.Mounts, &s.ngm.mountPaths[i])
+		mounts := s.ngm.Mounts(rqt.DevicesIDs)
+		for i := range mounts {
+			resp.Mounts = append(resp.Mounts, &mounts[i])
 		}
 
-		resp.Envs = s.ngm.Envs(len(rqt.DevicesIDs))
+		resp.Envs = s.ngm.Envs(rqt.DevicesIDs)
 		resps.ContainerResponses = append(resps.ContainerResponses, resp)
 	}
 	return resps, nil
@@ -97,13 +115,21 @@ func (s *pluginServiceV1Beta1) PreStartContainer(ctx context.Context, r *plugina
 	return &pluginapi.PreStartContainerResponse{}, nil
 }
 
-func (s *pluginServiceV1Beta1) GetPreferredAllocation(context.Context, *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
-	glog.Errorf("device-plugin: GetPreferredAllocation should NOT be called for GKE nvidia GPU device plugin\n")
-	return &pluginapi.PreferredAllocationResponse{}, nil
+func (s *pluginServiceV1Beta1) GetPreferredAllocation(ctx context.Context, requests *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
+	if !s.ngm.gpuConfig.GPUSharingConfig.AllowMultiGPURequests {
+		glog.Errorf("device-plugin: GetPreferredAllocation should NOT be called for GKE nvidia GPU device plugin\n")
+		return &pluginapi.PreferredAllocationResponse{}, nil
+	}
+	resps := new(pluginapi.PreferredAllocationResponse)
+	for _, rqt := range requests.ContainerRequests {
+		ids := s.ngm.PreferredAllocation(rqt.AvailableDeviceIDs, rqt.MustIncludeDeviceIDs, int(rqt.AllocationSize))
+		resps.ContainerResponses = append(resps.ContainerResponses, &pluginapi.ContainerPreferredAllocationResponse{DeviceIDs: ids})
+	}
+	return resps, nil
 }
 
 func (s *pluginServiceV1Beta1) RegisterService() {
-	pluginapi.RegisterDevicePluginServer(s.ngm.grpcServer, s)
+	pluginapi.RegisterDevicePluginServer(s.server, s)
 }
 
 // TODO: remove this function once we move to probe based registration.
@@ -133,12 +159,15 @@ func RegisterWithV1Beta1Kubelet(kubeletEndpoint, pluginEndpoint, resourceName st
 func (s *pluginServiceV1Beta1) sendDevices(stream pluginapi.DevicePlugin_ListAndWatchServer) error {
 	resp := new(pluginapi.ListAndWatchResponse)
 	for _, dev := range s.ngm.ListDevices() {
+		if s.resourceName != "" && s.ngm.deviceResourceName(dev.ID) != s.resourceName {
+			continue
+		}
 		resp.Devices = append(resp.Devices, &pluginapi.Device{ID: dev.ID, Health: dev.Health, Topology: dev.Topology})
 	}
 	glog.Infof("ListAndWatch: send devices %v\n", resp)
 	if err := stream.Send(resp); err != nil {
 		glog.Errorf("device-plugin: cannot update device states: %v\n", err)
-		s.ngm.grpcServer.Stop()
+		s.server.Stop()
 		return err
 	}
 	return nil
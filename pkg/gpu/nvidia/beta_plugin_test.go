@@ -267,17 +267,11 @@ func testNvidiaGPUManagerBetaAPI(gpuConfig GPUConfig, wantDevices map[string]*pl
 	mountPaths := []pluginapi.Mount{
 		{HostPath: "/home/kubernetes/bin/nvidia", ContainerPath: "/usr/local/nvidia", ReadOnly: true},
 		{HostPath: "/home/kubernetes/bin/vulkan/icd.d", ContainerPath: "/etc/vulkan/icd.d", ReadOnly: true}}
-	testGpuManager := NewNvidiaGPUManager(testDevDir, "", mountPaths, gpuConfig)
+	testGpuManager := NewNvidiaGPUManager(testDevDir, "", mountPaths, gpuConfig, &nvmlutil.MockDeviceInfo{TestDevDir: testDevDir})
 	if testGpuManager == nil {
 		return fmt.Errorf("failed to initilize a GPU manager")
 	}
 
-	// overriding nvmlutil.NvmlDeviceInfo to mockDeviceInfo interface
-	nvmlutil.NvmlDeviceInfo = &nvmlutil.MockDeviceInfo{}
-	mockInfo, _ := nvmlutil.NvmlDeviceInfo.(*nvmlutil.MockDeviceInfo)
-
-	mockInfo.TestDevDir = testDevDir
-
 	// Start GPU manager.
 	if err := testGpuManager.Start(); err != nil {
 		return fmt.Errorf("unable to start gpu manager: %w", err)
@@ -451,17 +445,11 @@ func testNvidiaGPUManagerBetaAPIWithMig(gpuConfig GPUConfig, wantDevices map[str
 	mountPaths := []pluginapi.Mount{
 		{HostPath: "/home/kubernetes/bin/nvidia", ContainerPath: "/usr/local/nvidia", ReadOnly: true},
 		{HostPath: "/home/kubernetes/bin/vulkan/icd.d", ContainerPath: "/etc/vulkan/icd.d", ReadOnly: true}}
-	testGpuManager := NewNvidiaGPUManager(testDevDir, testProcDir, mountPaths, gpuConfig)
+	testGpuManager := NewNvidiaGPUManager(testDevDir, testProcDir, mountPaths, gpuConfig, &nvmlutil.MockDeviceInfo{TestDevDir: testDevDir})
 	if testGpuManager == nil {
 		return fmt.Errorf("failed to initilize a GPU manager")
 	}
 
-	// overriding nvmlDeviceInfo to mockDeviceInfo interface
-	nvmlutil.NvmlDeviceInfo = &nvmlutil.MockDeviceInfo{}
-	mockInfo, _ := nvmlutil.NvmlDeviceInfo.(*nvmlutil.MockDeviceInfo)
-
-	mockInfo.TestDevDir = testDevDir
-
 	// Start GPU manager.
 	if err := testGpuManager.Start(); err != nil {
 		return fmt.Errorf("unable to start gpu manager: %w", err)
@@ -612,3 +600,119 @@ func testNvidiaGPUManagerBetaAPIWithMig(gpuConfig GPUConfig, wantDevices map[str
 
 	return nil
 }
+
+func TestAllocateMultiGPU(t *testing.T) {
+	s := &pluginServiceV1Beta1{ngm: newMultiGPUTestManager()}
+
+	opts, err := s.GetDevicePluginOptions(context.Background(), &pluginapi.Empty{})
+	if err != nil {
+		t.Fatalf("GetDevicePluginOptions() failed: %v", err)
+	}
+	if !opts.GetPreferredAllocationAvailable {
+		t.Errorf("GetPreferredAllocationAvailable = false, want true")
+	}
+
+	resp, err := s.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"nvidia2/vgpu0", "nvidia0/vgpu3"}}},
+	})
+	if err != nil {
+		t.Fatalf("Allocate() failed: %v", err)
+	}
+	var paths []string
+	for _, d := range resp.ContainerResponses[0].Devices {
+		paths = append(paths, d.HostPath)
+	}
+	if diff := cmp.Diff([]string{"/dev/nvidia2", "/dev/nvidia0"}, paths); diff != "" {
+		t.Errorf("unexpected devices (-want, +got) = %s", diff)
+	}
+	wantEnvs := map[string]string{
+		mpsThreadLimitEnv:  "25",
+		mpsMemLimitEnv:     "0=4096M,1=4096M",
+		cudaDeviceOrderEnv: "PCI_BUS_ID",
+	}
+	if diff := cmp.Diff(wantEnvs, resp.ContainerResponses[0].Envs); diff != "" {
+		t.Errorf("unexpected envs (-want, +got) = %s", diff)
+	}
+
+	if _, err := s.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"nvidia1/vgpu0", "nvidia1/vgpu1"}}},
+	}); err == nil {
+		t.Errorf("Allocate() of two slots on the same GPU succeeded, want error")
+	}
+
+	prefResp, err := s.GetPreferredAllocation(context.Background(), &pluginapi.PreferredAllocationRequest{
+		ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{{
+			AvailableDeviceIDs: []string{"nvidia0/vgpu0", "nvidia0/vgpu1", "nvidia1/vgpu0"},
+			AllocationSize:     2,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("GetPreferredAllocation() failed: %v", err)
+	}
+	if diff := cmp.Diff([]string{"nvidia0/vgpu0", "nvidia1/vgpu0"}, prefResp.ContainerResponses[0].DeviceIDs); diff != "" {
+		t.Errorf("unexpected preferred allocation (-want, +got) = %s", diff)
+	}
+}
+
+type fakeListAndWatchServer struct {
+	grpc.ServerStream
+	sent chan *pluginapi.ListAndWatchResponse
+}
+
+func (f *fakeListAndWatchServer) Send(resp *pluginapi.ListAndWatchResponse) error {
+	f.sent <- resp
+	return nil
+}
+
+func receiveDevices(t *testing.T, stream *fakeListAndWatchServer) map[string]string {
+	t.Helper()
+	select {
+	case resp := <-stream.sent:
+		devices := make(map[string]string)
+		for _, d := range resp.Devices {
+			devices[d.ID] = d.Health
+		}
+		return devices
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for ListAndWatch to send devices")
+		return nil
+	}
+}
+
+func TestListAndWatchGPUSharingPolicies(t *testing.T) {
+	ngm := &nvidiaGPUManager{
+		devices: map[string]pluginapi.Device{
+			"nvidia0": {ID: "nvidia0", Health: pluginapi.Healthy},
+			"nvidia1": {ID: "nvidia1", Health: pluginapi.Healthy},
+		},
+		gpuConfig: GPUConfig{
+			GPUSharingPolicies: []GPUSharingPolicy{
+				{GPUs: []string{"1"}, GPUSharingStrategy: "time-sharing", MaxSharedClientsPerGPU: 2},
+			},
+		},
+		sharingPolicies: map[string]GPUSharingPolicy{
+			"nvidia1": {GPUs: []string{"1"}, GPUSharingStrategy: "time-sharing", MaxSharedClientsPerGPU: 2},
+		},
+		Health: make(chan pluginapi.Device),
+	}
+	exclusive := &fakeListAndWatchServer{sent: make(chan *pluginapi.ListAndWatchResponse, 1)}
+	shared := &fakeListAndWatchServer{sent: make(chan *pluginapi.ListAndWatchResponse, 1)}
+	go (&pluginServiceV1Beta1{ngm: ngm, resourceName: "nvidia.com/gpu"}).ListAndWatch(&pluginapi.Empty{}, exclusive)
+	go (&pluginServiceV1Beta1{ngm: ngm, resourceName: "nvidia.com/gpu-shared"}).ListAndWatch(&pluginapi.Empty{}, shared)
+
+	if diff := cmp.Diff(map[string]string{"nvidia0": pluginapi.Healthy}, receiveDevices(t, exclusive)); diff != "" {
+		t.Errorf("unexpected exclusive devices (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"nvidia1/vgpu0": pluginapi.Healthy, "nvidia1/vgpu1": pluginapi.Healthy}, receiveDevices(t, shared)); diff != "" {
+		t.Errorf("unexpected shared devices (-want, +got) = %s", diff)
+	}
+
+	// A health change is received by one of the streams, but both send their devices again.
+	ngm.Health <- pluginapi.Device{ID: "nvidia1", Health: pluginapi.Unhealthy}
+	if diff := cmp.Diff(map[string]string{"nvidia0": pluginapi.Healthy}, receiveDevices(t, exclusive)); diff != "" {
+		t.Errorf("unexpected exclusive devices (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"nvidia1/vgpu0": pluginapi.Unhealthy, "nvidia1/vgpu1": pluginapi.Unhealthy}, receiveDevices(t, shared)); diff != "" {
+		t.Errorf("unexpected shared devices (-want, +got) = %s", diff)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 )
 
 type GPUSharingStrategy string
@@ -28,8 +29,6 @@ const (
 	MPS         GPUSharingStrategy = "mps"
 )
 
-var SharingStrategy GPUSharingStrategy
-
 // ValidateRequest will first check if the input device IDs are virtual device IDs, and then validate the request.
 // A valid sharing request (time-sharing)should meet the following conditions:
 // 1. it is only valid to request one virtual devices in a single request.
@@ -37,11 +36,21 @@ var SharingStrategy GPUSharingStrategy
 // 1. if there is only one physical device, it is valid to request multiple virtual devices in a single request.
 // 2. if there are multiple physical devices, it is only valid to request one virtual device in a single request.
 // Note: in this validation, each MIG partition will be regarded as a physical device.
-func ValidateRequest(requestDevicesIDs []string, deviceCount int) error {
+// A valid GPU memory request should only request memory units of a single physical device.
+func ValidateRequest(requestDevicesIDs []string, deviceCount int, sharingStrategy GPUSharingStrategy) error {
+	if len(requestDevicesIDs) > 1 && IsMemoryDeviceID(requestDevicesIDs[0]) {
+		physicalDeviceID, _ := VirtualToPhysicalDeviceID(requestDevicesIDs[0])
+		for _, id := range requestDevicesIDs[1:] {
+			if deviceID, err := VirtualToPhysicalDeviceID(id); err != nil || deviceID != physicalDeviceID {
+				return errors.New("invalid request for GPU memory, all nvidia.com/gpu-memory units must be allocated from a single GPU")
+			}
+		}
+		return nil
+	}
 	if len(requestDevicesIDs) > 1 && IsVirtualDeviceID(requestDevicesIDs[0]) {
-		if SharingStrategy == TimeSharing {
+		if sharingStrategy == TimeSharing {
 			return errors.New("invalid request for sharing GPU (time-sharing), at most 1 nvidia.com/gpu can be requested on GPU nodes")
-		} else if SharingStrategy == MPS && deviceCount > 1 {
+		} else if sharingStrategy == MPS && deviceCount > 1 {
 			return errors.New("invalid request for sharing GPU (MPS), at most 1 nvidia.com/gpu can be requested on multi-GPU nodes")
 		}
 	}
@@ -49,19 +58,50 @@ func ValidateRequest(requestDevicesIDs []string, deviceCount int) error {
 	return nil
 }
 
+// ValidateMultiDeviceRequest checks that every virtual device of a request is backed by a distinct physical device.
+func ValidateMultiDeviceRequest(requestDevicesIDs []string) error {
+	physicalDeviceIDs := make(map[string]bool)
+	for _, id := range requestDevicesIDs {
+		physicalDeviceID, err := VirtualToPhysicalDeviceID(id)
+		if err != nil {
+			return err
+		}
+		if physicalDeviceIDs[physicalDeviceID] {
+			return fmt.Errorf("invalid request for sharing GPU, multiple nvidia.com/gpu are allocated on the same physical device %s", physicalDeviceID)
+		}
+		physicalDeviceIDs[physicalDeviceID] = true
+	}
+	return nil
+}
+
 // VirtualToPhysicalDeviceID takes a virtualDeviceID and converts it to a physicalDeviceID.
 func VirtualToPhysicalDeviceID(virtualDeviceID string) (string, error) {
 	if !IsVirtualDeviceID(virtualDeviceID) {
 		return "", fmt.Errorf("virtual device ID (%s) is not valid", virtualDeviceID)
 	}
 
-	vgpuRegex := regexp.MustCompile("/vgpu([0-9]+)$")
+	vgpuRegex := regexp.MustCompile("/(vgpu|mem)([0-9]+)$")
 	return vgpuRegex.Split(virtualDeviceID, -1)[0], nil
 }
 
 // isVirtualDeviceID returns true if a input device ID comes from a virtual GPU device.
 func IsVirtualDeviceID(virtualDeviceID string) bool {
-	return isVirtualDeviceIDForDefaultMode(virtualDeviceID) || isVirtualDeviceIDForMIGMode(virtualDeviceID)
+	return isVirtualDeviceIDForDefaultMode(virtualDeviceID) || isVirtualDeviceIDForMIGMode(virtualDeviceID) || IsMemoryDeviceID(virtualDeviceID)
+}
+
+// IsMemoryDeviceID returns true if a input device ID is a GPU memory unit, e.g. 'nvidia0/mem3'.
+func IsMemoryDeviceID(deviceID string) bool {
+	validRegex := regexp.MustCompile("nvidia([0-9]+)(\\/gi([0-9]+))?\\/mem([0-9]+)$")
+	return validRegex.MatchString(deviceID)
+}
+
+// MemoryUnitIndex returns the index of a GPU memory unit on its physical device, e.g. 3 for 'nvidia0/mem3'.
+func MemoryUnitIndex(deviceID string) (int, error) {
+	if !IsMemoryDeviceID(deviceID) {
+		return 0, fmt.Errorf("GPU memory device ID (%s) is not valid", deviceID)
+	}
+	memRegex := regexp.MustCompile("/mem([0-9]+)$")
+	return strconv.Atoi(memRegex.FindStringSubmatch(deviceID)[1])
 }
 
 func isVirtualDeviceIDForDefaultMode(virtualDeviceID string) bool {
@@ -55,15 +55,27 @@ func TestValidateRequest(t *testing.T) {
 		sharingStrategy:   MPS,
 		deviceCount:       2,
 		wantError:         errors.New("invalid request for sharing GPU (MPS), at most 1 nvidia.com/gpu can be requested on multi-GPU nodes"),
+	}, {
+		name:              "request multiple memory units of one physical device - mps",
+		requestDevicesIDs: []string{"nvidia1/mem0", "nvidia1/mem3"},
+		sharingStrategy:   MPS,
+		deviceCount:       2,
+		wantError:         nil,
+	}, {
+		name:              "request memory units of multiple physical devices - mps",
+		requestDevicesIDs: []string{"nvidia0/mem0", "nvidia1/mem0"},
+		sharingStrategy:   MPS,
+		deviceCount:       2,
+		wantError:         errors.New("invalid request for GPU memory, all nvidia.com/gpu-memory units must be allocated from a single GPU"),
 	}}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
 			if tc.sharingStrategy != MPS {
 				tc.sharingStrategy = TimeSharing
 			}
-			SharingStrategy = tc.sharingStrategy
-			err := ValidateRequest(tc.requestDevicesIDs, tc.deviceCount)
+			err := ValidateRequest(tc.requestDevicesIDs, tc.deviceCount, tc.sharingStrategy)
 			if err != nil && tc.wantError != nil {
 				if diff := cmp.Diff(tc.wantError.Error(), err.Error()); diff != "" {
 					t.Error("unexpected error (-want, +got) = ", diff)
@@ -98,6 +110,11 @@ func TestVirtualToPhysicalDeviceID(t *testing.T) {
 		virtualDeviceID: "nvidia0/gi0/vgpu0",
 		wantDeviceID:    "nvidia0/gi0",
 		wantError:       nil,
+	}, {
+		name:            "GPU memory unit device ID",
+		virtualDeviceID: "nvidia1/mem12",
+		wantDeviceID:    "nvidia1",
+		wantError:       nil,
 	}}
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -117,3 +134,49 @@ func TestVirtualToPhysicalDeviceID(t *testing.T) {
 		})
 	}
 }
+
+func TestMemoryUnitIndex(t *testing.T) {
+	cases := []struct {
+		deviceID  string
+		wantIndex int
+		wantErr   bool
+	}{
+		{deviceID: "nvidia0/mem0", wantIndex: 0},
+		{deviceID: "nvidia2/mem15", wantIndex: 15},
+		{deviceID: "nvidia0/gi1/mem3", wantIndex: 3},
+		{deviceID: "nvidia0/vgpu1", wantErr: true},
+		{deviceID: "nvidia0", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.deviceID, func(t *testing.T) {
+			index, err := MemoryUnitIndex(tc.deviceID)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("MemoryUnitIndex(%s) error = %v, wantErr %v", tc.deviceID, err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.wantIndex, index); diff != "" {
+				t.Error("unexpected index (-want, +got) = ", diff)
+			}
+		})
+	}
+}
+
+func TestValidateMultiDeviceRequest(t *testing.T) {
+	cases := []struct {
+		name              string
+		requestDevicesIDs []string
+		wantErr           bool
+	}{
+		{name: "single virtual device", requestDevicesIDs: []string{"nvidia0/vgpu1"}},
+		{name: "distinct physical devices", requestDevicesIDs: []string{"nvidia0/vgpu1", "nvidia1/vgpu1"}},
+		{name: "distinct GPU partitions", requestDevicesIDs: []string{"nvidia0/gi1/vgpu0", "nvidia0/gi2/vgpu0"}},
+		{name: "same physical device", requestDevicesIDs: []string{"nvidia0/vgpu0", "nvidia1/vgpu0", "nvidia0/vgpu1"}, wantErr: true},
+		{name: "physical device", requestDevicesIDs: []string{"nvidia0"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := ValidateMultiDeviceRequest(tc.requestDevicesIDs); (err != nil) != tc.wantErr {
+				t.Errorf("ValidateMultiDeviceRequest(%v) error = %v, wantErr %v", tc.requestDevicesIDs, err, tc.wantErr)
+			}
+		})
+	}
+}
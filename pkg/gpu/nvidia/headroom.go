@@ -0,0 +1,170 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvidia
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/golang/glog"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// SlotHeadroomConfig advertises only the shared slots of each GPU that fit under the
+// memory and utilization headroom, measured by the metrics collectors.
+type SlotHeadroomConfig struct {
+	// MemoryHeadroomPercent is the percentage of the GPU memory kept free of shared clients.
+	MemoryHeadroomPercent int
+	// UtilizationHeadroomPercent is the percentage of the GPU utilization kept free of shared clients.
+	UtilizationHeadroomPercent int
+}
+
+func (config *SlotHeadroomConfig) validate() error {
+	if config.MemoryHeadroomPercent < 0 || config.MemoryHeadroomPercent > 99 {
+		return fmt.Errorf("invalid MemoryHeadroomPercent %d, should be between 0 and 99", config.MemoryHeadroomPercent)
+	}
+	if config.UtilizationHeadroomPercent < 0 || config.UtilizationHeadroomPercent > 99 {
+		return fmt.Errorf("invalid UtilizationHeadroomPercent %d, should be between 0 and 99", config.UtilizationHeadroomPercent)
+	}
+	return nil
+}
+
+// GPUUsage is the usage of a GPU over the last metrics collection interval.
+type GPUUsage struct {
+	UsedMemory  uint64 // in bytes
+	TotalMemory uint64 // in bytes
+	DutyCycle   uint   // in percent
+}
+
+// freeSlots returns how many more clients fit on a GPU shared by numSlots clients,
+// assuming each client uses 1/numSlots of the GPU memory and utilization.
+func (config *SlotHeadroomConfig) freeSlots(usage GPUUsage, numSlots int) int {
+	if usage.TotalMemory == 0 || numSlots <= 0 {
+		return 0
+	}
+	free := numSlots
+	memoryBudget := usage.TotalMemory * uint64(100-config.MemoryHeadroomPercent) / 100
+	if usage.UsedMemory >= memoryBudget {
+		return 0
+	}
+	if slots := int((memoryBudget - usage.UsedMemory) * uint64(numSlots) / usage.TotalMemory); slots < free {
+		free = slots
+	}
+	utilizationBudget := uint(100 - config.UtilizationHeadroomPercent)
+	if usage.DutyCycle >= utilizationBudget {
+		return 0
+	}
+	if slots := int(utilizationBudget-usage.DutyCycle) * numSlots / 100; slots < free {
+		free = slots
+	}
+	return free
+}
+
+// slotHeadroom remembers the slots advertised for the shared GPUs.
+type slotHeadroom struct {
+	config SlotHeadroomConfig
+
+	mu sync.Mutex
+	// freeSlots is the number of unallocated slots advertised for each GPU, keyed by device ID.
+	// All slots of a GPU are advertised until its usage is known.
+	freeSlots map[string]int
+	// allocated holds the IDs of the allocated slots, which are always advertised.
+	allocated map[string]bool
+}
+
+func newSlotHeadroom(config SlotHeadroomConfig) *slotHeadroom {
+	return &slotHeadroom{
+		config:    config,
+		freeSlots: make(map[string]int),
+		allocated: make(map[string]bool),
+	}
+}
+
+// limit marks the slots of a GPU exceeding its headroom unhealthy, so that the kubelet
+// stops allocating them while keeping the slots allocated to running containers.
+func (h *slotHeadroom) limit(physicalDeviceID string, slots []pluginapi.Device) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	free, ok := h.freeSlots[physicalDeviceID]
+	if !ok {
+		return
+	}
+	for i := range slots {
+		if h.allocated[slots[i].ID] || slots[i].Health != pluginapi.Healthy {
+			continue
+		}
+		if free > 0 {
+			free--
+			continue
+		}
+		slots[i].Health = pluginapi.Unhealthy
+	}
+}
+
+// UpdateSlotHeadroom updates the slots advertised for the shared GPUs from their usage, keyed by
+// device ID, and the IDs of the allocated devices. The devices are advertised again when the
+// advertised slots change.
+func (ngm *nvidiaGPUManager) UpdateSlotHeadroom(usage map[string]GPUUsage, allocated map[string]bool) {
+	h := ngm.headroom
+	if h == nil {
+		return
+	}
+	ngm.devicesMutex.Lock()
+	deviceIDs := make([]string, 0, len(ngm.devices))
+	for id := range ngm.devices {
+		deviceIDs = append(deviceIDs, id)
+	}
+	ngm.devicesMutex.Unlock()
+
+	h.mu.Lock()
+	freeSlots := make(map[string]int)
+	for _, id := range deviceIDs {
+		numSlots := ngm.sharingConfig(id).MaxSharedClientsPerGPU
+		if numSlots == 0 {
+			continue
+		}
+		u, ok := usage[id]
+		if !ok {
+			// Keep the slots advertised until the GPU usage is collected again.
+			if free, ok := h.freeSlots[id]; ok {
+				freeSlots[id] = free
+			}
+			continue
+		}
+		unallocated := numSlots
+		for i := 0; i < numSlots; i++ {
+			if allocated[fmt.Sprintf("%s/vgpu%d", id, i)] {
+				unallocated--
+			}
+		}
+		free := h.config.freeSlots(u, numSlots)
+		if free > unallocated {
+			free = unallocated
+		}
+		if previous, ok := h.freeSlots[id]; !ok || previous != free {
+			glog.Infof("Advertising %d of %d unallocated slots of GPU %s (memory used: %d/%d bytes, duty cycle: %d%%)", free, unallocated, id, u.UsedMemory, u.TotalMemory, u.DutyCycle)
+		}
+		freeSlots[id] = free
+	}
+	changed := !reflect.DeepEqual(freeSlots, h.freeSlots) || !reflect.DeepEqual(allocated, h.allocated)
+	h.freeSlots = freeSlots
+	h.allocated = allocated
+	h.mu.Unlock()
+
+	if changed {
+		ngm.notifyDeviceUpdates()
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvidia
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestFreeSlots(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   SlotHeadroomConfig
+		usage    GPUUsage
+		numSlots int
+		want     int
+	}{
+		{
+			name:     "idle GPU",
+			usage:    GPUUsage{TotalMemory: 1000},
+			numSlots: 4,
+			want:     4,
+		},
+		{
+			name:     "memory headroom",
+			config:   SlotHeadroomConfig{MemoryHeadroomPercent: 20},
+			usage:    GPUUsage{UsedMemory: 300, TotalMemory: 1000},
+			numSlots: 4,
+			want:     2,
+		},
+		{
+			name:     "utilization headroom",
+			config:   SlotHeadroomConfig{UtilizationHeadroomPercent: 10},
+			usage:    GPUUsage{UsedMemory: 100, TotalMemory: 1000, DutyCycle: 60},
+			numSlots: 4,
+			want:     1,
+		},
+		{
+			name:     "saturated memory",
+			config:   SlotHeadroomConfig{MemoryHeadroomPercent: 10},
+			usage:    GPUUsage{UsedMemory: 950, TotalMemory: 1000},
+			numSlots: 4,
+			want:     0,
+		},
+		{
+			name:     "saturated utilization",
+			usage:    GPUUsage{TotalMemory: 1000, DutyCycle: 100},
+			numSlots: 4,
+			want:     0,
+		},
+		{
+			name:     "unknown memory",
+			numSlots: 4,
+			want:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.config.freeSlots(tt.usage, tt.numSlots); got != tt.want {
+				t.Errorf("freeSlots() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateSlotHeadroom(t *testing.T) {
+	config := GPUConfig{
+		GPUSharingConfig: GPUSharingConfig{
+			GPUSharingStrategy:     "time-sharing",
+			MaxSharedClientsPerGPU: 4,
+			SlotHeadroom:           &SlotHeadroomConfig{MemoryHeadroomPercent: 20},
+		},
+	}
+	ngm := NewNvidiaGPUManager(t.TempDir(), t.TempDir(), nil, config, nil)
+	ngm.devices = map[string]pluginapi.Device{
+		"nvidia0": {ID: "nvidia0", Health: pluginapi.Healthy},
+		"nvidia1": {ID: "nvidia1", Health: pluginapi.Healthy},
+	}
+	healthyDevices := func() []string {
+		var ids []string
+		for id, d := range ngm.ListDevices() {
+			if d.Health == pluginapi.Healthy {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	sortIDs := cmp.Transformer("sort", func(ids []string) []string {
+		sorted := append([]string(nil), ids...)
+		sort.Slice(sorted, func(i, j int) bool { return lessDeviceID(sorted[i], sorted[j]) })
+		return sorted
+	})
+
+	// All slots are advertised until the usage of the GPUs is known.
+	want := []string{
+		"nvidia0/vgpu0", "nvidia0/vgpu1", "nvidia0/vgpu2", "nvidia0/vgpu3",
+		"nvidia1/vgpu0", "nvidia1/vgpu1", "nvidia1/vgpu2", "nvidia1/vgpu3",
+	}
+	if diff := cmp.Diff(want, healthyDevices(), sortIDs); diff != "" {
+		t.Errorf("unexpected healthy devices (-want, +got) = %s", diff)
+	}
+
+	updates := ngm.watchDeviceUpdates()
+	defer ngm.stopWatchingDeviceUpdates(updates)
+
+	// nvidia0 has room for one more client besides the one using vgpu2, nvidia1 is saturated.
+	usage := map[string]GPUUsage{
+		"nvidia0": {UsedMemory: 500, TotalMemory: 1000},
+		"nvidia1": {UsedMemory: 900, TotalMemory: 1000},
+	}
+	ngm.UpdateSlotHeadroom(usage, map[string]bool{"nvidia0/vgpu2": true})
+	select {
+	case <-updates:
+	default:
+		t.Fatalf("devices were not advertised again after the headroom changed")
+	}
+	want = []string{"nvidia0/vgpu0", "nvidia0/vgpu2"}
+	if diff := cmp.Diff(want, healthyDevices(), sortIDs); diff != "" {
+		t.Errorf("unexpected healthy devices (-want, +got) = %s", diff)
+	}
+	if got := len(ngm.ListDevices()); got != 8 {
+		t.Errorf("ListDevices() returned %d devices, want all 8 slots", got)
+	}
+
+	// Nothing changed, so the devices are not advertised again.
+	ngm.UpdateSlotHeadroom(usage, map[string]bool{"nvidia0/vgpu2": true})
+	select {
+	case <-updates:
+		t.Errorf("devices were advertised again without a headroom change")
+	default:
+	}
+
+	// The usage of nvidia1 drops.
+	usage["nvidia1"] = GPUUsage{UsedMemory: 0, TotalMemory: 1000}
+	ngm.UpdateSlotHeadroom(usage, map[string]bool{"nvidia0/vgpu2": true})
+	<-updates
+	want = []string{"nvidia0/vgpu0", "nvidia0/vgpu2", "nvidia1/vgpu0", "nvidia1/vgpu1", "nvidia1/vgpu2"}
+	if diff := cmp.Diff(want, healthyDevices(), sortIDs); diff != "" {
+		t.Errorf("unexpected healthy devices (-want, +got) = %s", diff)
+	}
+}
@@ -59,11 +59,13 @@ type GPUHealthChecker struct {
 	kubeClient         client.Interface
 	nodeName           string
 	recorder           record.EventRecorder
+	nvmlOps            NvmlOperations
 }
 
 // NewGPUHealthChecker returns a GPUHealthChecker object for a given device name
-func NewGPUHealthChecker(devices map[string]pluginapi.Device, health chan pluginapi.Device, codes []int, kubeClient client.Interface) *GPUHealthChecker {
+func NewGPUHealthChecker(devices map[string]pluginapi.Device, health chan pluginapi.Device, codes []int, kubeClient client.Interface, nvmlOps NvmlOperations) *GPUHealthChecker {
 	hc := &GPUHealthChecker{
+		nvmlOps:            nvmlOps,
 		devices:            make(map[string]pluginapi.Device),
 		nvmlDevices:        make(map[string]*nvml.Device),
 		health:             health,
@@ -177,15 +179,30 @@ func (hc *GPUHealthChecker) Start() error {
 		glog.Infof("Healthchecker receives device %s, device %v+", name, device)
 	}
 
+	if err := hc.registerDevices(); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := hc.listenToEvents(); err != nil {
+			glog.Errorf("GPUHealthChecker listenToEvents error: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// registerDevices finds the NVML devices of the monitored devices and registers them for XID events.
+func (hc *GPUHealthChecker) registerDevices() error {
 	// Building mapping between device ID and their nvml represetation
-	count, err := nvml.GetDeviceCount()
+	count, err := hc.nvmlOps.getDeviceCount()
 	if err != nil {
 		return fmt.Errorf("failed to get device count: %s", err)
 	}
 
 	glog.Infof("Found %d GPU devices", count)
 	for i := uint(0); i < count; i++ {
-		device, err := nvml.NewDeviceLite(i)
+		device, err := hc.nvmlOps.newDeviceLite(i)
 		if err != nil {
 			return fmt.Errorf("failed to read device with index %d: %v", i, err)
 		}
@@ -196,7 +213,7 @@ func (hc *GPUHealthChecker) Start() error {
 			continue
 		}
 
-		migEnabled, err := device.IsMigEnabled()
+		migEnabled, err := hc.nvmlOps.isMigEnabled(device)
 		if err != nil {
 			glog.Errorf("Error checking if MIG is enabled on device %s. Skipping this device. Error: %v", deviceName, err)
 			continue
@@ -212,15 +229,15 @@ func (hc *GPUHealthChecker) Start() error {
 		}
 	}
 
-	hc.eventSet = nvml.NewEventSet()
+	hc.eventSet = hc.nvmlOps.newEventSet()
 	for _, d := range hc.nvmlDevices {
-		gpu, _, _, err := nvml.ParseMigDeviceUUID(d.UUID)
+		gpu, _, _, err := hc.nvmlOps.parseMigDeviceUUID(d.UUID)
 		if err != nil {
 			gpu = d.UUID
 		}
 
 		glog.Infof("Registering device %v. UUID: %s", d.Path, d.UUID)
-		err = nvml.RegisterEventForDevice(hc.eventSet, nvml.XidCriticalError, gpu)
+		err = hc.nvmlOps.registerEventForDevice(hc.eventSet, nvml.XidCriticalError, gpu)
 		if err != nil {
 			if strings.HasSuffix(err.Error(), "Not Supported") {
 				glog.Warningf("Warning: %s is too old to support healthchecking: %v. It will always be marked healthy.", d.Path, err)
@@ -230,13 +247,6 @@ func (hc *GPUHealthChecker) Start() error {
 			}
 		}
 	}
-
-	go func() {
-		if err := hc.listenToEvents(); err != nil {
-			glog.Errorf("GPUHealthChecker listenToEvents error: %v", err)
-		}
-	}()
-
 	return nil
 }
 
@@ -253,13 +263,13 @@ func (hc *GPUHealthChecker) addDevice(deviceName string, device *nvml.Device) {
 func (hc *GPUHealthChecker) addMigEnabledDevice(deviceName string, device *nvml.Device) error {
 	glog.Infof("HealthChecker detects MIG is enabled on device %s", deviceName)
 
-	migs, err := device.GetMigDevices()
+	migs, err := hc.nvmlOps.getMigDevices(device)
 	if err != nil {
 		return fmt.Errorf("error getting MIG devices on device %s. err: %v.", deviceName, err)
 	}
 
 	for _, mig := range migs {
-		gpu, gi, _, err := nvml.ParseMigDeviceUUID(mig.UUID)
+		gpu, gi, _, err := hc.nvmlOps.parseMigDeviceUUID(mig.UUID)
 		if err != nil {
 			return fmt.Errorf("error parsing MIG UUID on device %s, MIG UUID: %s, error %v", gpu, mig.UUID, err)
 		}
@@ -279,12 +289,60 @@ func (hc *GPUHealthChecker) addMigEnabledDevice(deviceName string, device *nvml.
 type callDevice interface {
 	parseMigDeviceUUID(UUID string) (string, uint, uint, error)
 }
+
+// NvmlOperations are the NVML calls made by the health checker. GPUDevice
+// calls the NVML library, and tests fake it.
+type NvmlOperations interface {
+	callDevice
+	getDeviceCount() (uint, error)
+	newDeviceLite(idx uint) (*nvml.Device, error)
+	isMigEnabled(device *nvml.Device) (bool, error)
+	getMigDevices(device *nvml.Device) ([]*nvml.Device, error)
+	newEventSet() nvml.EventSet
+	registerEventForDevice(es nvml.EventSet, event int, uuid string) error
+	waitForEvent(es nvml.EventSet, timeout uint) (nvml.Event, error)
+	deleteEventSet(es nvml.EventSet)
+}
+
+// GPUDevice calls the NVML library.
 type GPUDevice struct{}
 
 func (gd *GPUDevice) parseMigDeviceUUID(UUID string) (string, uint, uint, error) {
 	return nvml.ParseMigDeviceUUID(UUID)
 }
 
+func (gd *GPUDevice) getDeviceCount() (uint, error) {
+	return nvml.GetDeviceCount()
+}
+
+func (gd *GPUDevice) newDeviceLite(idx uint) (*nvml.Device, error) {
+	return nvml.NewDeviceLite(idx)
+}
+
+func (gd *GPUDevice) isMigEnabled(device *nvml.Device) (bool, error) {
+	return device.IsMigEnabled()
+}
+
+func (gd *GPUDevice) getMigDevices(device *nvml.Device) ([]*nvml.Device, error) {
+	return device.GetMigDevices()
+}
+
+func (gd *GPUDevice) newEventSet() nvml.EventSet {
+	return nvml.NewEventSet()
+}
+
+func (gd *GPUDevice) registerEventForDevice(es nvml.EventSet, event int, uuid string) error {
+	return nvml.RegisterEventForDevice(es, event, uuid)
+}
+
+func (gd *GPUDevice) waitForEvent(es nvml.EventSet, timeout uint) (nvml.Event, error) {
+	return nvml.WaitForEvent(es, timeout)
+}
+
+func (gd *GPUDevice) deleteEventSet(es nvml.EventSet) {
+	nvml.DeleteEventSet(es)
+}
+
 func (hc *GPUHealthChecker) monitorXidevent(e nvml.Event) {
 	if _, ok := hc.monitorCriticalXid[e.Edata]; ok {
 		glog.Info("Monitoring XID event")
@@ -458,19 +516,18 @@ func (hc *GPUHealthChecker) listenToEvents() error {
 		default:
 		}
 
-		e, err := nvml.WaitForEvent(hc.eventSet, 5000)
+		e, err := hc.nvmlOps.waitForEvent(hc.eventSet, 5000)
 		if err != nil {
 			continue
 		}
-		gd := GPUDevice{}
-		hc.catchError(e, &gd)
+		hc.catchError(e, hc.nvmlOps)
 	}
 }
 
 // Stop deletes the NVML events and stops the listening go routine
 func (hc *GPUHealthChecker) Stop() {
 	hc.recorder.(record.EventBroadcaster).Shutdown()
-	nvml.DeleteEventSet(hc.eventSet)
+	hc.nvmlOps.deleteEventSet(hc.eventSet)
 	hc.stop <- true
 	<-hc.stop
 }
@@ -17,7 +17,9 @@ package healthcheck
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -41,6 +43,85 @@ func (gp *mockGPUDevice) parseMigDeviceUUID(UUID string) (string, uint, uint, er
 	return UUID, 3173334309191009974, 1015241, nil
 }
 
+// fakeNVML serves a fixed set of GPUs, MIG partitions of GPUs are keyed by the GPU UUID.
+type fakeNVML struct {
+	gpus       []*nvml.Device
+	migs       map[string][]*nvml.Device
+	registered []string
+}
+
+// parseMigDeviceUUID parses MIG UUIDs of the form MIG-<GPU UUID>/<GI>/<CI>.
+func (f *fakeNVML) parseMigDeviceUUID(UUID string) (string, uint, uint, error) {
+	var gpu string
+	var gi, ci uint
+	if _, err := fmt.Sscanf(strings.ReplaceAll(strings.TrimPrefix(UUID, "MIG-"), "/", " "), "%s %d %d", &gpu, &gi, &ci); err != nil {
+		return "", 0, 0, fmt.Errorf("invalid MIG UUID %s", UUID)
+	}
+	return gpu, gi, ci, nil
+}
+
+func (f *fakeNVML) getDeviceCount() (uint, error) {
+	return uint(len(f.gpus)), nil
+}
+
+func (f *fakeNVML) newDeviceLite(idx uint) (*nvml.Device, error) {
+	return f.gpus[idx], nil
+}
+
+func (f *fakeNVML) isMigEnabled(device *nvml.Device) (bool, error) {
+	return len(f.migs[device.UUID]) > 0, nil
+}
+
+func (f *fakeNVML) getMigDevices(device *nvml.Device) ([]*nvml.Device, error) {
+	return f.migs[device.UUID], nil
+}
+
+func (f *fakeNVML) newEventSet() nvml.EventSet {
+	return nvml.EventSet{}
+}
+
+func (f *fakeNVML) registerEventForDevice(es nvml.EventSet, event int, uuid string) error {
+	f.registered = append(f.registered, uuid)
+	return nil
+}
+
+func (f *fakeNVML) waitForEvent(es nvml.EventSet, timeout uint) (nvml.Event, error) {
+	return nvml.Event{}, errors.New("no event")
+}
+
+func (f *fakeNVML) deleteEventSet(es nvml.EventSet) {}
+
+func TestRegisterDevices(t *testing.T) {
+	t.Parallel()
+	fake := &fakeNVML{
+		gpus: []*nvml.Device{
+			{UUID: "GPU-0", Path: "/dev/nvidia0"},
+			{UUID: "GPU-1", Path: "/dev/nvidia1"},
+			{UUID: "GPU-2", Path: "/dev/nvidia2"},
+		},
+		migs: map[string][]*nvml.Device{
+			"GPU-1": {{UUID: "MIG-GPU-1/1/0", Path: "/dev/nvidia1"}, {UUID: "MIG-GPU-1/2/0", Path: "/dev/nvidia1"}},
+		},
+	}
+	hc := &GPUHealthChecker{
+		devices: map[string]pluginapi.Device{
+			"nvidia0":     {ID: "nvidia0"},
+			"nvidia1/gi1": {ID: "nvidia1/gi1"},
+		},
+		nvmlDevices: make(map[string]*nvml.Device),
+		nvmlOps:     fake,
+	}
+	if err := hc.registerDevices(); err != nil {
+		t.Fatalf("registerDevices() failed: %v", err)
+	}
+	if len(hc.nvmlDevices) != 2 || hc.nvmlDevices["nvidia0"] != fake.gpus[0] || hc.nvmlDevices["nvidia1/gi1"] != fake.migs["GPU-1"][0] {
+		t.Errorf("unexpected monitored devices: %v", hc.nvmlDevices)
+	}
+	if !reflect.DeepEqual(fake.registered, []string{"GPU-0", "GPU-1"}) && !reflect.DeepEqual(fake.registered, []string{"GPU-1", "GPU-0"}) {
+		t.Errorf("registered %v for XID events, want GPU-0 and GPU-1", fake.registered)
+	}
+}
+
 func TestCatchError(t *testing.T) {
 	gp := mockGPUDevice{}
 	device1 := pluginapi.Device{
@@ -280,7 +361,7 @@ func TestUpdateLastHeartbeatTime(t *testing.T) {
 	})
 	fakeClient := fake.NewSimpleClientset(&v1.NodeList{Items: []v1.Node{node}})
 
-	hc := NewGPUHealthChecker(nil, nil, nil, fakeClient)
+	hc := NewGPUHealthChecker(nil, nil, nil, fakeClient, &GPUDevice{})
 	hc.nodeName = "test-node"
 
 	time.Sleep(2 * time.Second)
@@ -321,7 +402,7 @@ func TestResetXIDConditionWithBackoff(t *testing.T) {
 		return false, nil, nil
 	})
 
-	hc := NewGPUHealthChecker(nil, nil, nil, fakeClient)
+	hc := NewGPUHealthChecker(nil, nil, nil, fakeClient, &GPUDevice{})
 	hc.nodeName = "test-node"
 
 	startTime := time.Now()
@@ -432,7 +513,7 @@ func TestMonitorXidevent(t *testing.T) {
 		node.Status.NodeInfo.BootID = "123456"
 		fakeClient := fake.NewSimpleClientset(&v1.NodeList{Items: []v1.Node{node}})
 
-		hc := NewGPUHealthChecker(nil, nil, nil, fakeClient)
+		hc := NewGPUHealthChecker(nil, nil, nil, fakeClient, &GPUDevice{})
 		hc.nodeName = "test-node"
 
 		for _, event := range test.events {
@@ -24,6 +24,7 @@ import (
 	"os/exec"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,6 +36,7 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/golang/glog"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
 
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 
@@ -61,11 +63,14 @@ const (
 	mpsActiveThreadCmd = "get_default_active_thread_percentage"
 	mpsMemLimitEnv     = "CUDA_MPS_PINNED_DEVICE_MEM_LIMIT"
 	mpsThreadLimitEnv  = "CUDA_MPS_ACTIVE_THREAD_PERCENTAGE"
+	cudaDeviceOrderEnv = "CUDA_DEVICE_ORDER"
 )
 
 var (
-	resourceName   = "nvidia.com/gpu"
-	pciDevicesRoot = "/sys/bus/pci/devices"
+	resourceName       = "nvidia.com/gpu"
+	memoryResourceName = "nvidia.com/gpu-memory"
+	sharedResourceName = "nvidia.com/gpu-shared"
+	pciDevicesRoot     = "/sys/bus/pci/devices"
 )
 
 // GPUConfig stores the settings used to configure the GPUs on a node.
@@ -80,6 +85,19 @@ type GPUConfig struct {
 	HealthCriticalXid []int
 	// GPUFractionDivisor is the fraction divisor for vGPU machine shapes
 	GPUFractionDivisor int
+	// GPUSharingPolicies override GPUSharingConfig for individual GPUs. When set, exclusive GPUs
+	// are advertised as nvidia.com/gpu and shared GPUs as nvidia.com/gpu-shared.
+	GPUSharingPolicies []GPUSharingPolicy
+}
+
+// GPUSharingPolicy sets how a subset of the GPUs on a node are shared.
+type GPUSharingPolicy struct {
+	// GPUs selects GPUs by index, i.e. N of /dev/nvidiaN, or by UUID.
+	GPUs []string
+	// GPUSharingStrategy is "time-sharing" or "mps", or empty to allocate the GPUs exclusively.
+	GPUSharingStrategy gpusharing.GPUSharingStrategy
+	// MaxSharedClientsPerGPU is the maximum number of clients that are allowed to share each of the GPUs.
+	MaxSharedClientsPerGPU int
 }
 
 type GPUSharingConfig struct {
@@ -87,6 +105,23 @@ type GPUSharingConfig struct {
 	GPUSharingStrategy gpusharing.GPUSharingStrategy
 	// MaxSharedClientsPerGPU is the maximum number of clients that are allowed to share a single GPU.
 	MaxSharedClientsPerGPU int
+	// GPUMemoryUnitMB is the size in MiB of one nvidia.com/gpu-memory unit. When set with the "mps" strategy,
+	// each GPU is advertised as memory units instead of MaxSharedClientsPerGPU identical slots.
+	GPUMemoryUnitMB int
+	// ManageMPSControlDaemon makes the device plugin start and supervise one MPS control daemon
+	// per GPU or GPU partition, instead of relying on an externally started daemon.
+	ManageMPSControlDaemon bool
+	// TimesliceClass is the timeslice applied to time-shared GPUs: short, medium, long or custom.
+	// The driver default is kept when empty.
+	TimesliceClass TimesliceClass
+	// CustomTimeslice is the timeslice value applied when TimesliceClass is custom.
+	CustomTimeslice int
+	// AllowMultiGPURequests allows a container to request multiple shared GPUs, each of which
+	// is allocated on a distinct physical GPU.
+	AllowMultiGPURequests bool
+	// SlotHeadroom, when set, advertises only the shared slots of each GPU that fit under its
+	// memory and utilization headroom, instead of all MaxSharedClientsPerGPU slots.
+	SlotHeadroom *SlotHeadroomConfig
 }
 
 func (config *GPUConfig) AddDefaultsAndValidate() error {
@@ -100,22 +135,153 @@ func (config *GPUConfig) AddDefaultsAndValidate() error {
 	} else {
 		switch config.GPUSharingConfig.GPUSharingStrategy {
 		case gpusharing.TimeSharing, gpusharing.MPS:
+			if config.GPUSharingConfig.ManageMPSControlDaemon && config.GPUSharingConfig.GPUSharingStrategy != gpusharing.MPS {
+				return fmt.Errorf("ManageMPSControlDaemon is only supported with the mps GPU sharing strategy")
+			}
+			if config.GPUSharingConfig.GPUSharingStrategy == gpusharing.MPS && config.GPUPartitionSize != "" && !config.GPUSharingConfig.ManageMPSControlDaemon {
+				// Each GPU partition needs its own control daemon, which clients can only find through the device plugin.
+				return fmt.Errorf("ManageMPSControlDaemon is required to use the mps GPU sharing strategy with GPU partitions")
+			}
+			if config.GPUSharingConfig.GPUMemoryUnitMB > 0 {
+				if config.GPUSharingConfig.GPUSharingStrategy != gpusharing.MPS {
+					return fmt.Errorf("GPUMemoryUnitMB is only supported with the mps GPU sharing strategy")
+				}
+				break
+			}
 			if config.GPUSharingConfig.MaxSharedClientsPerGPU <= 0 {
 				return fmt.Errorf("MaxSharedClientsPerGPU should be > 0 for time-sharing or mps GPU sharing strategies")
 			}
 			break
 		case gpusharing.Undefined:
-			if config.GPUSharingConfig.MaxSharedClientsPerGPU > 0 {
-				return fmt.Errorf("GPU sharing strategy needs to be specified when MaxSharedClientsPerGPU > 0")
+			if config.GPUSharingConfig.MaxSharedClientsPerGPU > 0 || config.GPUSharingConfig.GPUMemoryUnitMB > 0 {
+				return fmt.Errorf("GPU sharing strategy needs to be specified when MaxSharedClientsPerGPU > 0 or GPUMemoryUnitMB > 0")
 			}
 		default:
 			return fmt.Errorf("invalid GPU Sharing strategy: %v, should be one of time-sharing or mps", config.GPUSharingConfig.GPUSharingStrategy)
 		}
 	}
-	gpusharing.SharingStrategy = config.GPUSharingConfig.GPUSharingStrategy
+	if config.GPUSharingConfig.AllowMultiGPURequests {
+		switch {
+		case config.GPUSharingConfig.MaxSharedClientsPerGPU <= 0:
+			return fmt.Errorf("AllowMultiGPURequests is only supported with MaxSharedClientsPerGPU > 0")
+		case config.GPUSharingConfig.GPUMemoryUnitMB > 0:
+			return fmt.Errorf("AllowMultiGPURequests is not supported with GPUMemoryUnitMB")
+		case config.GPUSharingConfig.ManageMPSControlDaemon:
+			// An MPS client can only connect to the control daemon of a single GPU.
+			return fmt.Errorf("AllowMultiGPURequests is not supported with ManageMPSControlDaemon")
+		}
+	}
+	if err := config.validateGPUSharingPolicies(); err != nil {
+		return err
+	}
+	if headroom := config.GPUSharingConfig.SlotHeadroom; headroom != nil {
+		switch {
+		case config.sharedStrategy() == gpusharing.Undefined:
+			return fmt.Errorf("SlotHeadroom is only supported with the time-sharing or mps GPU sharing strategies")
+		case config.GPUSharingConfig.GPUMemoryUnitMB > 0:
+			return fmt.Errorf("SlotHeadroom is not supported with GPUMemoryUnitMB")
+		case config.GPUPartitionSize != "":
+			// The metrics collectors only measure the usage of whole GPUs.
+			return fmt.Errorf("SlotHeadroom is not supported with GPU partitions")
+		}
+		if err := headroom.validate(); err != nil {
+			return err
+		}
+	}
+	if config.GPUSharingConfig.TimesliceClass != TimesliceDefault {
+		if !config.UsesSharingStrategy(gpusharing.TimeSharing) {
+			return fmt.Errorf("TimesliceClass is only supported with the time-sharing GPU sharing strategy")
+		}
+		if _, err := timesliceValue(config.GPUSharingConfig.TimesliceClass, config.GPUSharingConfig.CustomTimeslice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateGPUSharingPolicies checks that the GPU sharing policies select distinct GPUs,
+// and that all shared GPUs on the node use the same GPU sharing strategy.
+func (config *GPUConfig) validateGPUSharingPolicies() error {
+	if len(config.GPUSharingPolicies) == 0 {
+		return nil
+	}
+	switch {
+	case config.GPUPartitionSize != "":
+		return fmt.Errorf("GPUSharingPolicies are not supported with GPU partitions")
+	case config.GPUSharingConfig.GPUMemoryUnitMB > 0:
+		return fmt.Errorf("GPUSharingPolicies are not supported with GPUMemoryUnitMB")
+	case config.GPUSharingConfig.ManageMPSControlDaemon:
+		return fmt.Errorf("GPUSharingPolicies are not supported with ManageMPSControlDaemon")
+	case config.GPUSharingConfig.AllowMultiGPURequests:
+		return fmt.Errorf("GPUSharingPolicies are not supported with AllowMultiGPURequests")
+	}
+
+	sharedStrategy := config.GPUSharingConfig.GPUSharingStrategy
+	selected := make(map[string]bool)
+	for _, policy := range config.GPUSharingPolicies {
+		if len(policy.GPUs) == 0 {
+			return fmt.Errorf("GPU sharing policy should select at least one GPU")
+		}
+		for _, gpu := range policy.GPUs {
+			if _, err := strconv.Atoi(gpu); err != nil && !strings.HasPrefix(gpu, "GPU-") {
+				return fmt.Errorf("invalid GPU %q in GPU sharing policy, should be a GPU index or UUID", gpu)
+			}
+			if selected[gpu] {
+				return fmt.Errorf("GPU %s is selected by multiple GPU sharing policies", gpu)
+			}
+			selected[gpu] = true
+		}
+		switch policy.GPUSharingStrategy {
+		case gpusharing.TimeSharing, gpusharing.MPS:
+			if policy.MaxSharedClientsPerGPU <= 0 {
+				return fmt.Errorf("MaxSharedClientsPerGPU should be > 0 in the GPU sharing policy of GPUs %v", policy.GPUs)
+			}
+			if sharedStrategy == gpusharing.Undefined {
+				sharedStrategy = policy.GPUSharingStrategy
+			} else if sharedStrategy != policy.GPUSharingStrategy {
+				return fmt.Errorf("all shared GPUs on a node should use the same GPU sharing strategy, got %v and %v", sharedStrategy, policy.GPUSharingStrategy)
+			}
+		case gpusharing.Undefined:
+			if policy.MaxSharedClientsPerGPU > 0 {
+				return fmt.Errorf("GPU sharing strategy needs to be specified when MaxSharedClientsPerGPU > 0 in the GPU sharing policy of GPUs %v", policy.GPUs)
+			}
+		default:
+			return fmt.Errorf("invalid GPU Sharing strategy: %v in the GPU sharing policy of GPUs %v, should be one of time-sharing or mps", policy.GPUSharingStrategy, policy.GPUs)
+		}
+	}
 	return nil
 }
 
+// sharedStrategy returns the GPU sharing strategy used by the shared GPUs on the node.
+func (config *GPUConfig) sharedStrategy() gpusharing.GPUSharingStrategy {
+	if config.GPUSharingConfig.GPUSharingStrategy != gpusharing.Undefined {
+		return config.GPUSharingConfig.GPUSharingStrategy
+	}
+	for _, policy := range config.GPUSharingPolicies {
+		if policy.GPUSharingStrategy != gpusharing.Undefined {
+			return policy.GPUSharingStrategy
+		}
+	}
+	return gpusharing.Undefined
+}
+
+// UsesSharingStrategy returns true if GPUs on the node are shared with the given GPU sharing strategy.
+func (config *GPUConfig) UsesSharingStrategy(strategy gpusharing.GPUSharingStrategy) bool {
+	return strategy != gpusharing.Undefined && config.sharedStrategy() == strategy
+}
+
+// sharingPolicy returns the GPU sharing policy selecting the GPU with the given index or UUID.
+func (config *GPUConfig) sharingPolicy(index int, uuid string) (GPUSharingPolicy, bool) {
+	for _, policy := range config.GPUSharingPolicies {
+		for _, gpu := range policy.GPUs {
+			if gpu == strconv.Itoa(index) || gpu == uuid {
+				return policy, true
+			}
+		}
+	}
+	return GPUSharingPolicy{}, false
+}
+
 func (config *GPUConfig) AddHealthCriticalXid() error {
 	xidConfig := os.Getenv("XID_CONFIG")
 	if len(xidConfig) == 0 {
@@ -144,19 +310,36 @@ type nvidiaGPUManager struct {
 	mountPaths          []pluginapi.Mount
 	defaultDevices      []string
 	devices             map[string]pluginapi.Device
-	grpcServer          *grpc.Server
-	socket              string
+	grpcServers         []*grpc.Server
+	sockets             []string
 	stop                chan bool
 	devicesMutex        sync.Mutex
 	nvidiaCtlDevicePath string
 	nvidiaUVMDevicePath string
 	gpuConfig           GPUConfig
 	migDeviceManager    mig.DeviceManager
+	nvmlOps             nvmlutil.NvmlOperations
 	Health              chan pluginapi.Device
-	totalMemPerGPU      uint64 // Total memory available per GPU (in MB)
+	totalMemPerGPU      uint64            // Total memory available per GPU (in bytes)
+	partitionMemory     map[string]uint64 // Total memory available per GPU partition (in bytes)
+	mpsDaemons          *mpsDaemonManager
+	timeslices          *timesliceManager
+	headroom            *slotHeadroom
+	// mpsUnhealthy holds the GPUs and GPU partitions whose MPS control daemon is down. It is kept apart
+	// from the device health reported by the XID health checker, and guarded by devicesMutex.
+	mpsUnhealthy map[string]bool
+	// sharingPolicies holds the GPU sharing policy of each GPU selected by one, keyed by device ID.
+	sharingPolicies map[string]GPUSharingPolicy
+
+	deviceUpdatesMutex sync.Mutex
+	deviceUpdates      map[chan struct{}]bool
 }
 
-func NewNvidiaGPUManager(devDirectory, procDirectory string, mountPaths []pluginapi.Mount, gpuConfig GPUConfig) *nvidiaGPUManager {
+func NewNvidiaGPUManager(devDirectory, procDirectory string, mountPaths []pluginapi.Mount, gpuConfig GPUConfig, nvmlOps nvmlutil.NvmlOperations) *nvidiaGPUManager {
+	var headroom *slotHeadroom
+	if gpuConfig.GPUSharingConfig.SlotHeadroom != nil {
+		headroom = newSlotHeadroom(*gpuConfig.GPUSharingConfig.SlotHeadroom)
+	}
 	return &nvidiaGPUManager{
 
 		devDirectory:        devDirectory,
@@ -166,11 +349,92 @@ func NewNvidiaGPUManager(devDirectory, procDirectory string, mountPaths []plugin
 		nvidiaCtlDevicePath: path.Join(devDirectory, nvidiaCtlDevice),
 		nvidiaUVMDevicePath: path.Join(devDirectory, nvidiaUVMDevice),
 		gpuConfig:           gpuConfig,
-		migDeviceManager:    mig.NewDeviceManager(devDirectory, procDirectory),
+		migDeviceManager:    mig.NewDeviceManager(devDirectory, procDirectory, nvmlOps),
+		nvmlOps:             nvmlOps,
 		Health:              make(chan pluginapi.Device),
+		timeslices:          newTimesliceManager(nvmlOps),
+		headroom:            headroom,
+		sharingPolicies:     make(map[string]GPUSharingPolicy),
 	}
 }
 
+// watchDeviceUpdates returns a channel notified whenever the health or the advertised slots of a device change.
+func (ngm *nvidiaGPUManager) watchDeviceUpdates() chan struct{} {
+	ngm.deviceUpdatesMutex.Lock()
+	defer ngm.deviceUpdatesMutex.Unlock()
+	if ngm.deviceUpdates == nil {
+		ngm.deviceUpdates = make(map[chan struct{}]bool)
+	}
+	updates := make(chan struct{}, 1)
+	ngm.deviceUpdates[updates] = true
+	return updates
+}
+
+func (ngm *nvidiaGPUManager) stopWatchingDeviceUpdates(updates chan struct{}) {
+	ngm.deviceUpdatesMutex.Lock()
+	defer ngm.deviceUpdatesMutex.Unlock()
+	delete(ngm.deviceUpdates, updates)
+}
+
+// notifyDeviceUpdates notifies the watchers of a device health change, so that every
+// resource served by the device plugin sends its devices again.
+func (ngm *nvidiaGPUManager) notifyDeviceUpdates() {
+	ngm.deviceUpdatesMutex.Lock()
+	defer ngm.deviceUpdatesMutex.Unlock()
+	for updates := range ngm.deviceUpdates {
+		select {
+		case updates <- struct{}{}:
+		default:
+			// An update is already pending.
+		}
+	}
+}
+
+// sharingConfig returns the GPU sharing config of a GPU or GPU partition, with its GPU sharing policy applied.
+func (ngm *nvidiaGPUManager) sharingConfig(physicalDeviceID string) GPUSharingConfig {
+	config := ngm.gpuConfig.GPUSharingConfig
+	ngm.devicesMutex.Lock()
+	policy, ok := ngm.sharingPolicies[physicalDeviceID]
+	ngm.devicesMutex.Unlock()
+	if ok {
+		config.GPUSharingStrategy = policy.GPUSharingStrategy
+		config.MaxSharedClientsPerGPU = policy.MaxSharedClientsPerGPU
+	}
+	return config
+}
+
+// EnableTimesliceAnnotations publishes the timeslice applied to time-shared GPUs as annotations of the node.
+func (ngm *nvidiaGPUManager) EnableTimesliceAnnotations(kubeClient kubernetes.Interface, nodeName string) {
+	ngm.timeslices.kubeClient = kubeClient
+	ngm.timeslices.nodeName = nodeName
+}
+
+// UpdateTimeslice applies the timeslice of a new GPU sharing config to the time-shared GPUs. The GPU config
+// itself is left unchanged, the timeslice applied being kept by the timeslice manager.
+func (ngm *nvidiaGPUManager) UpdateTimeslice(config GPUSharingConfig) error {
+	if !ngm.gpuConfig.UsesSharingStrategy(gpusharing.TimeSharing) {
+		return fmt.Errorf("timeslice can only be updated with the time-sharing GPU sharing strategy")
+	}
+	return ngm.applyTimeslice(config.TimesliceClass, config.CustomTimeslice)
+}
+
+// applyTimeslice applies a timeslice to all time-shared physical GPUs, including the ones partitioned with MIG.
+func (ngm *nvidiaGPUManager) applyTimeslice(class TimesliceClass, custom int) error {
+	ngm.devicesMutex.Lock()
+	allDeviceIDs := make([]string, 0, len(ngm.devices))
+	for id := range ngm.devices {
+		allDeviceIDs = append(allDeviceIDs, id)
+	}
+	ngm.devicesMutex.Unlock()
+	deviceIDs := make([]string, 0, len(allDeviceIDs))
+	for _, id := range allDeviceIDs {
+		if ngm.sharingConfig(id).GPUSharingStrategy == gpusharing.TimeSharing {
+			deviceIDs = append(deviceIDs, id)
+		}
+	}
+	return ngm.timeslices.apply(deviceIDs, class, custom)
+}
+
 // ListPhysicalDevices lists all physical GPU devices (including partitions) available on this node.
 func (ngm *nvidiaGPUManager) ListPhysicalDevices() map[string]pluginapi.Device {
 	if ngm.gpuConfig.GPUPartitionSize == "" {
@@ -183,18 +447,123 @@ func (ngm *nvidiaGPUManager) ListHealthCriticalXid() []int {
 	return ngm.gpuConfig.HealthCriticalXid
 }
 
+// ResourceName returns the extended resource name the devices are advertised as.
+func (ngm *nvidiaGPUManager) ResourceName() string {
+	if ngm.gpuConfig.GPUSharingConfig.GPUMemoryUnitMB > 0 {
+		return memoryResourceName
+	}
+	return resourceName
+}
+
+// ResourceNames returns all extended resource names the devices are advertised as.
+func (ngm *nvidiaGPUManager) ResourceNames() []string {
+	if len(ngm.gpuConfig.GPUSharingPolicies) == 0 {
+		return []string{ngm.ResourceName()}
+	}
+	return []string{resourceName, sharedResourceName}
+}
+
+// deviceResourceName returns the extended resource name a device is advertised as.
+func (ngm *nvidiaGPUManager) deviceResourceName(deviceID string) string {
+	if len(ngm.gpuConfig.GPUSharingPolicies) == 0 {
+		return ngm.ResourceName()
+	}
+	if gpusharing.IsVirtualDeviceID(deviceID) {
+		return sharedResourceName
+	}
+	return resourceName
+}
+
+// deviceMemory returns the total memory (in bytes) of a GPU or GPU partition.
+func (ngm *nvidiaGPUManager) deviceMemory(physicalDeviceID string) uint64 {
+	if memory, ok := ngm.partitionMemory[physicalDeviceID]; ok {
+		return memory
+	}
+	return ngm.totalMemPerGPU
+}
+
+// memoryUnits returns the number of nvidia.com/gpu-memory units advertised for a GPU or GPU partition.
+// Units are rounded down so that the memory of all units on a device never exceeds its physical memory.
+func (ngm *nvidiaGPUManager) memoryUnits(physicalDeviceID string) int {
+	return int(ngm.deviceMemory(physicalDeviceID) / (uint64(ngm.gpuConfig.GPUSharingConfig.GPUMemoryUnitMB) * 1024 * 1024))
+}
+
+// setMPSHealth records whether the MPS control daemon of a GPU or GPU partition is healthy, and sends the
+// devices again.
+func (ngm *nvidiaGPUManager) setMPSHealth(physicalDeviceID string, healthy bool) {
+	ngm.devicesMutex.Lock()
+	if healthy {
+		delete(ngm.mpsUnhealthy, physicalDeviceID)
+	} else {
+		if ngm.mpsUnhealthy == nil {
+			ngm.mpsUnhealthy = make(map[string]bool)
+		}
+		ngm.mpsUnhealthy[physicalDeviceID] = true
+	}
+	ngm.devicesMutex.Unlock()
+	ngm.notifyDeviceUpdates()
+}
+
+// mpsHealthy returns false if the MPS control daemon of a GPU or GPU partition is down.
+func (ngm *nvidiaGPUManager) mpsHealthy(physicalDeviceID string) bool {
+	ngm.devicesMutex.Lock()
+	defer ngm.devicesMutex.Unlock()
+	return !ngm.mpsUnhealthy[physicalDeviceID]
+}
+
+// physicalDevicesWithMPSHealth returns the physical devices, the ones whose MPS control daemon is down
+// being unhealthy whatever their own health.
+func (ngm *nvidiaGPUManager) physicalDevicesWithMPSHealth() map[string]pluginapi.Device {
+	devices := ngm.ListPhysicalDevices()
+	ngm.devicesMutex.Lock()
+	defer ngm.devicesMutex.Unlock()
+	if len(ngm.mpsUnhealthy) == 0 {
+		return devices
+	}
+	combined := make(map[string]pluginapi.Device, len(devices))
+	for id, device := range devices {
+		if ngm.mpsUnhealthy[id] {
+			device.Health = pluginapi.Unhealthy
+		}
+		combined[id] = device
+	}
+	return combined
+}
+
 // ListDevices lists all GPU devices available on this node.
 func (ngm *nvidiaGPUManager) ListDevices() map[string]pluginapi.Device {
-	physicalGPUDevices := ngm.ListPhysicalDevices()
+	physicalGPUDevices := ngm.physicalDevicesWithMPSHealth()
 
 	switch {
-	case ngm.gpuConfig.GPUSharingConfig.MaxSharedClientsPerGPU > 0:
+	case ngm.gpuConfig.GPUSharingConfig.GPUMemoryUnitMB > 0:
+		memoryDevices := map[string]pluginapi.Device{}
+		for _, device := range physicalGPUDevices {
+			for i := 0; i < ngm.memoryUnits(device.ID); i++ {
+				memoryDeviceID := fmt.Sprintf("%s/mem%d", device.ID, i)
+				memoryDevices[memoryDeviceID] = pluginapi.Device{ID: memoryDeviceID, Health: device.Health, Topology: device.Topology}
+			}
+		}
+		return memoryDevices
+	case ngm.gpuConfig.GPUSharingConfig.MaxSharedClientsPerGPU > 0 || len(ngm.gpuConfig.GPUSharingPolicies) > 0:
 		virtualGPUDevices := map[string]pluginapi.Device{}
 		for _, device := range physicalGPUDevices {
-			for i := 0; i < ngm.gpuConfig.GPUSharingConfig.MaxSharedClientsPerGPU; i++ {
+			maxSharedClients := ngm.sharingConfig(device.ID).MaxSharedClientsPerGPU
+			if maxSharedClients == 0 {
+				// GPUs which are not shared by their GPU sharing policy are allocated exclusively.
+				virtualGPUDevices[device.ID] = device
+				continue
+			}
+			slots := make([]pluginapi.Device, maxSharedClients)
+			for i := range slots {
 				virtualDeviceID := fmt.Sprintf("%s/vgpu%d", device.ID, i)
 				// When sharing GPUs, the virtual GPU device will inherit the health status from its underlying physical GPU device.
-				virtualGPUDevices[virtualDeviceID] = pluginapi.Device{ID: virtualDeviceID, Health: device.Health, Topology: device.Topology}
+				slots[i] = pluginapi.Device{ID: virtualDeviceID, Health: device.Health, Topology: device.Topology}
+			}
+			if ngm.headroom != nil {
+				ngm.headroom.limit(device.ID, slots)
+			}
+			for _, slot := range slots {
+				virtualGPUDevices[slot.ID] = slot
 			}
 		}
 		return virtualGPUDevices
@@ -208,13 +577,20 @@ func (ngm *nvidiaGPUManager) DeviceSpec(deviceID string) ([]pluginapi.DeviceSpec
 	deviceSpecs := make([]pluginapi.DeviceSpec, 0)
 	// With GPU sharing, the input deviceID will be a virtual Device ID.
 	// We need to map it to the corresponding physical device ID.
-	if ngm.gpuConfig.GPUSharingConfig.MaxSharedClientsPerGPU > 0 {
+	physicalDeviceID := deviceID
+	if gpusharing.IsVirtualDeviceID(deviceID) {
+		physicalDeviceID, _ = gpusharing.VirtualToPhysicalDeviceID(deviceID)
+	}
+	if config := ngm.sharingConfig(physicalDeviceID); config.MaxSharedClientsPerGPU > 0 || config.GPUMemoryUnitMB > 0 {
 		physicalDeviceID, err := gpusharing.VirtualToPhysicalDeviceID(deviceID)
 		if err != nil {
 			return nil, err
 		}
 		deviceID = physicalDeviceID
 	}
+	if !ngm.mpsHealthy(deviceID) {
+		return deviceSpecs, fmt.Errorf("invalid allocation request with device %s, whose MPS control daemon is down", deviceID)
+	}
 	if ngm.gpuConfig.GPUPartitionSize == "" {
 		dev, ok := ngm.devices[deviceID]
 		if !ok {
@@ -235,22 +611,18 @@ func (ngm *nvidiaGPUManager) DeviceSpec(deviceID string) ([]pluginapi.DeviceSpec
 
 // Discovers all NVIDIA GPU devices available on the local node by walking nvidiaGPUManager's devDirectory.
 func (ngm *nvidiaGPUManager) discoverGPUs() error {
-	if nvmlutil.NvmlDeviceInfo == nil {
-		nvmlutil.NvmlDeviceInfo = &nvmlutil.DeviceInfo{}
-	}
-
-	devicesCount, ret := nvmlutil.NvmlDeviceInfo.DeviceCount()
+	devicesCount, ret := ngm.nvmlOps.DeviceCount()
 	if ret != nvml.SUCCESS {
 		return fmt.Errorf("failed to get devices count: %v", nvml.ErrorString(ret))
 	}
 
 	for i := 0; i < devicesCount; i++ {
-		device, ret := nvmlutil.NvmlDeviceInfo.DeviceHandleByIndex((i))
+		device, ret := ngm.nvmlOps.DeviceHandleByIndex((i))
 		if ret != nvml.SUCCESS {
 			return fmt.Errorf("failed to get the device handle for index %d: %v", i, nvml.ErrorString(ret))
 		}
 
-		minor, ret := nvmlutil.NvmlDeviceInfo.MinorNumber(device)
+		minor, ret := ngm.nvmlOps.MinorNumber(device)
 		if ret != nvml.SUCCESS {
 			return fmt.Errorf("failed to get the minor number for device with index %d: %v", i, nvml.ErrorString(ret))
 		}
@@ -258,7 +630,19 @@ func (ngm *nvidiaGPUManager) discoverGPUs() error {
 		path := fmt.Sprintf("nvidia%d", minor)
 		glog.V(3).Infof("Found Nvidia GPU %q\n", path)
 
-		topologyInfo, err := nvmlutil.Topology(device, pciDevicesRoot)
+		if len(ngm.gpuConfig.GPUSharingPolicies) > 0 {
+			uuid, ret := ngm.nvmlOps.UUID(device)
+			if ret != nvml.SUCCESS {
+				return fmt.Errorf("failed to get the UUID for device with index %d: %v", i, nvml.ErrorString(ret))
+			}
+			if policy, ok := ngm.gpuConfig.sharingPolicy(minor, uuid); ok {
+				ngm.devicesMutex.Lock()
+				ngm.sharingPolicies[path] = policy
+				ngm.devicesMutex.Unlock()
+			}
+		}
+
+		topologyInfo, err := nvmlutil.Topology(ngm.nvmlOps, device, pciDevicesRoot)
 		if err != nil {
 			glog.Errorf("unable to get topology for device with index %d", i, err)
 		}
@@ -332,19 +716,205 @@ func (ngm *nvidiaGPUManager) isMpsHealthy() error {
 	return nil
 }
 
-func (ngm *nvidiaGPUManager) Envs(numDevicesRequested int) map[string]string {
-	if ngm.gpuConfig.GPUSharingConfig.GPUSharingStrategy == gpusharing.MPS {
-		activeThreadLimit := numDevicesRequested * 100 / ngm.gpuConfig.GPUSharingConfig.MaxSharedClientsPerGPU
-		memoryLimitBytes := uint64(numDevicesRequested) * ngm.totalMemPerGPU / uint64(ngm.gpuConfig.GPUSharingConfig.MaxSharedClientsPerGPU)
-		return map[string]string{
-			mpsThreadLimitEnv: strconv.Itoa(activeThreadLimit),
-			// The mpsMemLimitEnv is the GPU memory limit per container, e.g. 0=8192M.
-			// 0 represents the device ID which this container resides.
-			// Since MPS container can only land in one GPU, it is always device 0 relatively.
-			mpsMemLimitEnv: fmt.Sprintf("0=%dM", memoryLimitBytes/(1024*1024)),
+// PreferredAllocation returns size devices out of the available ones, including mustInclude,
+// each backed by a distinct physical device. Physical devices with the most available slots are
+// preferred, so that slots are spread across the least shared GPUs.
+func (ngm *nvidiaGPUManager) PreferredAllocation(available, mustInclude []string, size int) []string {
+	allocation := make([]string, 0, size)
+	used := make(map[string]bool)
+	for _, id := range mustInclude {
+		allocation = append(allocation, id)
+		if physicalDeviceID, err := gpusharing.VirtualToPhysicalDeviceID(id); err == nil {
+			used[physicalDeviceID] = true
+		}
+	}
+
+	slots := make(map[string][]string)
+	var physicalDeviceIDs []string
+	for _, id := range available {
+		physicalDeviceID, err := gpusharing.VirtualToPhysicalDeviceID(id)
+		if err != nil || used[physicalDeviceID] {
+			continue
+		}
+		if _, ok := slots[physicalDeviceID]; !ok {
+			physicalDeviceIDs = append(physicalDeviceIDs, physicalDeviceID)
+		}
+		slots[physicalDeviceID] = append(slots[physicalDeviceID], id)
+	}
+	sort.Slice(physicalDeviceIDs, func(i, j int) bool {
+		a, b := physicalDeviceIDs[i], physicalDeviceIDs[j]
+		if len(slots[a]) != len(slots[b]) {
+			return len(slots[a]) > len(slots[b])
+		}
+		return lessDeviceID(a, b)
+	})
+	for _, physicalDeviceID := range physicalDeviceIDs {
+		if len(allocation) >= size {
+			break
+		}
+		ids := slots[physicalDeviceID]
+		sort.Slice(ids, func(i, j int) bool { return lessDeviceID(ids[i], ids[j]) })
+		allocation = append(allocation, ids[0])
+	}
+	return allocation
+}
+
+// ValidateMemoryRequest checks that the nvidia.com/gpu-memory units of a request
+// are advertised on this node. Units are exclusive and their total memory per GPU
+// never exceeds the physical memory, so co-located allocations always fit.
+func (ngm *nvidiaGPUManager) ValidateMemoryRequest(requestDevicesIDs []string) error {
+	if ngm.gpuConfig.GPUSharingConfig.GPUMemoryUnitMB <= 0 {
+		return nil
+	}
+	for _, id := range requestDevicesIDs {
+		physicalDeviceID, err := gpusharing.VirtualToPhysicalDeviceID(id)
+		if err != nil {
+			return err
+		}
+		units := ngm.memoryUnits(physicalDeviceID)
+		if len(requestDevicesIDs) > units {
+			return fmt.Errorf("invalid request for %d GPU memory units, %s only has %d units of %dMiB", len(requestDevicesIDs), physicalDeviceID, units, ngm.gpuConfig.GPUSharingConfig.GPUMemoryUnitMB)
+		}
+		index, err := gpusharing.MemoryUnitIndex(id)
+		if err != nil {
+			return err
+		}
+		if index >= units {
+			return fmt.Errorf("invalid allocation request with non-existing GPU memory unit %s", id)
+		}
+	}
+	return nil
+}
+
+// Envs returns the environment variables for a container allocated the given devices.
+// With MPS, the memory limit is set for every physical GPU the container gets slots on,
+// addressed by its index among the container's GPUs, e.g. 0=8192M,1=4096M. CUDA is set
+// to enumerate the GPUs in PCI bus order, the order of their device numbers, instead of
+// fastest first, so that each limit applies to the intended GPU.
+func (ngm *nvidiaGPUManager) Envs(requestDevicesIDs []string) map[string]string {
+	// Count the slots requested on each physical GPU.
+	slots := make(map[string]int)
+	var physicalDeviceIDs []string
+	for _, id := range requestDevicesIDs {
+		physicalDeviceID, err := gpusharing.VirtualToPhysicalDeviceID(id)
+		if err != nil {
+			physicalDeviceID = id
+		}
+		if _, ok := slots[physicalDeviceID]; !ok {
+			physicalDeviceIDs = append(physicalDeviceIDs, physicalDeviceID)
+		}
+		slots[physicalDeviceID]++
+	}
+	// Device numbers follow the PCI bus order, which CUDA is set to enumerate GPUs in.
+	sort.Slice(physicalDeviceIDs, func(i, j int) bool {
+		return lessDeviceID(physicalDeviceIDs[i], physicalDeviceIDs[j])
+	})
+	if len(physicalDeviceIDs) == 0 || ngm.sharingConfig(physicalDeviceIDs[0]).GPUSharingStrategy != gpusharing.MPS {
+		return map[string]string{}
+	}
+
+	// The active thread percentage applies to all GPUs of a client, so it is
+	// derived from the largest share requested on any single GPU.
+	activeThreadLimit := 0
+	memoryLimits := make([]string, 0, len(physicalDeviceIDs))
+	for i, physicalDeviceID := range physicalDeviceIDs {
+		threadLimit, memoryLimitMB := ngm.mpsLimits(physicalDeviceID, slots[physicalDeviceID])
+		if threadLimit > activeThreadLimit {
+			activeThreadLimit = threadLimit
+		}
+		memoryLimits = append(memoryLimits, fmt.Sprintf("%d=%dM", i, memoryLimitMB))
+	}
+	envs := map[string]string{
+		mpsThreadLimitEnv:  strconv.Itoa(activeThreadLimit),
+		mpsMemLimitEnv:     strings.Join(memoryLimits, ","),
+		cudaDeviceOrderEnv: "PCI_BUS_ID",
+	}
+	if ngm.gpuConfig.GPUSharingConfig.ManageMPSControlDaemon && len(physicalDeviceIDs) > 0 {
+		// A client can only connect to a single control daemon, which serves its first GPU.
+		envs[mpsPipeDirEnv] = mpsPipeDir(nvidiaMpsDir, physicalDeviceIDs[0])
+	}
+	return envs
+}
+
+// Mounts returns the mounts for a container allocated the given devices. Only containers
+// allocated GPUs shared with MPS get the pipe directory of the MPS control daemon. With
+// managed MPS control daemons, only the pipe directory of the daemon serving the container's
+// GPU or GPU partition is mounted, so that clients land on the right daemon.
+func (ngm *nvidiaGPUManager) Mounts(requestDevicesIDs []string) []pluginapi.Mount {
+	mounts := append([]pluginapi.Mount{}, ngm.mountPaths...)
+	if len(requestDevicesIDs) == 0 {
+		return mounts
+	}
+	physicalDeviceID, err := gpusharing.VirtualToPhysicalDeviceID(requestDevicesIDs[0])
+	if err != nil {
+		physicalDeviceID = requestDevicesIDs[0]
+	}
+	if ngm.sharingConfig(physicalDeviceID).GPUSharingStrategy != gpusharing.MPS {
+		return mounts
+	}
+	if !ngm.gpuConfig.GPUSharingConfig.ManageMPSControlDaemon {
+		// All MPS clients share the pipe directory of the externally started control daemon.
+		return append(mounts, pluginapi.Mount{HostPath: nvidiaMpsDir, ContainerPath: nvidiaMpsDir, ReadOnly: false})
+	}
+	if pipeDir, ok := ngm.Envs(requestDevicesIDs)[mpsPipeDirEnv]; ok {
+		mounts = append(mounts, pluginapi.Mount{HostPath: pipeDir, ContainerPath: pipeDir, ReadOnly: false})
+	}
+	return mounts
+}
+
+// MemoryLimits returns the GPU memory (in bytes) a container allocated the given devices may use on
+// each of its shared GPUs, keyed by device ID. This is the share of the GPU memory the MPS memory
+// limit is set to, and GPUs allocated exclusively have no limit.
+func (ngm *nvidiaGPUManager) MemoryLimits(requestDevicesIDs []string) map[string]uint64 {
+	slots := make(map[string]int)
+	for _, id := range requestDevicesIDs {
+		if physicalDeviceID, err := gpusharing.VirtualToPhysicalDeviceID(id); err == nil {
+			slots[physicalDeviceID]++
 		}
 	}
-	return map[string]string{}
+	limits := make(map[string]uint64, len(slots))
+	for physicalDeviceID, numSlots := range slots {
+		_, memoryLimitMB := ngm.mpsLimits(physicalDeviceID, numSlots)
+		limits[physicalDeviceID] = memoryLimitMB * 1024 * 1024
+	}
+	return limits
+}
+
+// mpsLimits returns the active thread percentage and the memory limit (in MiB) for a number of slots
+// on a single GPU or GPU partition.
+func (ngm *nvidiaGPUManager) mpsLimits(physicalDeviceID string, numSlots int) (int, uint64) {
+	totalMem := ngm.deviceMemory(physicalDeviceID)
+	if ngm.gpuConfig.GPUSharingConfig.GPUMemoryUnitMB > 0 {
+		// The thread percentage is proportional to the share of the GPU memory requested, rounded up.
+		memoryLimitMB := uint64(numSlots) * uint64(ngm.gpuConfig.GPUSharingConfig.GPUMemoryUnitMB)
+		totalMemMB := totalMem / (1024 * 1024)
+		if totalMemMB == 0 || memoryLimitMB >= totalMemMB {
+			return 100, memoryLimitMB
+		}
+		return int((memoryLimitMB*100 + totalMemMB - 1) / totalMemMB), memoryLimitMB
+	}
+	maxSharedClients := ngm.sharingConfig(physicalDeviceID).MaxSharedClientsPerGPU
+	activeThreadLimit := numSlots * 100 / maxSharedClients
+	memoryLimitBytes := uint64(numSlots) * totalMem / uint64(maxSharedClients)
+	return activeThreadLimit, memoryLimitBytes / (1024 * 1024)
+}
+
+// lessDeviceID orders device IDs such as nvidia2 and nvidia10/gi1 by their numbers.
+func lessDeviceID(a, b string) bool {
+	numRegex := regexp.MustCompile("[0-9]+")
+	an := numRegex.FindAllString(a, -1)
+	bn := numRegex.FindAllString(b, -1)
+	for i := 0; i < len(an) && i < len(bn); i++ {
+		ai, _ := strconv.Atoi(an[i])
+		bi, _ := strconv.Atoi(bn[i])
+		if ai != bi {
+			return ai < bi
+		}
+	}
+	if len(an) != len(bn) {
+		return len(an) < len(bn)
+	}
+	return a < b
 }
 
 // SetDeviceHealth sets the health status for a GPU device or partition if MIG is enabled
@@ -405,34 +975,58 @@ func (ngm *nvidiaGPUManager) Start() error {
 		}
 	}
 
-	if ngm.gpuConfig.GPUSharingConfig.GPUSharingStrategy == "mps" {
-		if err := ngm.isMpsHealthy(); err != nil {
-			return fmt.Errorf("NVIDIA MPS is not running on this node: %v", err)
+	if ngm.gpuConfig.UsesSharingStrategy(gpusharing.TimeSharing) && ngm.gpuConfig.GPUSharingConfig.TimesliceClass != TimesliceDefault {
+		if err := ngm.applyTimeslice(ngm.gpuConfig.GPUSharingConfig.TimesliceClass, ngm.gpuConfig.GPUSharingConfig.CustomTimeslice); err != nil {
+			return fmt.Errorf("failed to apply GPU timeslice: %v", err)
+		}
+	}
+
+	if ngm.gpuConfig.UsesSharingStrategy(gpusharing.MPS) {
+		if !ngm.gpuConfig.GPUSharingConfig.ManageMPSControlDaemon {
+			if err := ngm.isMpsHealthy(); err != nil {
+				return fmt.Errorf("NVIDIA MPS is not running on this node: %v", err)
+			}
 		}
-		ngm.mountPaths = append(ngm.mountPaths, pluginapi.Mount{HostPath: nvidiaMpsDir, ContainerPath: nvidiaMpsDir, ReadOnly: false})
 		var err error
-		ngm.totalMemPerGPU, err = totalMemPerGPU()
+		ngm.totalMemPerGPU, err = totalMemPerGPU(ngm.nvmlOps)
 		if err != nil {
 			return fmt.Errorf("failed to query total memory available per GPU: %v", err)
 		}
+		if ngm.gpuConfig.GPUPartitionSize != "" {
+			ngm.partitionMemory = make(map[string]uint64)
+			for id := range ngm.ListPhysicalDevices() {
+				if ngm.partitionMemory[id], err = nvmlDeviceMemory(ngm.nvmlOps, id); err != nil {
+					return fmt.Errorf("failed to query total memory available on GPU partition %s: %v", id, err)
+				}
+			}
+		}
+		if ngm.gpuConfig.GPUSharingConfig.ManageMPSControlDaemon {
+			if ngm.mpsDaemons == nil {
+				// Clients without explicit limits are limited to a single slot.
+				ngm.mpsDaemons = newMPSDaemonManager(ngm.setMPSHealth, func(deviceID string) (int, uint64) { return ngm.mpsLimits(deviceID, 1) }, ngm.nvmlOps)
+			}
+			if err := ngm.mpsDaemons.start(ngm.ListPhysicalDevices()); err != nil {
+				return fmt.Errorf("failed to start MPS control daemons: %v", err)
+			}
+		}
 	}
 	return nil
 }
 
 // totalMemPerGPU returns the GPU memory available on each GPU device.
-func totalMemPerGPU() (uint64, error) {
-	count, ret := nvml.DeviceGetCount()
+func totalMemPerGPU(nvmlOps nvmlutil.NvmlOperations) (uint64, error) {
+	count, ret := nvmlOps.DeviceCount()
 	if ret != nvml.SUCCESS {
 		return 0, fmt.Errorf("failed to enumerate devices: %v", nvml.ErrorString(ret))
 	}
 	if count <= 0 {
 		return 0, fmt.Errorf("no GPUs on node, count: %d", count)
 	}
-	device, ret := nvml.DeviceGetHandleByIndex(0)
+	device, ret := nvmlOps.DeviceHandleByIndex(0)
 	if ret != nvml.SUCCESS {
 		return 0, fmt.Errorf("failed to query GPU with nvml: %v", nvml.ErrorString(ret))
 	}
-	memory, ret := device.GetMemoryInfo()
+	memory, ret := nvmlOps.MemoryInfo(device)
 	if ret != nvml.SUCCESS {
 		return 0, fmt.Errorf("failed to get GPU memory: %v", nvml.ErrorString(ret))
 	}
@@ -462,43 +1056,50 @@ func (ngm *nvidiaGPUManager) Serve(pMountPath, kEndpoint, pluginEndpoint string)
 			return
 		default:
 			{
-				pluginEndpointPath := path.Join(pMountPath, pluginEndpoint)
-				glog.Infof("starting device-plugin server at: %s\n", pluginEndpointPath)
-				lis, err := net.Listen("unix", pluginEndpointPath)
-				if err != nil {
-					glog.Fatalf("starting device-plugin server failed: %v", err)
-				}
-				ngm.socket = pluginEndpointPath
-				ngm.grpcServer = grpc.NewServer()
-
-				// Registers the supported versions of service.
-				pluginbeta := &pluginServiceV1Beta1{ngm: ngm}
-				pluginbeta.RegisterService()
-
 				var wg sync.WaitGroup
-				wg.Add(1)
-				// Starts device plugin service.
-				go func() {
-					defer wg.Done()
-					// Blocking call to accept incoming connections.
-					err := ngm.grpcServer.Serve(lis)
-					glog.Errorf("device-plugin server stopped serving: %v", err)
-				}()
-
-				if registerWithKubelet {
-					// Wait till the grpcServer is ready to serve services.
-					for len(ngm.grpcServer.GetServiceInfo()) <= 0 {
-						time.Sleep(1 * time.Second)
-					}
-					glog.Infoln("device-plugin server started serving")
-					// Registers with Kubelet.
-					err = RegisterWithV1Beta1Kubelet(path.Join(pMountPath, kEndpoint), pluginEndpoint, resourceName)
+				ngm.grpcServers = nil
+				ngm.sockets = nil
+				// Each resource name is served by its own device-plugin server.
+				for _, name := range ngm.ResourceNames() {
+					endpoint := resourceEndpoint(pluginEndpoint, name)
+					pluginEndpointPath := path.Join(pMountPath, endpoint)
+					glog.Infof("starting device-plugin server for %s at: %s\n", name, pluginEndpointPath)
+					lis, err := net.Listen("unix", pluginEndpointPath)
 					if err != nil {
-						ngm.grpcServer.Stop()
-						wg.Wait()
-						glog.Fatal(err)
+						glog.Fatalf("starting device-plugin server failed: %v", err)
+					}
+					server := grpc.NewServer()
+					ngm.grpcServers = append(ngm.grpcServers, server)
+					ngm.sockets = append(ngm.sockets, pluginEndpointPath)
+
+					// Registers the supported versions of service.
+					pluginbeta := &pluginServiceV1Beta1{ngm: ngm, server: server, resourceName: name}
+					pluginbeta.RegisterService()
+
+					wg.Add(1)
+					// Starts device plugin service.
+					go func() {
+						defer wg.Done()
+						// Blocking call to accept incoming connections.
+						err := server.Serve(lis)
+						glog.Errorf("device-plugin server stopped serving: %v", err)
+					}()
+
+					if registerWithKubelet {
+						// Wait till the grpcServer is ready to serve services.
+						for len(server.GetServiceInfo()) <= 0 {
+							time.Sleep(1 * time.Second)
+						}
+						glog.Infoln("device-plugin server started serving")
+						// Registers with Kubelet.
+						err = RegisterWithV1Beta1Kubelet(path.Join(pMountPath, kEndpoint), endpoint, name)
+						if err != nil {
+							ngm.stopServers()
+							wg.Wait()
+							glog.Fatal(err)
+						}
+						glog.Infof("device-plugin registered with the kubelet for %s", name)
 					}
-					glog.Infoln("device-plugin registered with the kubelet")
 				}
 
 				// This is checking if the plugin socket was deleted
@@ -513,16 +1114,18 @@ func (ngm *nvidiaGPUManager) Serve(pMountPath, kEndpoint, pluginEndpoint string)
 					select {
 					// Restart the device plugin if plugin endpoint file disappears.
 					case <-pluginSocketCheck.C:
-						if _, err := os.Lstat(pluginEndpointPath); err != nil {
-							glog.Infof("stopping device-plugin server at: %s\n", pluginEndpointPath)
-							glog.Errorln(err)
-							ngm.grpcServer.Stop()
-							break statusCheck
+						for _, socket := range ngm.sockets {
+							if _, err := os.Lstat(socket); err != nil {
+								glog.Infof("stopping device-plugin server at: %s\n", socket)
+								glog.Errorln(err)
+								ngm.stopServers()
+								break statusCheck
+							}
 						}
 					// Restart the device plugin if additional GPU installers.
 					case <-gpuCheck.C:
 						if ngm.hasAdditionalGPUsInstalled() {
-							ngm.grpcServer.Stop()
+							ngm.stopServers()
 							for {
 								err := ngm.discoverGPUs()
 								if err == nil {
@@ -534,7 +1137,7 @@ func (ngm *nvidiaGPUManager) Serve(pMountPath, kEndpoint, pluginEndpoint string)
 					case event := <-watcher.Events:
 						if event.Name == kubeletEndpointPath && event.Op&fsnotify.Create == fsnotify.Create {
 							glog.Infof(" %s recreated, stopping device-plugin server", kubeletEndpointPath)
-							ngm.grpcServer.Stop()
+							ngm.stopServers()
 							break statusCheck
 						}
 					// Log for any other fs errors and log them. This will not induce a device plugin restart.
@@ -548,13 +1151,33 @@ func (ngm *nvidiaGPUManager) Serve(pMountPath, kEndpoint, pluginEndpoint string)
 	}
 }
 
+// stopServers stops the device-plugin servers of all resources.
+func (ngm *nvidiaGPUManager) stopServers() {
+	for _, server := range ngm.grpcServers {
+		server.Stop()
+	}
+}
+
+// resourceEndpoint returns the name of the device-plugin socket serving a resource.
+func resourceEndpoint(pluginEndpoint, name string) string {
+	if name != sharedResourceName {
+		return pluginEndpoint
+	}
+	return strings.TrimSuffix(pluginEndpoint, ".sock") + "-shared.sock"
+}
+
 func (ngm *nvidiaGPUManager) Stop() error {
-	glog.Infof("removing device plugin socket %s\n", ngm.socket)
-	if err := os.Remove(ngm.socket); err != nil && !os.IsNotExist(err) {
-		return err
+	for _, socket := range ngm.sockets {
+		glog.Infof("removing device plugin socket %s\n", socket)
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
 	ngm.stop <- true
 	<-ngm.stop
+	if ngm.mpsDaemons != nil {
+		ngm.mpsDaemons.stopAll()
+	}
 	close(ngm.Health)
 	return nil
 }
@@ -32,6 +32,7 @@ func TestGPUConfig_AddDefaultsAndValidate(t *testing.T) {
 		GPUPartitionSize           string
 		MaxTimeSharedClientsPerGPU int
 		GPUSharingConfig           GPUSharingConfig
+		GPUSharingPolicies         []GPUSharingPolicy
 	}
 	tests := []struct {
 		name       string
@@ -67,6 +68,276 @@ func TestGPUConfig_AddDefaultsAndValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid config, mps with GPU memory units",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy: "mps",
+					GPUMemoryUnitMB:    1024,
+				},
+			},
+			wantErr: false,
+			wantFields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy: "mps",
+					GPUMemoryUnitMB:    1024,
+				},
+			},
+		},
+		{
+			name: "invalid config, time-sharing with GPU memory units",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+					GPUMemoryUnitMB:        1024,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, time-sharing with managed MPS control daemon",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+					ManageMPSControlDaemon: true,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid config, mps with GPU partitions and managed MPS control daemons",
+			fields: fields{
+				GPUPartitionSize: "3g.20gb",
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "mps",
+					GPUMemoryUnitMB:        1024,
+					ManageMPSControlDaemon: true,
+				},
+			},
+			wantErr: false,
+			wantFields: fields{
+				GPUPartitionSize: "3g.20gb",
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "mps",
+					GPUMemoryUnitMB:        1024,
+					ManageMPSControlDaemon: true,
+				},
+			},
+		},
+		{
+			name: "invalid config, mps with GPU partitions and external MPS control daemon",
+			fields: fields{
+				GPUPartitionSize: "3g.20gb",
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "mps",
+					MaxSharedClientsPerGPU: 2,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid config, time-sharing with timeslice",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+					TimesliceClass:         "medium",
+				},
+			},
+			wantErr: false,
+			wantFields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+					TimesliceClass:         "medium",
+				},
+			},
+		},
+		{
+			name: "invalid config, mps with timeslice",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "mps",
+					MaxSharedClientsPerGPU: 2,
+					TimesliceClass:         "short",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, custom timeslice out of range",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+					TimesliceClass:         "custom",
+					CustomTimeslice:        5,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, unknown timeslice class",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+					TimesliceClass:         "tiny",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, multi-GPU requests with managed MPS control daemon",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "mps",
+					MaxSharedClientsPerGPU: 2,
+					ManageMPSControlDaemon: true,
+					AllowMultiGPURequests:  true,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid config, exclusive and time-shared GPUs",
+			fields: fields{
+				GPUSharingPolicies: []GPUSharingPolicy{
+					{GPUs: []string{"0", "1"}},
+					{GPUs: []string{"2", "GPU-5e2c1d1a"}, GPUSharingStrategy: "time-sharing", MaxSharedClientsPerGPU: 4},
+				},
+			},
+			wantErr: false,
+			wantFields: fields{
+				GPUSharingPolicies: []GPUSharingPolicy{
+					{GPUs: []string{"0", "1"}},
+					{GPUs: []string{"2", "GPU-5e2c1d1a"}, GPUSharingStrategy: "time-sharing", MaxSharedClientsPerGPU: 4},
+				},
+			},
+		},
+		{
+			name: "invalid config, GPU selected by multiple sharing policies",
+			fields: fields{
+				GPUSharingPolicies: []GPUSharingPolicy{
+					{GPUs: []string{"0", "1"}},
+					{GPUs: []string{"1"}, GPUSharingStrategy: "mps", MaxSharedClientsPerGPU: 2},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, sharing policies with different sharing strategies",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+				},
+				GPUSharingPolicies: []GPUSharingPolicy{
+					{GPUs: []string{"1"}, GPUSharingStrategy: "mps", MaxSharedClientsPerGPU: 2},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, shared GPU sharing policy without MaxSharedClientsPerGPU",
+			fields: fields{
+				GPUSharingPolicies: []GPUSharingPolicy{
+					{GPUs: []string{"1"}, GPUSharingStrategy: "time-sharing"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, sharing policy with invalid GPU",
+			fields: fields{
+				GPUSharingPolicies: []GPUSharingPolicy{
+					{GPUs: []string{"nvidia1"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, sharing policies with GPU partitions",
+			fields: fields{
+				GPUPartitionSize: "1g.5gb",
+				GPUSharingPolicies: []GPUSharingPolicy{
+					{GPUs: []string{"0"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, GPU memory units without sharing strategy",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUMemoryUnitMB: 1024,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid config, time-sharing with slot headroom",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 4,
+					SlotHeadroom:           &SlotHeadroomConfig{MemoryHeadroomPercent: 10, UtilizationHeadroomPercent: 20},
+				},
+			},
+			wantErr: false,
+			wantFields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 4,
+					SlotHeadroom:           &SlotHeadroomConfig{MemoryHeadroomPercent: 10, UtilizationHeadroomPercent: 20},
+				},
+			},
+		},
+		{
+			name: "invalid config, slot headroom without sharing strategy",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					SlotHeadroom: &SlotHeadroomConfig{MemoryHeadroomPercent: 10},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, slot headroom with GPU memory units",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy: "mps",
+					GPUMemoryUnitMB:    1024,
+					SlotHeadroom:       &SlotHeadroomConfig{MemoryHeadroomPercent: 10},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, slot headroom with GPU partitions",
+			fields: fields{
+				GPUPartitionSize: "1g.5gb",
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+					SlotHeadroom:           &SlotHeadroomConfig{MemoryHeadroomPercent: 10},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config, slot headroom out of range",
+			fields: fields{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "time-sharing",
+					MaxSharedClientsPerGPU: 2,
+					SlotHeadroom:           &SlotHeadroomConfig{UtilizationHeadroomPercent: 100},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -74,6 +345,7 @@ func TestGPUConfig_AddDefaultsAndValidate(t *testing.T) {
 				GPUPartitionSize:           tt.fields.GPUPartitionSize,
 				MaxTimeSharedClientsPerGPU: tt.fields.MaxTimeSharedClientsPerGPU,
 				GPUSharingConfig:           tt.fields.GPUSharingConfig,
+				GPUSharingPolicies:         tt.fields.GPUSharingPolicies,
 			}
 			if err := config.AddDefaultsAndValidate(); (err != nil) != tt.wantErr {
 				t.Errorf("GPUConfig.AddDefaultsAndValidate() error = %v, wantErr %v", err, tt.wantErr)
@@ -82,6 +354,7 @@ func TestGPUConfig_AddDefaultsAndValidate(t *testing.T) {
 				GPUPartitionSize:           tt.wantFields.GPUPartitionSize,
 				MaxTimeSharedClientsPerGPU: tt.wantFields.MaxTimeSharedClientsPerGPU,
 				GPUSharingConfig:           tt.wantFields.GPUSharingConfig,
+				GPUSharingPolicies:         tt.wantFields.GPUSharingPolicies,
 			}
 			if !tt.wantErr && !reflect.DeepEqual(config, wantConfig) {
 				t.Errorf("GPUConfig was not defaulted correctly, got = %v, want = %v", config, wantConfig)
@@ -149,18 +422,18 @@ func TestGPUConfig_AddHealthCriticalXid(t *testing.T) {
 
 func Test_nvidiaGPUManager_Envs(t *testing.T) {
 	tests := []struct {
-		name                string
-		totalMemPerGPU      uint64
-		gpuConfig           GPUConfig
-		numDevicesRequested int
-		want                map[string]string
+		name              string
+		totalMemPerGPU    uint64
+		gpuConfig         GPUConfig
+		requestDevicesIDs []string
+		want              map[string]string
 	}{
 		{
-			name:                "No GPU sharing enabled",
-			totalMemPerGPU:      80 * 1024,
-			gpuConfig:           GPUConfig{},
-			numDevicesRequested: 1,
-			want:                map[string]string{},
+			name:              "No GPU sharing enabled",
+			totalMemPerGPU:    80 * 1024,
+			gpuConfig:         GPUConfig{},
+			requestDevicesIDs: []string{"nvidia0"},
+			want:              map[string]string{},
 		},
 		{
 			name:           "time-sharing enabled",
@@ -171,8 +444,8 @@ func Test_nvidiaGPUManager_Envs(t *testing.T) {
 					MaxSharedClientsPerGPU: 10,
 				},
 			},
-			numDevicesRequested: 1,
-			want:                map[string]string{},
+			requestDevicesIDs: []string{"nvidia0/vgpu0"},
+			want:              map[string]string{},
 		},
 		{
 			name: "MPS enabled, single GPU request",
@@ -184,10 +457,11 @@ func Test_nvidiaGPUManager_Envs(t *testing.T) {
 					MaxSharedClientsPerGPU: 10,
 				},
 			},
-			numDevicesRequested: 1,
+			requestDevicesIDs: []string{"nvidia0/vgpu0"},
 			want: map[string]string{
-				mpsThreadLimitEnv: "10",
-				mpsMemLimitEnv:    "0=8192M",
+				mpsThreadLimitEnv:  "10",
+				mpsMemLimitEnv:     "0=8192M",
+				cudaDeviceOrderEnv: "PCI_BUS_ID",
 			},
 		},
 		{
@@ -200,26 +474,251 @@ func Test_nvidiaGPUManager_Envs(t *testing.T) {
 					MaxSharedClientsPerGPU: 10,
 				},
 			},
-			numDevicesRequested: 5,
+			requestDevicesIDs: []string{"nvidia0/vgpu0", "nvidia0/vgpu1", "nvidia0/vgpu2", "nvidia0/vgpu3", "nvidia0/vgpu4"},
+			want: map[string]string{
+				mpsThreadLimitEnv:  "50",
+				mpsMemLimitEnv:     "0=40960M",
+				cudaDeviceOrderEnv: "PCI_BUS_ID",
+			},
+		},
+		{
+			name: "MPS enabled, GPU memory request",
+			// totalMemPerGPU is 80G.
+			totalMemPerGPU: 80 * 1024 * 1024 * 1024,
+			gpuConfig: GPUConfig{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy: "mps",
+					GPUMemoryUnitMB:    1024,
+				},
+			},
+			requestDevicesIDs: []string{"nvidia0/mem0", "nvidia0/mem1", "nvidia0/mem2", "nvidia0/mem3", "nvidia0/mem4", "nvidia0/mem5", "nvidia0/mem6", "nvidia0/mem7", "nvidia0/mem8", "nvidia0/mem9"},
 			want: map[string]string{
-				mpsThreadLimitEnv: "50",
-				mpsMemLimitEnv:    "0=40960M",
+				mpsThreadLimitEnv:  "13",
+				mpsMemLimitEnv:     "0=10240M",
+				cudaDeviceOrderEnv: "PCI_BUS_ID",
+			},
+		},
+		{
+			name: "MPS enabled, GPU memory request for the whole GPU",
+			// totalMemPerGPU is 80G.
+			totalMemPerGPU: 80 * 1024 * 1024 * 1024,
+			gpuConfig: GPUConfig{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy: "mps",
+					GPUMemoryUnitMB:    40960,
+				},
+			},
+			requestDevicesIDs: []string{"nvidia0/mem0", "nvidia0/mem1"},
+			want: map[string]string{
+				mpsThreadLimitEnv:  "100",
+				mpsMemLimitEnv:     "0=81920M",
+				cudaDeviceOrderEnv: "PCI_BUS_ID",
+			},
+		},
+		{
+			name: "MPS enabled, GPU request across multiple GPUs",
+			// totalMemPerGPU is 80G.
+			totalMemPerGPU: 80 * 1024 * 1024 * 1024,
+			gpuConfig: GPUConfig{
+				GPUSharingConfig: GPUSharingConfig{
+					GPUSharingStrategy:     "mps",
+					MaxSharedClientsPerGPU: 10,
+				},
+			},
+			requestDevicesIDs: []string{"nvidia10/vgpu0", "nvidia2/vgpu1", "nvidia2/vgpu3"},
+			want: map[string]string{
+				mpsThreadLimitEnv:  "20",
+				mpsMemLimitEnv:     "0=16384M,1=8192M",
+				cudaDeviceOrderEnv: "PCI_BUS_ID",
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
 			ngm := &nvidiaGPUManager{
 				gpuConfig:      tt.gpuConfig,
 				totalMemPerGPU: tt.totalMemPerGPU,
 			}
-			if got := ngm.Envs(tt.numDevicesRequested); !reflect.DeepEqual(got, tt.want) {
+			if got := ngm.Envs(tt.requestDevicesIDs); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("nvidiaGPUManager.Envs() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func Test_nvidiaGPUManager_MemoryLimits(t *testing.T) {
+	ngm := &nvidiaGPUManager{
+		gpuConfig: GPUConfig{
+			GPUSharingConfig: GPUSharingConfig{
+				GPUSharingStrategy:     "time-sharing",
+				MaxSharedClientsPerGPU: 4,
+			},
+		},
+		totalMemPerGPU: 16 * 1024 * 1024 * 1024,
+	}
+	want := map[string]uint64{
+		"nvidia0": 8 * 1024 * 1024 * 1024,
+		"nvidia1": 4 * 1024 * 1024 * 1024,
+	}
+	if diff := cmp.Diff(want, ngm.MemoryLimits([]string{"nvidia0/vgpu0", "nvidia0/vgpu3", "nvidia1/vgpu2"})); diff != "" {
+		t.Errorf("unexpected MemoryLimits() (-want, +got) = %s", diff)
+	}
+	// GPUs allocated exclusively are not limited.
+	if got := ngm.MemoryLimits([]string{"nvidia2"}); len(got) != 0 {
+		t.Errorf("MemoryLimits() = %v for an exclusive GPU, want no limits", got)
+	}
+}
+
+func Test_nvidiaGPUManager_GPUMemory(t *testing.T) {
+	ngm := &nvidiaGPUManager{
+		devices: map[string]pluginapi.Device{
+			"nvidia0": {ID: "nvidia0", Health: pluginapi.Healthy},
+			"nvidia1": {ID: "nvidia1", Health: pluginapi.Unhealthy},
+		},
+		gpuConfig: GPUConfig{
+			GPUSharingConfig: GPUSharingConfig{
+				GPUSharingStrategy: "mps",
+				GPUMemoryUnitMB:    4096,
+			},
+		},
+		// 10GiB leaves a remainder which must not be advertised.
+		totalMemPerGPU: 10 * 1024 * 1024 * 1024,
+	}
+	if got := ngm.ResourceName(); got != "nvidia.com/gpu-memory" {
+		t.Errorf("ResourceName() = %s, want nvidia.com/gpu-memory", got)
+	}
+
+	want := map[string]pluginapi.Device{
+		"nvidia0/mem0": {ID: "nvidia0/mem0", Health: pluginapi.Healthy},
+		"nvidia0/mem1": {ID: "nvidia0/mem1", Health: pluginapi.Healthy},
+		"nvidia1/mem0": {ID: "nvidia1/mem0", Health: pluginapi.Unhealthy},
+		"nvidia1/mem1": {ID: "nvidia1/mem1", Health: pluginapi.Unhealthy},
+	}
+	if diff := cmp.Diff(want, ngm.ListDevices()); diff != "" {
+		t.Errorf("ListDevices() unexpected devices (-want, +got) = %s", diff)
+	}
+
+	tests := []struct {
+		name    string
+		ids     []string
+		wantErr bool
+	}{
+		{name: "single unit", ids: []string{"nvidia0/mem1"}},
+		{name: "all units of a GPU", ids: []string{"nvidia0/mem0", "nvidia0/mem1"}},
+		{name: "unit beyond physical memory", ids: []string{"nvidia0/mem2"}, wantErr: true},
+		{name: "more units than a GPU has", ids: []string{"nvidia0/mem0", "nvidia0/mem1", "nvidia1/mem0"}, wantErr: true},
+		{name: "not a memory unit", ids: []string{"nvidia0/vgpu0"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ngm.ValidateMemoryRequest(tt.ids); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateMemoryRequest(%v) error = %v, wantErr %v", tt.ids, err, tt.wantErr)
+			}
+		})
+	}
+
+	specs, err := ngm.DeviceSpec("nvidia0/mem1")
+	if err != nil {
+		t.Fatalf("DeviceSpec() failed: %v", err)
+	}
+	if len(specs) != 1 || specs[0].HostPath != "nvidia0" {
+		t.Errorf("DeviceSpec() = %v, want the spec of nvidia0", specs)
+	}
+}
+
+func Test_nvidiaGPUManager_MIGWithMPS(t *testing.T) {
+	ngm := &nvidiaGPUManager{
+		gpuConfig: GPUConfig{
+			GPUPartitionSize: "3g.20gb",
+			GPUSharingConfig: GPUSharingConfig{
+				GPUSharingStrategy:     "mps",
+				GPUMemoryUnitMB:        4096,
+				ManageMPSControlDaemon: true,
+			},
+		},
+		mountPaths:     []pluginapi.Mount{{HostPath: "/home/kubernetes/bin/nvidia", ContainerPath: "/usr/local/nvidia"}},
+		totalMemPerGPU: 80 * 1024 * 1024 * 1024,
+		// Limits and units are derived from the memory of each partition instead of the whole GPU.
+		partitionMemory: map[string]uint64{
+			"nvidia0/gi1": 20 * 1024 * 1024 * 1024,
+			"nvidia0/gi2": 10 * 1024 * 1024 * 1024,
+		},
+	}
+
+	if got := ngm.memoryUnits("nvidia0/gi1"); got != 5 {
+		t.Errorf("memoryUnits(nvidia0/gi1) = %d, want 5", got)
+	}
+	if got := ngm.memoryUnits("nvidia0/gi2"); got != 2 {
+		t.Errorf("memoryUnits(nvidia0/gi2) = %d, want 2", got)
+	}
+	if err := ngm.ValidateMemoryRequest([]string{"nvidia0/gi2/mem0", "nvidia0/gi2/mem1", "nvidia0/gi2/mem2"}); err == nil {
+		t.Errorf("ValidateMemoryRequest() with more units than the partition has succeeded, want error")
+	}
+	if err := ngm.ValidateMemoryRequest([]string{"nvidia0/gi1/mem3", "nvidia0/gi1/mem4"}); err != nil {
+		t.Errorf("ValidateMemoryRequest() failed: %v", err)
+	}
+
+	ids := []string{"nvidia0/gi2/mem0", "nvidia0/gi2/mem1"}
+	wantEnvs := map[string]string{
+		mpsThreadLimitEnv:  "80",
+		mpsMemLimitEnv:     "0=8192M",
+		cudaDeviceOrderEnv: "PCI_BUS_ID",
+		mpsPipeDirEnv:      "/tmp/nvidia-mps/nvidia0_gi2",
+	}
+	if diff := cmp.Diff(wantEnvs, ngm.Envs(ids)); diff != "" {
+		t.Errorf("unexpected Envs() (-want, +got) = %s", diff)
+	}
+	wantMounts := []pluginapi.Mount{
+		{HostPath: "/home/kubernetes/bin/nvidia", ContainerPath: "/usr/local/nvidia"},
+		{HostPath: "/tmp/nvidia-mps/nvidia0_gi2", ContainerPath: "/tmp/nvidia-mps/nvidia0_gi2"},
+	}
+	if diff := cmp.Diff(wantMounts, ngm.Mounts(ids)); diff != "" {
+		t.Errorf("unexpected Mounts() (-want, +got) = %s", diff)
+	}
+	if len(ngm.mountPaths) != 1 {
+		t.Errorf("Mounts() modified the mounts of the manager: %v", ngm.mountPaths)
+	}
+}
+
+func TestMountsMPSPipeDirectory(t *testing.T) {
+	driverMount := pluginapi.Mount{HostPath: "/home/kubernetes/bin/nvidia", ContainerPath: "/usr/local/nvidia"}
+	policies := []GPUSharingPolicy{
+		{GPUs: []string{"1"}, GPUSharingStrategy: "mps", MaxSharedClientsPerGPU: 2},
+		{GPUs: []string{"2"}, GPUSharingStrategy: "time-sharing", MaxSharedClientsPerGPU: 2},
+	}
+	sharingPolicies := map[string]GPUSharingPolicy{"nvidia1": policies[0], "nvidia2": policies[1]}
+
+	for _, manage := range []bool{false, true} {
+		ngm := &nvidiaGPUManager{
+			gpuConfig: GPUConfig{
+				GPUSharingConfig:   GPUSharingConfig{ManageMPSControlDaemon: manage},
+				GPUSharingPolicies: policies,
+			},
+			sharingPolicies: sharingPolicies,
+			mountPaths:      []pluginapi.Mount{driverMount},
+			totalMemPerGPU:  16 * 1024 * 1024 * 1024,
+		}
+		pipeMount := pluginapi.Mount{HostPath: nvidiaMpsDir, ContainerPath: nvidiaMpsDir}
+		if manage {
+			pipeMount = pluginapi.Mount{HostPath: "/tmp/nvidia-mps/nvidia1", ContainerPath: "/tmp/nvidia-mps/nvidia1"}
+		}
+		for _, tc := range []struct {
+			ids  []string
+			want []pluginapi.Mount
+		}{
+			// Exclusive and time-shared GPUs do not get the MPS pipe directory.
+			{ids: []string{"nvidia0"}, want: []pluginapi.Mount{driverMount}},
+			{ids: []string{"nvidia2/vgpu0"}, want: []pluginapi.Mount{driverMount}},
+			{ids: []string{"nvidia1/vgpu0"}, want: []pluginapi.Mount{driverMount, pipeMount}},
+		} {
+			if diff := cmp.Diff(tc.want, ngm.Mounts(tc.ids)); diff != "" {
+				t.Errorf("unexpected Mounts(%v) with managed control daemons %v (-want, +got) = %s", tc.ids, manage, diff)
+			}
+		}
+	}
+}
+
 func Test_topology(t *testing.T) {
 	testDevDir, err := ioutil.TempDir("", "pci")
 	defer os.RemoveAll(testDevDir)
@@ -277,11 +776,7 @@ func Test_topology(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// overriding nvmlutil.NvmlDeviceInfo to nvmlutil.MockDeviceInfo interface
-			nvmlutil.NvmlDeviceInfo = &nvmlutil.MockDeviceInfo{}
-			pciDevicesRoot = testDevDir
-			mockInfo := nvmlutil.NvmlDeviceInfo.(*nvmlutil.MockDeviceInfo)
-			mockInfo.BusID = tc.busID
+			mockInfo := &nvmlutil.MockDeviceInfo{BusID: tc.busID}
 			if len(tc.numaFileContent) > 0 {
 				err = os.MkdirAll(path.Join(testDevDir, tc.numaFileDir), 0755)
 				if err != nil {
@@ -297,7 +792,7 @@ func Test_topology(t *testing.T) {
 					t.Errorf("unable to write following content to %q file: %q", fileName, tc.numaFileContent)
 				}
 			}
-			gotTopologyInfo, gotError := nvmlutil.Topology(device, tc.pciDevicesRoot)
+			gotTopologyInfo, gotError := nvmlutil.Topology(mockInfo, device, tc.pciDevicesRoot)
 			if gotError != nil && !tc.wantError {
 				t.Errorf("%v", gotError)
 			}
@@ -308,3 +803,129 @@ func Test_topology(t *testing.T) {
 		})
 	}
 }
+
+func Test_nvidiaGPUManager_GPUSharingPolicies(t *testing.T) {
+	testDevDir := t.TempDir()
+	for _, device := range []string{"nvidia0", "nvidia1", "nvidia2", "nvidia3"} {
+		if _, err := os.Create(path.Join(testDevDir, device)); err != nil {
+			t.Fatalf("failed to create device %s: %v", device, err)
+		}
+	}
+	pciDevicesRoot = testDevDir
+
+	config := GPUConfig{
+		GPUSharingPolicies: []GPUSharingPolicy{
+			{GPUs: []string{"0", "1"}},
+			// The mock NVML library names the UUID of each GPU after its index.
+			{GPUs: []string{"2", "GPU-3"}, GPUSharingStrategy: "mps", MaxSharedClientsPerGPU: 2},
+		},
+	}
+	if err := config.AddDefaultsAndValidate(); err != nil {
+		t.Fatalf("AddDefaultsAndValidate() failed: %v", err)
+	}
+	ngm := NewNvidiaGPUManager(testDevDir, t.TempDir(), nil, config, &nvmlutil.MockDeviceInfo{TestDevDir: testDevDir})
+	ngm.totalMemPerGPU = 16 * 1024 * 1024 * 1024
+	if err := ngm.discoverGPUs(); err != nil {
+		t.Fatalf("discoverGPUs() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"nvidia.com/gpu", "nvidia.com/gpu-shared"}, ngm.ResourceNames()); diff != "" {
+		t.Errorf("unexpected ResourceNames() (-want, +got) = %s", diff)
+	}
+	got := make(map[string]string)
+	for id := range ngm.ListDevices() {
+		got[id] = ngm.deviceResourceName(id)
+	}
+	want := map[string]string{
+		"nvidia0":       "nvidia.com/gpu",
+		"nvidia1":       "nvidia.com/gpu",
+		"nvidia2/vgpu0": "nvidia.com/gpu-shared",
+		"nvidia2/vgpu1": "nvidia.com/gpu-shared",
+		"nvidia3/vgpu0": "nvidia.com/gpu-shared",
+		"nvidia3/vgpu1": "nvidia.com/gpu-shared",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected devices (-want, +got) = %s", diff)
+	}
+
+	for _, id := range []string{"nvidia0", "nvidia3/vgpu1"} {
+		if _, err := ngm.DeviceSpec(id); err != nil {
+			t.Errorf("DeviceSpec(%s) failed: %v", id, err)
+		}
+	}
+	for _, id := range []string{"nvidia0/vgpu0", "nvidia3"} {
+		if _, err := ngm.DeviceSpec(id); err == nil {
+			t.Errorf("DeviceSpec(%s) succeeded, want error", id)
+		}
+	}
+
+	if got := ngm.Envs([]string{"nvidia0"}); len(got) != 0 {
+		t.Errorf("Envs() of an exclusive GPU = %v, want none", got)
+	}
+	wantEnvs := map[string]string{mpsThreadLimitEnv: "50", mpsMemLimitEnv: "0=8192M", cudaDeviceOrderEnv: "PCI_BUS_ID"}
+	if diff := cmp.Diff(wantEnvs, ngm.Envs([]string{"nvidia2/vgpu1"})); diff != "" {
+		t.Errorf("unexpected Envs() (-want, +got) = %s", diff)
+	}
+
+	if got := resourceEndpoint("nvidiaGPU-1.sock", "nvidia.com/gpu-shared"); got != "nvidiaGPU-1-shared.sock" {
+		t.Errorf("resourceEndpoint() = %s, want nvidiaGPU-1-shared.sock", got)
+	}
+}
+
+func newMultiGPUTestManager() *nvidiaGPUManager {
+	return &nvidiaGPUManager{
+		devDirectory: "/dev",
+		devices: map[string]pluginapi.Device{
+			"nvidia0": {ID: "nvidia0", Health: pluginapi.Healthy},
+			"nvidia1": {ID: "nvidia1", Health: pluginapi.Healthy},
+			"nvidia2": {ID: "nvidia2", Health: pluginapi.Healthy},
+		},
+		gpuConfig: GPUConfig{
+			GPUSharingConfig: GPUSharingConfig{
+				GPUSharingStrategy:     "mps",
+				MaxSharedClientsPerGPU: 4,
+				AllowMultiGPURequests:  true,
+			},
+		},
+		totalMemPerGPU: 16 * 1024 * 1024 * 1024,
+	}
+}
+
+func TestPreferredAllocation(t *testing.T) {
+	ngm := newMultiGPUTestManager()
+	tests := []struct {
+		name        string
+		available   []string
+		mustInclude []string
+		size        int
+		want        []string
+	}{
+		{
+			name:      "spread across the least shared GPUs",
+			available: []string{"nvidia0/vgpu3", "nvidia1/vgpu0", "nvidia1/vgpu1", "nvidia2/vgpu2", "nvidia2/vgpu1", "nvidia2/vgpu3"},
+			size:      2,
+			want:      []string{"nvidia2/vgpu1", "nvidia1/vgpu0"},
+		},
+		{
+			name:        "must include device",
+			available:   []string{"nvidia0/vgpu0", "nvidia0/vgpu1", "nvidia1/vgpu0", "nvidia2/vgpu0"},
+			mustInclude: []string{"nvidia0/vgpu1"},
+			size:        2,
+			want:        []string{"nvidia0/vgpu1", "nvidia1/vgpu0"},
+		},
+		{
+			name:      "not enough physical GPUs",
+			available: []string{"nvidia0/vgpu0", "nvidia0/vgpu1"},
+			size:      2,
+			want:      []string{"nvidia0/vgpu0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ngm.PreferredAllocation(tt.available, tt.mustInclude, tt.size)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("PreferredAllocation() unexpected devices (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
@@ -46,10 +46,8 @@ type ContainerID struct {
 	container string
 }
 
-// GetDevicesForAllContainers returns a map with container as the key and the list of devices allocated to that container as the value.
-// It will skip time-shared GPU devices when time-sharing solution is enabled.
-func GetDevicesForAllContainers() (map[ContainerID][]string, error) {
-	containerDevices := make(map[ContainerID][]string)
+// listPodResources lists the devices allocated to the pods on the node by the kubelet.
+func listPodResources() ([]*podresources.PodResources, error) {
 	conn, err := grpc.Dial(
 		socketPath,
 		grpc.WithInsecure(),
@@ -64,16 +62,27 @@ func GetDevicesForAllContainers() (map[ContainerID][]string, error) {
 	}()
 
 	if err != nil {
-		return containerDevices, fmt.Errorf("error connecting to kubelet PodResourceLister service: %v", err)
+		return nil, fmt.Errorf("error connecting to kubelet PodResourceLister service: %v", err)
 	}
 	client := podresources.NewPodResourcesListerClient(conn)
 
 	resp, err := client.List(context.Background(), &podresources.ListPodResourcesRequest{})
 	if err != nil {
-		return containerDevices, fmt.Errorf("error listing pod resources: %v", err)
+		return nil, fmt.Errorf("error listing pod resources: %v", err)
+	}
+	return resp.PodResources, nil
+}
+
+// GetDevicesForAllContainers returns a map with container as the key and the list of devices allocated to that container as the value.
+// It will skip time-shared GPU devices when time-sharing solution is enabled.
+func GetDevicesForAllContainers() (map[ContainerID][]string, error) {
+	containerDevices := make(map[ContainerID][]string)
+	podResources, err := listPodResources()
+	if err != nil {
+		return containerDevices, err
 	}
 
-	for _, pod := range resp.PodResources {
+	for _, pod := range podResources {
 		container := ContainerID{
 			namespace: pod.Namespace,
 			pod:       pod.Name,
@@ -100,6 +109,47 @@ func GetDevicesForAllContainers() (map[ContainerID][]string, error) {
 	return containerDevices, nil
 }
 
+// GetAllocatedDeviceIDs returns the IDs of the devices of the given resources that are allocated to containers,
+// including the IDs of shared GPU devices.
+func GetAllocatedDeviceIDs(resourceNames ...string) (map[string]bool, error) {
+	containerDevices, err := getContainerDeviceIDs(resourceNames)
+	if err != nil {
+		return nil, err
+	}
+	allocated := make(map[string]bool)
+	for _, deviceIDs := range containerDevices {
+		for _, deviceID := range deviceIDs {
+			allocated[deviceID] = true
+		}
+	}
+	return allocated, nil
+}
+
+// getContainerDeviceIDs returns the IDs of the devices of the given resources allocated to each container,
+// including the IDs of shared GPU devices.
+func getContainerDeviceIDs(resourceNames []string) (map[ContainerID][]string, error) {
+	podResources, err := listPodResources()
+	if err != nil {
+		return nil, err
+	}
+	resources := make(map[string]bool)
+	for _, name := range resourceNames {
+		resources[name] = true
+	}
+	containerDevices := make(map[ContainerID][]string)
+	for _, pod := range podResources {
+		for _, c := range pod.Containers {
+			container := ContainerID{namespace: pod.Namespace, pod: pod.Name, container: c.Name}
+			for _, d := range c.Devices {
+				if resources[d.ResourceName] {
+					containerDevices[container] = append(containerDevices[container], d.DeviceIds...)
+				}
+			}
+		}
+	}
+	return containerDevices, nil
+}
+
 func GetAllGpuDevices() map[string]*nvml.Device {
 	return gpuDevices
 }
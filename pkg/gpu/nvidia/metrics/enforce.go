@@ -0,0 +1,223 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"syscall"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	clientv1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// EnforcementAction is what is done when the processes of a container use more
+// memory than the share of a shared GPU allocated to the container.
+type EnforcementAction string
+
+const (
+	// EnforcementFlag reports the violations with pod events and metrics.
+	EnforcementFlag EnforcementAction = "flag"
+	// EnforcementKill also kills the processes of the container on the GPU,
+	// largest first, until the container fits its share again.
+	EnforcementKill EnforcementAction = "kill"
+
+	memoryLimitExceededReason = "GPUMemoryLimitExceeded"
+	enforcementEventSource    = "nvidia-gpu-device-plugin"
+)
+
+var (
+	// ProcessMemoryLimit reports the GPU memory a container may use on a shared GPU.
+	ProcessMemoryLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_memory_limit",
+			Help: "GPU memory in bytes the processes of the container may use on the shared GPU",
+		},
+		[]string{"namespace", "pod", "container", "make", "accelerator_id", "model"})
+
+	// MemoryLimitViolations counts the times a container exceeded its share of the memory of a shared GPU.
+	MemoryLimitViolations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "memory_limit_violations_total",
+			Help: "Number of times the processes of the container exceeded its share of the memory of the shared GPU",
+		},
+		[]string{"namespace", "pod", "container", "make", "accelerator_id", "model", "action"})
+)
+
+// EnforcementConfig configures the enforcement of the GPU memory shares of containers on shared GPUs.
+type EnforcementConfig struct {
+	Action EnforcementAction
+	// ResourceNames are the extended resources the shared GPUs are allocated as.
+	ResourceNames []string
+	// MemoryLimits returns the GPU memory (in bytes) a container allocated the given devices
+	// may use on each GPU, keyed by device name. GPUs without a limit are not enforced.
+	MemoryLimits func(deviceIDs []string) map[string]uint64
+}
+
+// Validate checks the enforcement action.
+func (config EnforcementConfig) Validate() error {
+	switch config.Action {
+	case EnforcementFlag, EnforcementKill:
+		return nil
+	default:
+		return fmt.Errorf("invalid GPU memory enforcement action: %v, should be one of flag or kill", config.Action)
+	}
+}
+
+// violationRecorder reports a container exceeding its share of a GPU.
+type violationRecorder interface {
+	recordViolation(container ContainerID, message string)
+}
+
+// memoryEnforcer compares the memory used by the processes of each container on
+// a shared GPU to the share allocated to the container.
+type memoryEnforcer struct {
+	config EnforcementConfig
+	// containerDevices returns the IDs of the shared devices allocated to each container.
+	containerDevices func() (map[ContainerID][]string, error)
+	recorder         violationRecorder
+	// kill kills a process by the host PID reported by NVML, which requires
+	// the plugin to run in the host PID namespace.
+	kill func(pid uint32) error
+
+	// violating holds the containers exceeding their share of each device, so
+	// that a violation is flagged once for as long as it lasts.
+	violating map[containerDevice]bool
+}
+
+func newMemoryEnforcer(config EnforcementConfig, recorder violationRecorder) *memoryEnforcer {
+	return &memoryEnforcer{
+		config:           config,
+		containerDevices: func() (map[ContainerID][]string, error) { return getContainerDeviceIDs(config.ResourceNames) },
+		recorder:         recorder,
+		kill:             func(pid uint32) error { return syscall.Kill(int(pid), syscall.SIGKILL) },
+		violating:        make(map[containerDevice]bool),
+	}
+}
+
+// enforce checks the GPU memory used by the containers against their limits.
+func (e *memoryEnforcer) enforce(processes []containerProcess, infos map[string]metricsInfo) {
+	containerDevices, err := e.containerDevices()
+	if err != nil {
+		glog.Errorf("Failed to get the devices of containers, skipping GPU memory enforcement: %v", err)
+		return
+	}
+	byContainerDevice := make(map[containerDevice][]containerProcess)
+	for _, proc := range processes {
+		key := containerDevice{container: proc.container, device: proc.device}
+		byContainerDevice[key] = append(byContainerDevice[key], proc)
+	}
+
+	ProcessMemoryLimit.Reset()
+	violating := make(map[containerDevice]bool)
+	for container, deviceIDs := range containerDevices {
+		for device, limit := range e.config.MemoryLimits(deviceIDs) {
+			mi, ok := infos[device]
+			if !ok {
+				// The processes of the device could not be listed.
+				continue
+			}
+			ProcessMemoryLimit.WithLabelValues(container.namespace, container.pod, container.container, "nvidia", mi.uuid, mi.deviceModel).Set(float64(limit))
+
+			key := containerDevice{container: container, device: device}
+			procs := byContainerDevice[key]
+			var used uint64
+			for _, proc := range procs {
+				used += proc.usedMemory
+			}
+			if used <= limit {
+				continue
+			}
+			violating[key] = true
+			message := fmt.Sprintf("Container %s uses %d bytes of the memory of GPU %s, exceeding its share of %d bytes", container.container, used, mi.uuid, limit)
+			switch {
+			case e.config.Action == EnforcementKill:
+				message += fmt.Sprintf(", killed processes %v", e.killUntilFits(procs, used, limit))
+			case e.violating[key]:
+				// Already flagged.
+				continue
+			}
+			MemoryLimitViolations.WithLabelValues(container.namespace, container.pod, container.container, "nvidia", mi.uuid, mi.deviceModel, string(e.config.Action)).Inc()
+			e.recorder.recordViolation(container, message)
+		}
+	}
+	e.violating = violating
+}
+
+// killUntilFits kills the processes using the most memory first, until the
+// remaining ones fit the limit, and returns the PIDs of the killed processes.
+func (e *memoryEnforcer) killUntilFits(procs []containerProcess, used, limit uint64) []uint32 {
+	sort.Slice(procs, func(i, j int) bool { return procs[i].usedMemory > procs[j].usedMemory })
+	var killed []uint32
+	for _, proc := range procs {
+		if used <= limit {
+			break
+		}
+		if err := e.kill(proc.pid); err != nil {
+			glog.Errorf("Failed to kill process %d of container %s/%s/%s: %v", proc.pid, proc.container.namespace, proc.container.pod, proc.container.container, err)
+			continue
+		}
+		killed = append(killed, proc.pid)
+		used -= proc.usedMemory
+	}
+	return killed
+}
+
+// eventViolationRecorder logs the violations and, with a kube client, reports them as pod events.
+type eventViolationRecorder struct {
+	kubeClient kubernetes.Interface
+	recorder   record.EventRecorder
+}
+
+func newEventViolationRecorder(kubeClient kubernetes.Interface) *eventViolationRecorder {
+	if kubeClient == nil {
+		return &eventViolationRecorder{}
+	}
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&clientv1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	return &eventViolationRecorder{
+		kubeClient: kubeClient,
+		recorder:   eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: enforcementEventSource}),
+	}
+}
+
+func (r *eventViolationRecorder) recordViolation(container ContainerID, message string) {
+	glog.Warningf("%s/%s: %s", container.namespace, container.pod, message)
+	if r.recorder == nil {
+		return
+	}
+	pod := &v1.ObjectReference{
+		Kind:      "Pod",
+		Namespace: container.namespace,
+		Name:      container.pod,
+		FieldPath: fmt.Sprintf("spec.containers{%s}", container.container),
+	}
+	// The pod resources API does not report the pod UID, which ties the event
+	// to the pod instance rather than to any pod of the same name.
+	if p, err := r.kubeClient.CoreV1().Pods(container.namespace).Get(context.Background(), container.pod, metav1.GetOptions{}); err != nil {
+		glog.Warningf("Failed to get pod %s/%s for its GPU memory violation event: %v", container.namespace, container.pod, err)
+	} else {
+		pod.UID = p.UID
+	}
+	r.recorder.Event(pod, v1.EventTypeWarning, memoryLimitExceededReason, message)
+}
@@ -0,0 +1,144 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+type fakeViolationRecorder map[ContainerID][]string
+
+func (f fakeViolationRecorder) recordViolation(container ContainerID, message string) {
+	f[container] = append(f[container], message)
+}
+
+func TestMemoryEnforcer(t *testing.T) {
+	podA := ContainerID{namespace: "default", pod: "pod-a", container: "a"}
+	podB := ContainerID{namespace: "default", pod: "pod-b", container: "b"}
+	infos := map[string]metricsInfo{
+		"nvidia0": {uuid: "GPU-0", deviceModel: "model1", totalMemory: 400},
+	}
+	processes := []containerProcess{
+		{gpuProcess: gpuProcess{pid: 1, usedMemory: 150}, container: podA, device: "nvidia0"},
+		{gpuProcess: gpuProcess{pid: 2, usedMemory: 40}, container: podA, device: "nvidia0"},
+		{gpuProcess: gpuProcess{pid: 3, usedMemory: 100}, container: podB, device: "nvidia0"},
+	}
+
+	for _, action := range []EnforcementAction{EnforcementFlag, EnforcementKill} {
+		t.Run(string(action), func(t *testing.T) {
+			MemoryLimitViolations.Reset()
+			recorder := fakeViolationRecorder{}
+			var killed []uint32
+			e := newMemoryEnforcer(EnforcementConfig{
+				Action: action,
+				// Every slot is a quarter of the GPU.
+				MemoryLimits: func(deviceIDs []string) map[string]uint64 {
+					return map[string]uint64{"nvidia0": uint64(len(deviceIDs)) * 100}
+				},
+			}, recorder)
+			e.containerDevices = func() (map[ContainerID][]string, error) {
+				return map[ContainerID][]string{
+					podA: {"nvidia0/vgpu0"},
+					podB: {"nvidia0/vgpu1"},
+				}, nil
+			}
+			e.kill = func(pid uint32) error {
+				killed = append(killed, pid)
+				return nil
+			}
+
+			e.enforce(processes, infos)
+			e.enforce(processes, infos)
+
+			if got := testutil.ToFloat64(ProcessMemoryLimit.WithLabelValues("default", "pod-a", "a", "nvidia", "GPU-0", "model1")); got != 100 {
+				t.Errorf("ProcessMemoryLimit = %v, want 100", got)
+			}
+			if _, ok := recorder[podB]; ok {
+				t.Errorf("container within its share was reported: %v", recorder[podB])
+			}
+			wantViolations := 1
+			if action == EnforcementKill {
+				// The largest process is killed every time the container exceeds its share.
+				wantViolations = 2
+				if diff := cmp.Diff([]uint32{1, 1}, killed); diff != "" {
+					t.Errorf("unexpected killed processes (-want, +got) = %s", diff)
+				}
+			} else if len(killed) != 0 {
+				t.Errorf("processes %v were killed when flagging", killed)
+			}
+			if got := len(recorder[podA]); got != wantViolations {
+				t.Fatalf("recorded %d violations, want %d", got, wantViolations)
+			}
+			if !strings.Contains(recorder[podA][0], "uses 190 bytes") {
+				t.Errorf("unexpected violation message: %s", recorder[podA][0])
+			}
+			if got := testutil.ToFloat64(MemoryLimitViolations.WithLabelValues("default", "pod-a", "a", "nvidia", "GPU-0", "model1", string(action))); got != float64(wantViolations) {
+				t.Errorf("MemoryLimitViolations = %v, want %d", got, wantViolations)
+			}
+
+			// A violation is flagged again once it ended and starts over.
+			e.enforce(nil, infos)
+			e.enforce(processes, infos)
+			if got := len(recorder[podA]); got != wantViolations+1 {
+				t.Errorf("recorded %d violations, want %d", got, wantViolations+1)
+			}
+		})
+	}
+}
+
+func TestEnforcementConfigValidate(t *testing.T) {
+	for action, wantErr := range map[EnforcementAction]bool{EnforcementFlag: false, EnforcementKill: false, "evict": true} {
+		if err := (EnforcementConfig{Action: action}).Validate(); (err != nil) != wantErr {
+			t.Errorf("Validate() of %s error = %v, wantErr %v", action, err, wantErr)
+		}
+	}
+}
+
+// objectRecorder records the objects of the events.
+type objectRecorder struct {
+	record.EventRecorder
+	objects []runtime.Object
+}
+
+func (r *objectRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.objects = append(r.objects, object)
+}
+
+func TestEventViolationRecorder(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pod-a", UID: "uid-a"}})
+	events := &objectRecorder{}
+	r := &eventViolationRecorder{kubeClient: kubeClient, recorder: events}
+
+	r.recordViolation(ContainerID{namespace: "default", pod: "pod-a", container: "a"}, "violation")
+	// The event of a pod which cannot be found is still recorded, without UID.
+	r.recordViolation(ContainerID{namespace: "default", pod: "pod-b", container: "b"}, "violation")
+
+	want := []runtime.Object{
+		&v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "pod-a", UID: "uid-a", FieldPath: "spec.containers{a}"},
+		&v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "pod-b", FieldPath: "spec.containers{b}"},
+	}
+	if diff := cmp.Diff(want, events.objects); diff != "" {
+		t.Errorf("unexpected event objects (-want, +got) = %s", diff)
+	}
+}
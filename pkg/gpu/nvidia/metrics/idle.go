@@ -0,0 +1,277 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// IdleSinceAnnotation is set on pods whose GPUs have all been idle for longer
+// than the idle window. The value is the RFC 3339 time since when the pod is idle.
+const IdleSinceAnnotation = "cloud.google.com/gpu-idle-since"
+
+// IdleSeconds reports for how long an allocated GPU has been idle, once it has
+// been idle for longer than the idle window.
+var IdleSeconds = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "idle_seconds",
+		Help: "Seconds since the GPU allocated to the container became idle, reported once the idle window is exceeded",
+	},
+	[]string{"namespace", "pod", "container", "make", "accelerator_id", "model"})
+
+// IdleConfig configures the detection of idle allocated GPUs.
+type IdleConfig struct {
+	// Window is how long a device must stay idle before it is reported.
+	Window time.Duration
+	// DutyCycleThreshold is the duty cycle (in percent) at or below which a
+	// device is considered idle.
+	DutyCycleThreshold uint
+	// MemoryThreshold is the used memory (in bytes) at or below which a
+	// device is considered idle. Zero means memory usage is not considered.
+	MemoryThreshold uint64
+	// AnnotatePods enables the IdleSinceAnnotation on idle pods.
+	AnnotatePods bool
+	// NodeName is the node whose pods are annotated. The annotations left by a
+	// previous run on the pods of the node are reconciled on startup.
+	NodeName string
+}
+
+// podAnnotator sets or, when idleSince is nil, removes the idle annotation of a pod.
+type podAnnotator interface {
+	annotateIdleSince(namespace, pod string, idleSince *time.Time) error
+	// idleAnnotations returns the idle-since time annotated on the pods of the node.
+	idleAnnotations(nodeName string) (map[podKey]time.Time, error)
+}
+
+type podKey struct {
+	namespace string
+	name      string
+}
+
+type containerDevice struct {
+	container ContainerID
+	device    string
+}
+
+// idleTracker tracks since when every allocated device has been idle.
+type idleTracker struct {
+	config    IdleConfig
+	annotator podAnnotator
+	now       func() time.Time
+
+	idleSince map[containerDevice]time.Time
+	// annotated holds the idle-since time currently annotated on each pod.
+	annotated map[podKey]time.Time
+	// reconciled is set once the annotations of a previous run are loaded
+	// into annotated.
+	reconciled bool
+}
+
+func newIdleTracker(config IdleConfig, annotator podAnnotator) *idleTracker {
+	return &idleTracker{
+		config:    config,
+		annotator: annotator,
+		now:       time.Now,
+		idleSince: make(map[containerDevice]time.Time),
+		annotated: make(map[podKey]time.Time),
+	}
+}
+
+func (t *idleTracker) isIdle(mi metricsInfo) bool {
+	if mi.dutyCycle > t.config.DutyCycleThreshold {
+		return false
+	}
+	return t.config.MemoryThreshold == 0 || mi.usedMemory <= t.config.MemoryThreshold
+}
+
+// update records the state of the devices allocated to every container and
+// updates the idle metric and pod annotations. containerDevices lists the
+// devices allocated to every container, and allocated the metrics of those
+// which could be collected. Devices without metrics keep their idle state, so
+// a transient collection error does not restart the idle window.
+func (t *idleTracker) update(containerDevices map[ContainerID][]string, allocated map[ContainerID]map[string]metricsInfo) {
+	now := t.now()
+	annotate := t.config.AnnotatePods && t.annotator != nil
+	if annotate && !t.reconciled {
+		t.reconcile()
+	}
+
+	listed := make(map[containerDevice]bool)
+	// podIdleSince holds the latest idle-since time of the pod devices that
+	// exceeded the idle window. Pods in podActive have at least one device
+	// which did not, and pods in podUnknown at least one device without
+	// metrics, whose annotation is left unchanged.
+	podIdleSince := make(map[podKey]time.Time)
+	podActive := make(map[podKey]bool)
+	podUnknown := make(map[podKey]bool)
+	podPresent := make(map[podKey]bool)
+
+	for container, devices := range containerDevices {
+		pod := podKey{namespace: container.namespace, name: container.pod}
+		podPresent[pod] = true
+		for _, device := range devices {
+			key := containerDevice{container: container, device: device}
+			listed[key] = true
+			mi, ok := allocated[container][device]
+			if !ok {
+				podUnknown[pod] = true
+				continue
+			}
+			labels := []string{container.namespace, container.pod, container.container, "nvidia", mi.uuid, mi.deviceModel}
+
+			if !t.isIdle(mi) {
+				delete(t.idleSince, key)
+				IdleSeconds.DeleteLabelValues(labels...)
+				podActive[pod] = true
+				continue
+			}
+			since, ok := t.idleSince[key]
+			if !ok {
+				since = now
+				// Carry over the idle time annotated by a previous run.
+				if annotated, ok := t.annotated[pod]; ok && !annotated.IsZero() && annotated.Before(now) {
+					since = annotated
+				}
+				t.idleSince[key] = since
+			}
+			idle := now.Sub(since)
+			if idle < t.config.Window {
+				IdleSeconds.DeleteLabelValues(labels...)
+				podActive[pod] = true
+				continue
+			}
+			IdleSeconds.WithLabelValues(labels...).Set(idle.Seconds())
+			if since.After(podIdleSince[pod]) {
+				podIdleSince[pod] = since
+			}
+		}
+	}
+
+	// Forget containers that are gone from the pod resources.
+	for key := range t.idleSince {
+		if !listed[key] {
+			delete(t.idleSince, key)
+		}
+	}
+
+	if !annotate {
+		return
+	}
+	for pod, since := range podIdleSince {
+		if podActive[pod] || podUnknown[pod] {
+			continue
+		}
+		if annotated, ok := t.annotated[pod]; ok && annotated.Equal(since) {
+			continue
+		}
+		if err := t.annotator.annotateIdleSince(pod.namespace, pod.name, &since); err != nil {
+			glog.Errorf("Failed to annotate idle pod %s/%s: %v", pod.namespace, pod.name, err)
+			continue
+		}
+		t.annotated[pod] = since
+	}
+	for pod := range t.annotated {
+		if _, idle := podIdleSince[pod]; (idle && !podActive[pod]) || podUnknown[pod] {
+			continue
+		}
+		if podPresent[pod] {
+			// The pod is still running but is no longer idle.
+			if err := t.annotator.annotateIdleSince(pod.namespace, pod.name, nil); err != nil {
+				glog.Errorf("Failed to remove idle annotation from pod %s/%s: %v", pod.namespace, pod.name, err)
+				continue
+			}
+		}
+		delete(t.annotated, pod)
+	}
+}
+
+// reconcile loads the idle annotations left on the pods of the node by a
+// previous run, so that they are removed once the pods are no longer idle. It
+// is retried on the next update if the pods cannot be listed.
+func (t *idleTracker) reconcile() {
+	if t.config.NodeName == "" {
+		glog.Warning("Node name not set, skipping the reconciliation of the idle annotations of pods")
+		t.reconciled = true
+		return
+	}
+	annotated, err := t.annotator.idleAnnotations(t.config.NodeName)
+	if err != nil {
+		glog.Errorf("Failed to list the idle annotations of the pods of node %s: %v", t.config.NodeName, err)
+		return
+	}
+	for pod, since := range annotated {
+		t.annotated[pod] = since
+	}
+	t.reconciled = true
+}
+
+// kubePodAnnotator annotates pods through the Kubernetes API.
+type kubePodAnnotator struct {
+	kubeClient kubernetes.Interface
+}
+
+func (a *kubePodAnnotator) annotateIdleSince(namespace, pod string, idleSince *time.Time) error {
+	var value interface{}
+	if idleSince != nil {
+		value = idleSince.UTC().Format(time.RFC3339)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{IdleSinceAnnotation: value},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build patch: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+	_, err = a.kubeClient.CoreV1().Pods(namespace).Patch(ctx, pod, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func (a *kubePodAnnotator) idleAnnotations(nodeName string) (map[podKey]time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+	pods, err := a.kubeClient.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	annotated := make(map[podKey]time.Time)
+	for _, pod := range pods.Items {
+		value, ok := pod.Annotations[IdleSinceAnnotation]
+		if !ok {
+			continue
+		}
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			glog.Warningf("Invalid idle annotation %q on pod %s/%s: %v", value, pod.Namespace, pod.Name, err)
+		}
+		annotated[podKey{namespace: pod.Namespace, name: pod.Name}] = since
+	}
+	return annotated, nil
+}
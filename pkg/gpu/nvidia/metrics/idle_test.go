@@ -0,0 +1,182 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIdleTracker(t *testing.T) {
+	IdleSeconds.Reset()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "notebook"}}
+	kubeClient := fake.NewSimpleClientset(pod)
+	tracker := newIdleTracker(IdleConfig{
+		Window:             time.Hour,
+		DutyCycleThreshold: 1,
+		MemoryThreshold:    100,
+		AnnotatePods:       true,
+	}, &kubePodAnnotator{kubeClient: kubeClient})
+	tracker.now = func() time.Time { return now }
+
+	container := ContainerID{namespace: "default", pod: "notebook", container: "jupyter"}
+	labels := []string{"default", "notebook", "jupyter", "nvidia", "GPU-1", "model1"}
+	idle := map[ContainerID]map[string]metricsInfo{
+		container: {"nvidia0": {dutyCycle: 0, usedMemory: 10, uuid: "GPU-1", deviceModel: "model1"}},
+	}
+	listed := map[ContainerID][]string{container: {"nvidia0"}}
+	busy := map[ContainerID]map[string]metricsInfo{
+		container: {"nvidia0": {dutyCycle: 50, usedMemory: 10, uuid: "GPU-1", deviceModel: "model1"}},
+	}
+	annotation := func() (string, bool) {
+		t.Helper()
+		p, err := kubeClient.CoreV1().Pods("default").Get(context.Background(), "notebook", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod: %v", err)
+		}
+		v, ok := p.Annotations[IdleSinceAnnotation]
+		return v, ok
+	}
+
+	// Idle, but not for longer than the window yet.
+	tracker.update(listed, idle)
+	now = start.Add(30 * time.Minute)
+	tracker.update(listed, idle)
+	if got := testutil.CollectAndCount(IdleSeconds); got != 0 {
+		t.Errorf("idle_seconds reported %d series within the idle window, want 0", got)
+	}
+	if v, ok := annotation(); ok {
+		t.Errorf("pod annotated with %s within the idle window", v)
+	}
+
+	// The window is exceeded.
+	now = start.Add(2 * time.Hour)
+	tracker.update(listed, idle)
+	if got := testutil.ToFloat64(IdleSeconds.WithLabelValues(labels...)); got != 7200 {
+		t.Errorf("idle_seconds = %v, want 7200", got)
+	}
+	if v, _ := annotation(); v != start.Format(time.RFC3339) {
+		t.Errorf("idle annotation = %q, want %q", v, start.Format(time.RFC3339))
+	}
+
+	// A transient collection error neither restarts the idle window nor
+	// removes the annotation.
+	now = start.Add(150 * time.Minute)
+	tracker.update(listed, map[ContainerID]map[string]metricsInfo{})
+	tracker.update(listed, idle)
+	if got := testutil.ToFloat64(IdleSeconds.WithLabelValues(labels...)); got != 9000 {
+		t.Errorf("idle_seconds = %v after a collection error, want 9000", got)
+	}
+	if v, _ := annotation(); v != start.Format(time.RFC3339) {
+		t.Errorf("idle annotation = %q after a collection error, want %q", v, start.Format(time.RFC3339))
+	}
+
+	// The GPU becomes busy again.
+	now = start.Add(3 * time.Hour)
+	tracker.update(listed, busy)
+	if got := testutil.CollectAndCount(IdleSeconds); got != 0 {
+		t.Errorf("idle_seconds reported %d series for a busy GPU, want 0", got)
+	}
+	if v, ok := annotation(); ok {
+		t.Errorf("busy pod still annotated with %s", v)
+	}
+}
+
+func TestIdleTrackerThresholds(t *testing.T) {
+	tracker := newIdleTracker(IdleConfig{DutyCycleThreshold: 5, MemoryThreshold: 1024}, nil)
+	for _, tc := range []struct {
+		name string
+		mi   metricsInfo
+		want bool
+	}{
+		{name: "below thresholds", mi: metricsInfo{dutyCycle: 5, usedMemory: 1024}, want: true},
+		{name: "busy", mi: metricsInfo{dutyCycle: 6, usedMemory: 0}, want: false},
+		{name: "memory held", mi: metricsInfo{dutyCycle: 0, usedMemory: 1025}, want: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tracker.isIdle(tc.mi); got != tc.want {
+				t.Errorf("isIdle(%+v) = %v, want %v", tc.mi, got, tc.want)
+			}
+		})
+	}
+
+	tracker.config.MemoryThreshold = 0
+	if !tracker.isIdle(metricsInfo{dutyCycle: 0, usedMemory: 1 << 40}) {
+		t.Errorf("isIdle() = false with memory threshold disabled, want true")
+	}
+}
+
+func TestIdleTrackerReconcilesAnnotations(t *testing.T) {
+	IdleSeconds.Reset()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(2 * time.Hour)
+
+	annotatedPod := func(name, node string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Annotations: map[string]string{IdleSinceAnnotation: start.Format(time.RFC3339)}},
+			Spec:       v1.PodSpec{NodeName: node},
+		}
+	}
+	kubeClient := fake.NewSimpleClientset(
+		annotatedPod("idle", "node1"),
+		annotatedPod("busy", "node1"),
+		annotatedPod("other-node", "node2"),
+	)
+	tracker := newIdleTracker(IdleConfig{
+		Window:             time.Hour,
+		DutyCycleThreshold: 1,
+		AnnotatePods:       true,
+		NodeName:           "node1",
+	}, &kubePodAnnotator{kubeClient: kubeClient})
+	tracker.now = func() time.Time { return now }
+
+	idle := ContainerID{namespace: "default", pod: "idle", container: "c"}
+	busy := ContainerID{namespace: "default", pod: "busy", container: "c"}
+	tracker.update(map[ContainerID][]string{idle: {"nvidia0"}, busy: {"nvidia1"}}, map[ContainerID]map[string]metricsInfo{
+		idle: {"nvidia0": {dutyCycle: 0, uuid: "GPU-0", deviceModel: "model1"}},
+		busy: {"nvidia1": {dutyCycle: 50, uuid: "GPU-1", deviceModel: "model1"}},
+	})
+
+	for _, tc := range []struct {
+		pod  string
+		want string
+	}{
+		// The idle time of the previous run is carried over.
+		{pod: "idle", want: start.Format(time.RFC3339)},
+		{pod: "busy", want: ""},
+		// Pods of other nodes are left alone.
+		{pod: "other-node", want: start.Format(time.RFC3339)},
+	} {
+		p, err := kubeClient.CoreV1().Pods("default").Get(context.Background(), tc.pod, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get pod: %v", err)
+		}
+		if got := p.Annotations[IdleSinceAnnotation]; got != tc.want {
+			t.Errorf("idle annotation of pod %s = %q, want %q", tc.pod, got, tc.want)
+		}
+	}
+	if got := testutil.ToFloat64(IdleSeconds.WithLabelValues("default", "idle", "c", "nvidia", "GPU-0", "model1")); got != 7200 {
+		t.Errorf("idle_seconds = %v, want 7200", got)
+	}
+}
@@ -15,8 +15,13 @@
 package metrics
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
@@ -24,20 +29,31 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/kubernetes"
 )
 
 type metricsCollector interface {
 	collectGPUDevice(deviceName string) (*nvml.Device, error)
-	collectDutyCycle(string, time.Duration) (uint, error)
+	collectUtilization(uuid string) (utilizationStats, error)
 	collectGpuMetricsInfo(device string, d *nvml.Device) (metricsInfo, error)
 }
 
 var gmc metricsCollector
 
-type mCollector struct{}
+type mCollector struct {
+	utilization *utilizationTracker
+}
+
+// DeviceUsage is the usage of a GPU over the last collection interval.
+type DeviceUsage struct {
+	UsedMemory  uint64 // in bytes
+	TotalMemory uint64 // in bytes
+	DutyCycle   uint   // in percent
+}
 
 type metricsInfo struct {
 	dutyCycle   uint
+	utilization utilizationStats
 	usedMemory  uint64
 	totalMemory uint64
 	uuid        string
@@ -48,8 +64,8 @@ func (t *mCollector) collectGPUDevice(deviceName string) (*nvml.Device, error) {
 	return DeviceFromName(deviceName)
 }
 
-func (t *mCollector) collectDutyCycle(uuid string, since time.Duration) (uint, error) {
-	return AverageGPUUtilization(uuid, since)
+func (t *mCollector) collectUtilization(uuid string) (utilizationStats, error) {
+	return t.utilization.collect(uuid)
 }
 
 func (t *mCollector) collectGpuMetricsInfo(device string, d *nvml.Device) (metricsInfo, error) {
@@ -65,6 +81,14 @@ var (
 		},
 		[]string{"make", "accelerator_id", "model"})
 
+	// DutyCycleQuantileNodeGpu reports quantiles of the GPU utilization samples of the last collection interval per Node.
+	DutyCycleQuantileNodeGpu = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "duty_cycle_quantile_gpu_node",
+			Help: "Quantiles of the percent of time when the GPU was actively processing over the last collection interval",
+		},
+		[]string{"make", "accelerator_id", "model", "quantile"})
+
 	// MemoryTotalNodeGpu reports the total memory available on the GPU per Node.
 	MemoryTotalNodeGpu = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -114,7 +138,11 @@ var (
 		[]string{"namespace", "pod", "container", "resource_name"})
 )
 
-const metricsResetInterval = time.Minute
+const (
+	metricsResetInterval = time.Minute
+	// serverShutdownTimeout bounds how long Stop waits for in-flight scrapes.
+	serverShutdownTimeout = 5 * time.Second
+)
 
 // MetricServer exposes GPU metrics for all containers and nodes in prometheus format on the specified port.
 type MetricServer struct {
@@ -122,6 +150,19 @@ type MetricServer struct {
 	port                 int
 	metricsEndpointPath  string
 	lastMetricsResetTime time.Time
+	processes            *processCollector
+	idle                 *idleTracker
+	usageListeners       []func(map[string]DeviceUsage)
+	enforcer             *memoryEnforcer
+
+	bindAddress string
+	tlsCertFile string
+	tlsKeyFile  string
+	authorizer  *kubeAuthorizer
+
+	server *http.Server
+	stop   chan struct{}
+	wg     sync.WaitGroup
 }
 
 func NewMetricServer(collectionInterval, port int, metricsEndpointPath string) *MetricServer {
@@ -133,6 +174,56 @@ func NewMetricServer(collectionInterval, port int, metricsEndpointPath string) *
 	}
 }
 
+// EnableProcessMetrics enables the per process metrics, which map the processes
+// running on the GPUs to containers through the CRI runtime at criEndpoint.
+func (m *MetricServer) EnableProcessMetrics(criEndpoint string) {
+	m.processes = newProcessCollector(criEndpoint)
+}
+
+// EnableIdleDetection enables the idle_seconds metric for allocated GPUs and,
+// if config.AnnotatePods is set, the idle annotation on pods using kubeClient.
+func (m *MetricServer) EnableIdleDetection(config IdleConfig, kubeClient kubernetes.Interface) {
+	var annotator podAnnotator
+	if kubeClient != nil {
+		annotator = &kubePodAnnotator{kubeClient: kubeClient}
+	}
+	m.idle = newIdleTracker(config, annotator)
+}
+
+// EnableMemoryEnforcement checks the GPU memory used by the processes of each
+// container on a shared GPU against the share allocated to the container, and
+// reports violations as pod events using kubeClient, if set. It requires the
+// process metrics.
+func (m *MetricServer) EnableMemoryEnforcement(config EnforcementConfig, kubeClient kubernetes.Interface) {
+	m.enforcer = newMemoryEnforcer(config, newEventViolationRecorder(kubeClient))
+}
+
+// OnDeviceUsage registers a function called with the usage of every GPU, keyed by
+// device name, after each collection.
+func (m *MetricServer) OnDeviceUsage(listener func(map[string]DeviceUsage)) {
+	m.usageListeners = append(m.usageListeners, listener)
+}
+
+// SetBindAddress sets the address the metric server listens on. By default
+// it listens on all interfaces.
+func (m *MetricServer) SetBindAddress(address string) {
+	m.bindAddress = address
+}
+
+// EnableTLS serves the metrics over TLS using the given key pair. The files
+// are reloaded when they change.
+func (m *MetricServer) EnableTLS(certFile, keyFile string) {
+	m.tlsCertFile = certFile
+	m.tlsKeyFile = keyFile
+}
+
+// EnableAuthorization requires every request to carry a bearer token which is
+// allowed to get the metrics path, checked with TokenReview and
+// SubjectAccessReview. The server only starts if TLS is enabled as well.
+func (m *MetricServer) EnableAuthorization(kubeClient kubernetes.Interface) {
+	m.authorizer = newKubeAuthorizer(kubeClient)
+}
+
 // Start performs necessary initializations and starts the metric server.
 func (m *MetricServer) Start() error {
 	glog.Infoln("Starting metrics server")
@@ -148,25 +239,75 @@ func (m *MetricServer) Start() error {
 		return fmt.Errorf("failed to discover GPU devices: %v", err)
 	}
 
+	if err := m.startServer(); err != nil {
+		return err
+	}
+
+	gmc = &mCollector{utilization: newUtilizationTracker(nvmlUtilizationSampler{}, time.Millisecond*time.Duration(m.collectionInterval))}
+	m.wg.Add(1)
 	go func() {
-		http.Handle(m.metricsEndpointPath, promhttp.Handler())
-		err := http.ListenAndServe(fmt.Sprintf(":%d", m.port), nil)
+		defer m.wg.Done()
+		m.collectMetrics()
+	}()
+	return nil
+}
+
+// startServer starts serving the metrics endpoint in the background.
+func (m *MetricServer) startServer() error {
+	var handler http.Handler = promhttp.Handler()
+	if m.authorizer != nil {
+		// Scrapers would otherwise send their bearer tokens in plaintext.
+		if m.tlsCertFile == "" || m.tlsKeyFile == "" {
+			return fmt.Errorf("metrics authorization requires TLS, set a certificate and key")
+		}
+		handler = m.authorizer.wrap(handler)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(m.metricsEndpointPath, handler)
+
+	m.stop = make(chan struct{})
+	m.server = &http.Server{Handler: mux}
+	if m.tlsCertFile != "" || m.tlsKeyFile != "" {
+		reloader, err := newCertReloader(m.tlsCertFile, m.tlsKeyFile)
 		if err != nil {
-			glog.Infof("Failed to start metric server: %v", err)
+			return err
 		}
-	}()
+		m.server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.getCertificate,
+		}
+	}
+
+	lis, err := net.Listen("tcp", net.JoinHostPort(m.bindAddress, strconv.Itoa(m.port)))
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s:%d: %v", m.bindAddress, m.port, err)
+	}
+	glog.Infof("Metric server listening on %s", lis.Addr())
 
-	go m.collectMetrics()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		var err error
+		if m.server.TLSConfig != nil {
+			err = m.server.ServeTLS(lis, "", "")
+		} else {
+			err = m.server.Serve(lis)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			glog.Errorf("Metric server failed: %v", err)
+		}
+	}()
 	return nil
 }
 
 func (m *MetricServer) collectMetrics() {
-	gmc = &mCollector{}
 	t := time.NewTicker(time.Millisecond * time.Duration(m.collectionInterval))
 	defer t.Stop()
 
 	for {
 		select {
+		case <-m.stop:
+			return
 		case <-t.C:
 			devices, err := GetDevicesForAllContainers()
 			if err != nil {
@@ -193,12 +334,13 @@ func getGpuMetricsInfo(device string, d *nvml.Device) (metricsInfo, error) {
 	if ret != nvml.SUCCESS {
 		return metricsInfo{}, fmt.Errorf("failed to get GPU memory: %v", nvml.ErrorString(ret))
 	}
-	dutyCycle, err := gmc.collectDutyCycle(uuid, time.Second*10)
+	utilization, err := gmc.collectUtilization(uuid)
 	if err != nil {
 		return metricsInfo{}, fmt.Errorf("failed to get dutyCycle: %v", err)
 	}
 	return metricsInfo{
-		dutyCycle:   dutyCycle,
+		dutyCycle:   utilization.average,
+		utilization: utilization,
 		usedMemory:  mem.Used,
 		totalMemory: mem.Total,
 		uuid:        uuid,
@@ -207,6 +349,29 @@ func getGpuMetricsInfo(device string, d *nvml.Device) (metricsInfo, error) {
 
 func (m *MetricServer) updateMetrics(containerDevices map[ContainerID][]string, gpuDevices map[string]*nvml.Device) {
 	m.resetMetricsIfNeeded()
+
+	// Utilization samples are consumed when they are collected, so every
+	// device is collected at most once per interval and the result is shared
+	// between the node and container metrics.
+	infos := make(map[string]metricsInfo)
+	infoErrs := make(map[string]error)
+	getInfo := func(device string, d *nvml.Device) (metricsInfo, error) {
+		if mi, ok := infos[device]; ok {
+			return mi, nil
+		}
+		if err, ok := infoErrs[device]; ok {
+			return metricsInfo{}, err
+		}
+		mi, err := gmc.collectGpuMetricsInfo(device, d)
+		if err != nil {
+			infoErrs[device] = err
+			return metricsInfo{}, err
+		}
+		infos[device] = mi
+		return mi, nil
+	}
+
+	allocated := make(map[ContainerID]map[string]metricsInfo)
 	for container, devices := range containerDevices {
 		AcceleratorRequests.WithLabelValues(container.namespace, container.pod, container.container, gpuResourceName).Set(float64(len(devices)))
 		for _, device := range devices {
@@ -215,29 +380,67 @@ func (m *MetricServer) updateMetrics(containerDevices map[ContainerID][]string,
 				glog.Errorf("Failed to get device for %s: %v", device, err)
 				continue
 			}
-			mi, err := gmc.collectGpuMetricsInfo(device, d)
+			mi, err := getInfo(device, d)
 			if err != nil {
 				glog.Infof("Error calculating duty cycle for device: %s: %v. Skipping this device", device, err)
 				continue
 			}
+			if allocated[container] == nil {
+				allocated[container] = make(map[string]metricsInfo)
+			}
+			allocated[container][device] = mi
 			DutyCycle.WithLabelValues(container.namespace, container.pod, container.container, "nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.dutyCycle))
 			MemoryTotal.WithLabelValues(container.namespace, container.pod, container.container, "nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.totalMemory)) // memory reported in bytes
 			MemoryUsed.WithLabelValues(container.namespace, container.pod, container.container, "nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.usedMemory))   // memory reported in bytes
 		}
 	}
+	usage := make(map[string]DeviceUsage)
 	for device, d := range gpuDevices {
-		mi, err := gmc.collectGpuMetricsInfo(device, d)
+		mi, err := getInfo(device, d)
 		if err != nil {
 			glog.Infof("Error calculating duty cycle for device: %s: %v. Skipping this device", device, err)
 			continue
 		}
+		usage[device] = DeviceUsage{UsedMemory: mi.usedMemory, TotalMemory: mi.totalMemory, DutyCycle: mi.dutyCycle}
+		updateNodeMetrics(mi)
+	}
+
+	for _, listener := range m.usageListeners {
+		listener(usage)
+	}
+
+	if m.idle != nil {
+		m.idle.update(containerDevices, allocated)
+	}
 
-		DutyCycleNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.dutyCycle))
-		MemoryTotalNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.totalMemory)) // memory reported in bytes
-		MemoryUsedNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.usedMemory))   // memory reported in bytes
+	if m.processes != nil {
+		processes, deviceInfos, err := m.processes.collect(gpuDevices, getInfo)
+		if err != nil {
+			glog.Errorf("Failed to collect process metrics: %v", err)
+			return
+		}
+		// Process metrics are recomputed from scratch, so containers
+		// whose processes exited are dropped right away.
+		ProcessMemoryUsed.Reset()
+		ProcessSMUtilization.Reset()
+		updateProcessMetrics(containerUsages(processes), deviceInfos)
+
+		if m.enforcer != nil {
+			m.enforcer.enforce(processes, deviceInfos)
+		}
 	}
 }
 
+// updateNodeMetrics sets the node metrics of a GPU.
+func updateNodeMetrics(mi metricsInfo) {
+	DutyCycleNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.dutyCycle))
+	DutyCycleQuantileNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel, "0.5").Set(float64(mi.utilization.p50))
+	DutyCycleQuantileNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel, "0.95").Set(float64(mi.utilization.p95))
+	DutyCycleQuantileNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel, "1").Set(float64(mi.utilization.max))
+	MemoryTotalNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.totalMemory)) // memory reported in bytes
+	MemoryUsedNodeGpu.WithLabelValues("nvidia", mi.uuid, mi.deviceModel).Set(float64(mi.usedMemory))   // memory reported in bytes
+}
+
 func (m *MetricServer) resetMetricsIfNeeded() {
 	if time.Now().After(m.lastMetricsResetTime.Add(metricsResetInterval)) {
 		AcceleratorRequests.Reset()
@@ -245,8 +448,10 @@ func (m *MetricServer) resetMetricsIfNeeded() {
 		MemoryTotal.Reset()
 		MemoryUsed.Reset()
 		DutyCycleNodeGpu.Reset()
+		DutyCycleQuantileNodeGpu.Reset()
 		MemoryTotalNodeGpu.Reset()
 		MemoryUsedNodeGpu.Reset()
+		IdleSeconds.Reset()
 
 		m.lastMetricsResetTime = time.Now()
 	}
@@ -254,4 +459,20 @@ func (m *MetricServer) resetMetricsIfNeeded() {
 
 // Stop performs cleanup operations and stops the metric server.
 func (m *MetricServer) Stop() {
+	if m.server == nil {
+		return
+	}
+	glog.Infoln("Stopping metrics server")
+	close(m.stop)
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := m.server.Shutdown(ctx); err != nil {
+		glog.Warningf("Failed to gracefully shut down metric server: %v", err)
+		m.server.Close()
+	}
+	m.wg.Wait()
+	if m.processes != nil {
+		m.processes.close()
+	}
+	m.server = nil
 }
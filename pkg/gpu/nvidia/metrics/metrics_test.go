@@ -17,27 +17,32 @@ package metrics
 import (
 	"fmt"
 	"testing"
-	"time"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/google/go-cmp/cmp"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
-type mockCollector struct{}
+type mockCollector struct {
+	infoCalls map[string]int
+}
 
 func (t *mockCollector) collectGPUDevice(deviceName string) (*nvml.Device, error) {
 	return gpuDevicesMock[deviceName], nil
 }
 
-func (t *mockCollector) collectDutyCycle(uuid string, since time.Duration) (uint, error) {
+func (t *mockCollector) collectUtilization(uuid string) (utilizationStats, error) {
 	dutyCycle, ok := dutyCycleMock[uuid]
 	if !ok {
-		return 0, fmt.Errorf("duty cycle for %s not found", uuid)
+		return utilizationStats{}, fmt.Errorf("duty cycle for %s not found", uuid)
 	}
-	return dutyCycle, nil
+	return utilizationStats{average: dutyCycle, p50: dutyCycle, p95: dutyCycle, max: dutyCycle, sampleCount: 1}, nil
 }
 
 func (t *mockCollector) collectGpuMetricsInfo(device string, d *nvml.Device) (metricsInfo, error) {
+	if t.infoCalls != nil {
+		t.infoCalls[device]++
+	}
 	info := metricsInfoMock[device]
 	return metricsInfo{
 		dutyCycle:   info.dutyCycle,
@@ -207,3 +212,34 @@ func TestMetricsUpdate(t *testing.T) {
 		t.Fatalf("Wrong Result in MemoryUsedNodeGpu")
 	}
 }
+
+func TestMetricsUpdateCollectsDeviceOnce(t *testing.T) {
+	mc := &mockCollector{infoCalls: make(map[string]int)}
+	gmc = mc
+	ms := MetricServer{}
+	ms.updateMetrics(containerDevicesMock, gpuDevicesMock)
+
+	for device := range gpuDevicesMock {
+		if mc.infoCalls[device] != 1 {
+			t.Errorf("metrics of device %s collected %d times, want 1", device, mc.infoCalls[device])
+		}
+	}
+}
+
+func TestMetricsUpdateDeviceUsage(t *testing.T) {
+	gmc = &mockCollector{}
+	ms := MetricServer{}
+	var got map[string]DeviceUsage
+	ms.OnDeviceUsage(func(usage map[string]DeviceUsage) { got = usage })
+	ms.updateMetrics(containerDevicesMock, gpuDevicesMock)
+
+	want := map[string]DeviceUsage{
+		"nvidia0": {UsedMemory: 50, TotalMemory: 200, DutyCycle: 78},
+		"nvidia1": {UsedMemory: 150, TotalMemory: 200, DutyCycle: 32},
+		"nvidia2": {UsedMemory: 100, TotalMemory: 350, DutyCycle: 13},
+		"nvidia3": {UsedMemory: 375, TotalMemory: 700, DutyCycle: 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected device usage (-want, +got) = %s", diff)
+	}
+}
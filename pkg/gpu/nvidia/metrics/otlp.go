@@ -0,0 +1,360 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// OTLPProtocolGRPC exports metrics with OTLP over gRPC.
+	OTLPProtocolGRPC = "grpc"
+	// OTLPProtocolHTTP exports metrics with OTLP over HTTP using protobuf payloads.
+	OTLPProtocolHTTP = "http"
+
+	otlpHTTPMetricsPath = "/v1/metrics"
+	otlpScopeName       = "github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/metrics"
+	otlpExportTimeout   = 10 * time.Second
+
+	// Resource attribute keys attached to every exported metric.
+	resourceNodeName        = "k8s.node.name"
+	resourceAcceleratorType = "gpu.accelerator.type"
+	resourceDriverVersion   = "gpu.driver.version"
+)
+
+// otlpMetricNames lists the prometheus metrics that are pushed to the OTLP
+// endpoint. It matches the node and container metrics served on the
+// prometheus endpoint.
+var otlpMetricNames = map[string]bool{
+	"duty_cycle_gpu_node":           true,
+	"duty_cycle_quantile_gpu_node":  true,
+	"memory_total_gpu_node":         true,
+	"memory_used_gpu_node":          true,
+	"duty_cycle":                    true,
+	"memory_total":                  true,
+	"memory_used":                   true,
+	"request":                       true,
+	"process_memory_used":           true,
+	"process_sm_utilization":        true,
+	"idle_seconds":                  true,
+	"timeslice":                     true,
+	"memory_limit_violations_total": true,
+}
+
+// OTLPConfig configures the OTLP metrics exporter.
+type OTLPConfig struct {
+	// Endpoint is host:port for gRPC, or a base URL for HTTP
+	// (e.g. http://collector:4318). "/v1/metrics" is appended for HTTP
+	// unless the URL already contains a path.
+	Endpoint string
+	// Protocol is either "grpc" or "http".
+	Protocol string
+	// Insecure disables TLS for the gRPC exporter.
+	Insecure bool
+	// Interval is the time between two consecutive exports.
+	Interval time.Duration
+	// NodeName is reported as the k8s.node.name resource attribute.
+	NodeName string
+	// AcceleratorType is reported as the gpu.accelerator.type resource
+	// attribute. Defaults to the model of the first discovered GPU.
+	AcceleratorType string
+	// DriverVersion is reported as the gpu.driver.version resource
+	// attribute. Defaults to the version reported by NVML.
+	DriverVersion string
+	// CollectNodeMetrics makes the exporter collect the node metrics of the
+	// GPUs before each export, for when the metric server does not run.
+	CollectNodeMetrics bool
+}
+
+// OTLPExporter periodically pushes GPU metrics to an OTLP collector.
+type OTLPExporter struct {
+	config   OTLPConfig
+	gatherer prometheus.Gatherer
+
+	httpClient *http.Client
+	grpcConn   *grpc.ClientConn
+	// startTime is the start of the cumulative sums exported for counters.
+	startTime time.Time
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewOTLPExporter validates the config and returns an exporter which reads
+// metrics from the default prometheus registry.
+func NewOTLPExporter(config OTLPConfig) (*OTLPExporter, error) {
+	return newOTLPExporter(config, prometheus.DefaultGatherer)
+}
+
+func newOTLPExporter(config OTLPConfig, gatherer prometheus.Gatherer) (*OTLPExporter, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("OTLP endpoint must be set")
+	}
+	if config.Interval <= 0 {
+		return nil, fmt.Errorf("invalid OTLP export interval %v", config.Interval)
+	}
+	e := &OTLPExporter{
+		config:    config,
+		gatherer:  gatherer,
+		startTime: time.Now(),
+		stop:      make(chan struct{}),
+	}
+	switch config.Protocol {
+	case OTLPProtocolHTTP:
+		e.httpClient = &http.Client{Timeout: otlpExportTimeout}
+	case OTLPProtocolGRPC:
+		creds := credentials.NewTLS(&tls.Config{})
+		if config.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.NewClient(config.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP gRPC client for %s: %v", config.Endpoint, err)
+		}
+		e.grpcConn = conn
+	default:
+		return nil, fmt.Errorf("invalid OTLP protocol %q, must be one of %q, %q", config.Protocol, OTLPProtocolGRPC, OTLPProtocolHTTP)
+	}
+	return e, nil
+}
+
+// Start fills in missing resource attributes from NVML and starts pushing
+// metrics in the background.
+func (e *OTLPExporter) Start() error {
+	if e.config.CollectNodeMetrics {
+		if err := DiscoverGPUDevices(); err != nil {
+			return fmt.Errorf("failed to discover GPU devices: %v", err)
+		}
+		gmc = &mCollector{utilization: newUtilizationTracker(nvmlUtilizationSampler{}, e.config.Interval)}
+	}
+	if e.config.DriverVersion == "" {
+		driverVersion, ret := nvml.SystemGetDriverVersion()
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("failed to query nvml: %v", nvml.ErrorString(ret))
+		}
+		e.config.DriverVersion = driverVersion
+	}
+	if e.config.AcceleratorType == "" {
+		e.config.AcceleratorType = acceleratorTypeFromDevices(GetAllGpuDevices())
+	}
+	glog.Infof("Starting OTLP %s exporter to %s, interval: %v", e.config.Protocol, e.config.Endpoint, e.config.Interval)
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		t := time.NewTicker(e.config.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-t.C:
+				if e.config.CollectNodeMetrics {
+					collectNodeMetrics(GetAllGpuDevices())
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+				if err := e.export(ctx); err != nil {
+					glog.Errorf("Failed to export metrics to OTLP endpoint %s: %v", e.config.Endpoint, err)
+				}
+				cancel()
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the export loop and closes the connection to the collector.
+func (e *OTLPExporter) Stop() {
+	close(e.stop)
+	e.wg.Wait()
+	if e.grpcConn != nil {
+		if err := e.grpcConn.Close(); err != nil {
+			glog.Warningf("Failed to close OTLP gRPC connection: %v", err)
+		}
+	}
+}
+
+// collectNodeMetrics updates the node metrics of the GPUs.
+func collectNodeMetrics(gpuDevices map[string]*nvml.Device) {
+	for device, d := range gpuDevices {
+		mi, err := gmc.collectGpuMetricsInfo(device, d)
+		if err != nil {
+			glog.Infof("Error calculating duty cycle for device: %s: %v. Skipping this device", device, err)
+			continue
+		}
+		updateNodeMetrics(mi)
+	}
+}
+
+// acceleratorTypeFromDevices returns the model of the GPU with the lowest
+// device name, so the result is stable across restarts.
+func acceleratorTypeFromDevices(devices map[string]*nvml.Device) string {
+	names := make([]string, 0, len(devices))
+	for name := range devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		model, ret := devices[name].GetName()
+		if ret == nvml.SUCCESS {
+			return model
+		}
+	}
+	return ""
+}
+
+func (e *OTLPExporter) export(ctx context.Context) error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %v", err)
+	}
+	req := newExportMetricsRequest(e.resourceAttributes(), families, e.startTime, time.Now())
+
+	if e.grpcConn != nil {
+		_, err := colmetricspb.NewMetricsServiceClient(e.grpcConn).Export(ctx, req)
+		return err
+	}
+
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal OTLP request: %v", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, otlpHTTPURL(e.config.Endpoint), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := e.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected response status %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) resourceAttributes() []*commonpb.KeyValue {
+	var attrs []*commonpb.KeyValue
+	for _, kv := range [][2]string{
+		{resourceNodeName, e.config.NodeName},
+		{resourceAcceleratorType, e.config.AcceleratorType},
+		{resourceDriverVersion, e.config.DriverVersion},
+	} {
+		if kv[1] != "" {
+			attrs = append(attrs, stringKeyValue(kv[0], kv[1]))
+		}
+	}
+	return attrs
+}
+
+func otlpHTTPURL(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	if i := strings.Index(endpoint, "://"); !strings.Contains(endpoint[i+3:], "/") {
+		endpoint += otlpHTTPMetricsPath
+	}
+	return endpoint
+}
+
+// newExportMetricsRequest returns an ExportMetricsServiceRequest holding a
+// single ResourceMetrics with all gauges and counters from families whose
+// name is listed in otlpMetricNames.
+func newExportMetricsRequest(resource []*commonpb.KeyValue, families []*dto.MetricFamily, start, now time.Time) *colmetricspb.ExportMetricsServiceRequest {
+	scopeMetrics := &metricspb.ScopeMetrics{
+		Scope: &commonpb.InstrumentationScope{Name: otlpScopeName},
+	}
+	for _, mf := range families {
+		if !otlpMetricNames[mf.GetName()] {
+			continue
+		}
+		if mf.GetType() != dto.MetricType_GAUGE && mf.GetType() != dto.MetricType_COUNTER {
+			continue
+		}
+		scopeMetrics.Metrics = append(scopeMetrics.Metrics, newMetric(mf, start, now))
+	}
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     &resourcepb.Resource{Attributes: resource},
+			ScopeMetrics: []*metricspb.ScopeMetrics{scopeMetrics},
+		}},
+	}
+}
+
+// newMetric converts a gauge family to a Gauge, and a counter family to a
+// monotonic cumulative Sum starting at start so that backends compute its
+// rate.
+func newMetric(mf *dto.MetricFamily, start, now time.Time) *metricspb.Metric {
+	counter := mf.GetType() == dto.MetricType_COUNTER
+	var points []*metricspb.NumberDataPoint
+	for _, m := range mf.GetMetric() {
+		point := &metricspb.NumberDataPoint{
+			TimeUnixNano: uint64(now.UnixNano()),
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: m.GetGauge().GetValue()},
+		}
+		if counter {
+			point.StartTimeUnixNano = uint64(start.UnixNano())
+			point.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: m.GetCounter().GetValue()}
+		}
+		for _, l := range m.GetLabel() {
+			point.Attributes = append(point.Attributes, stringKeyValue(l.GetName(), l.GetValue()))
+		}
+		points = append(points, point)
+	}
+
+	metric := &metricspb.Metric{Name: mf.GetName(), Description: mf.GetHelp()}
+	if counter {
+		metric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             points,
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+	} else {
+		metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: points}}
+	}
+	return metric
+}
+
+func stringKeyValue(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
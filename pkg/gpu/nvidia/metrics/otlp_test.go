@@ -0,0 +1,267 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpDataPoint is a decoded OTLP NumberDataPoint.
+type otlpDataPoint struct {
+	metric string
+	attrs  map[string]string
+	value  float64
+	// sum is set for the points of a monotonic cumulative Sum.
+	sum bool
+}
+
+// otlpRequest is the subset of an ExportMetricsServiceRequest that the tests
+// check.
+type otlpRequest struct {
+	resource map[string]string
+	points   []otlpDataPoint
+}
+
+func keyValues(kvs []*commonpb.KeyValue) map[string]string {
+	m := make(map[string]string)
+	for _, kv := range kvs {
+		m[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	return m
+}
+
+func toOTLPRequest(t *testing.T, req *colmetricspb.ExportMetricsServiceRequest) otlpRequest {
+	t.Helper()
+	if len(req.GetResourceMetrics()) != 1 {
+		t.Fatalf("got %d resource metrics, want 1", len(req.GetResourceMetrics()))
+	}
+	rm := req.GetResourceMetrics()[0]
+	got := otlpRequest{resource: keyValues(rm.GetResource().GetAttributes())}
+	for _, sm := range rm.GetScopeMetrics() {
+		if sm.GetScope().GetName() != otlpScopeName {
+			t.Errorf("unexpected scope %q", sm.GetScope().GetName())
+		}
+		for _, m := range sm.GetMetrics() {
+			points := m.GetGauge().GetDataPoints()
+			sum := m.GetSum()
+			if sum != nil {
+				points = sum.GetDataPoints()
+			}
+			for _, p := range points {
+				if sum != nil && p.GetStartTimeUnixNano() == 0 {
+					t.Errorf("point of sum %s has no start time", m.GetName())
+				}
+				got.points = append(got.points, otlpDataPoint{
+					metric: m.GetName(),
+					attrs:  keyValues(p.GetAttributes()),
+					value:  p.GetAsDouble(),
+					sum:    sum.GetIsMonotonic() && sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				})
+			}
+		}
+	}
+	return got
+}
+
+func testGatherer() prometheus.Gatherer {
+	reg := prometheus.NewRegistry()
+	node := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "duty_cycle_gpu_node", Help: "help"}, []string{"make", "accelerator_id", "model"})
+	container := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "memory_used", Help: "help"}, []string{"namespace", "pod", "container", "make", "accelerator_id", "model"})
+	violations := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "memory_limit_violations_total", Help: "help"}, []string{"namespace", "pod", "container", "make", "accelerator_id", "model", "action"})
+	other := prometheus.NewGauge(prometheus.GaugeOpts{Name: "unrelated", Help: "help"})
+	reg.MustRegister(node, container, violations, other)
+	node.WithLabelValues("nvidia", "GPU-1", "model1").Set(78)
+	container.WithLabelValues("default", "pod1", "container1", "nvidia", "GPU-1", "model1").Set(50)
+	violations.WithLabelValues("default", "pod1", "container1", "nvidia", "GPU-1", "model1", "kill").Add(3)
+	other.Set(1)
+	return reg
+}
+
+func testOTLPConfig(protocol, endpoint string) OTLPConfig {
+	return OTLPConfig{
+		Endpoint:        endpoint,
+		Protocol:        protocol,
+		Insecure:        true,
+		Interval:        time.Second,
+		NodeName:        "node1",
+		AcceleratorType: "nvidia-tesla-t4",
+		DriverVersion:   "535.104.05",
+	}
+}
+
+var wantOTLPRequest = otlpRequest{
+	resource: map[string]string{
+		"k8s.node.name":        "node1",
+		"gpu.accelerator.type": "nvidia-tesla-t4",
+		"gpu.driver.version":   "535.104.05",
+	},
+	points: []otlpDataPoint{
+		{
+			metric: "duty_cycle_gpu_node",
+			attrs:  map[string]string{"make": "nvidia", "accelerator_id": "GPU-1", "model": "model1"},
+			value:  78,
+		},
+		{
+			metric: "memory_limit_violations_total",
+			attrs:  map[string]string{"namespace": "default", "pod": "pod1", "container": "container1", "make": "nvidia", "accelerator_id": "GPU-1", "model": "model1", "action": "kill"},
+			value:  3,
+			sum:    true,
+		},
+		{
+			metric: "memory_used",
+			attrs:  map[string]string{"namespace": "default", "pod": "pod1", "container": "container1", "make": "nvidia", "accelerator_id": "GPU-1", "model": "model1"},
+			value:  50,
+		},
+	},
+}
+
+func TestOTLPExportHTTP(t *testing.T) {
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/x-protobuf" {
+			t.Errorf("unexpected content type %s", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- body
+	}))
+	defer collector.Close()
+
+	e, err := newOTLPExporter(testOTLPConfig(OTLPProtocolHTTP, collector.URL), testGatherer())
+	if err != nil {
+		t.Fatalf("newOTLPExporter() failed: %v", err)
+	}
+	if err := e.export(context.Background()); err != nil {
+		t.Fatalf("export() failed: %v", err)
+	}
+
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	if err := proto.Unmarshal(<-received, req); err != nil {
+		t.Fatalf("failed to unmarshal OTLP request: %v", err)
+	}
+	got := toOTLPRequest(t, req)
+	if diff := cmp.Diff(wantOTLPRequest, got, cmp.AllowUnexported(otlpRequest{}, otlpDataPoint{})); diff != "" {
+		t.Errorf("unexpected OTLP request (-want +got):\n%s", diff)
+	}
+}
+
+func TestOTLPExportHTTPError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	e, err := newOTLPExporter(testOTLPConfig(OTLPProtocolHTTP, collector.URL), testGatherer())
+	if err != nil {
+		t.Fatalf("newOTLPExporter() failed: %v", err)
+	}
+	if err := e.export(context.Background()); err == nil {
+		t.Errorf("export() succeeded, want error on non-2xx response")
+	}
+}
+
+// fakeMetricsService is an OTLP collector receiving metrics over gRPC.
+type fakeMetricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	received chan *colmetricspb.ExportMetricsServiceRequest
+}
+
+func (s *fakeMetricsService) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.received <- req
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPExportGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	service := &fakeMetricsService{received: make(chan *colmetricspb.ExportMetricsServiceRequest, 1)}
+	collector := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(collector, service)
+	go collector.Serve(lis)
+	defer collector.Stop()
+
+	e, err := newOTLPExporter(testOTLPConfig(OTLPProtocolGRPC, lis.Addr().String()), testGatherer())
+	if err != nil {
+		t.Fatalf("newOTLPExporter() failed: %v", err)
+	}
+	defer e.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := e.export(ctx); err != nil {
+		t.Fatalf("export() failed: %v", err)
+	}
+
+	got := toOTLPRequest(t, <-service.received)
+	if diff := cmp.Diff(wantOTLPRequest, got, cmp.AllowUnexported(otlpRequest{}, otlpDataPoint{})); diff != "" {
+		t.Errorf("unexpected OTLP request (-want +got):\n%s", diff)
+	}
+}
+
+func TestCollectNodeMetrics(t *testing.T) {
+	gmc = &mockCollector{}
+	MemoryUsedNodeGpu.Reset()
+	collectNodeMetrics(gpuDevicesMock)
+	if got := testutil.ToFloat64(MemoryUsedNodeGpu.WithLabelValues("nvidia", "8732906554", "model1")); got != 375 {
+		t.Errorf("memory_used_gpu_node = %v, want 375", got)
+	}
+}
+
+func TestNewOTLPExporterValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config OTLPConfig
+	}{
+		{name: "missing endpoint", config: OTLPConfig{Protocol: OTLPProtocolHTTP, Interval: time.Second}},
+		{name: "invalid protocol", config: OTLPConfig{Endpoint: "localhost:4317", Protocol: "udp", Interval: time.Second}},
+		{name: "invalid interval", config: OTLPConfig{Endpoint: "localhost:4317", Protocol: OTLPProtocolGRPC}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newOTLPExporter(tc.config, testGatherer()); err == nil {
+				t.Errorf("newOTLPExporter(%+v) succeeded, want error", tc.config)
+			}
+		})
+	}
+}
+
+func TestOTLPHTTPURL(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"collector:4318":                    "http://collector:4318/v1/metrics",
+		"https://collector:4318":            "https://collector:4318/v1/metrics",
+		"http://collector:4318/custom/path": "http://collector:4318/custom/path",
+	} {
+		if got := otlpHTTPURL(endpoint); got != want {
+			t.Errorf("otlpHTTPURL(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
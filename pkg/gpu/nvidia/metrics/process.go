@@ -0,0 +1,333 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const (
+	criPodNamespaceLabel = "io.kubernetes.pod.namespace"
+	criPodNameLabel      = "io.kubernetes.pod.name"
+	criContainerLabel    = "io.kubernetes.container.name"
+)
+
+// cgroupContainerIDRegex matches the 64 hex digit container ID in a cgroup path,
+// for both the systemd (.../cri-containerd-<id>.scope) and the cgroupfs
+// (.../pod<uid>/<id>) cgroup drivers.
+var cgroupContainerIDRegex = regexp.MustCompile(`([0-9a-f]{64})(\.scope)?$`)
+
+var (
+	// ProcessMemoryUsed reports GPU memory used by the processes of a container.
+	ProcessMemoryUsed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_memory_used",
+			Help: "GPU memory in bytes used by the processes of the container",
+		},
+		[]string{"namespace", "pod", "container", "make", "accelerator_id", "model"})
+
+	// ProcessSMUtilization reports the SM utilization of the processes of a container.
+	ProcessSMUtilization = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "process_sm_utilization",
+			Help: "Percent of time the GPU streaming multiprocessors were used by the processes of the container",
+		},
+		[]string{"namespace", "pod", "container", "make", "accelerator_id", "model"})
+)
+
+// gpuProcess is a process running on a GPU.
+type gpuProcess struct {
+	pid        uint32
+	usedMemory uint64
+	// smUtil is the SM utilization of the process in percent, averaged over
+	// the samples reported since the previous collection.
+	smUtil uint
+}
+
+// gpuProcessLister lists the compute and graphics processes running on a GPU.
+type gpuProcessLister interface {
+	gpuProcesses(uuid string, d *nvml.Device) ([]gpuProcess, error)
+}
+
+// containerResolver lists the containers known to the container runtime,
+// keyed by container ID.
+type containerResolver interface {
+	containers() (map[string]ContainerID, error)
+}
+
+// processCollector maps the processes running on the GPUs to the containers
+// that started them, using /proc/<pid>/cgroup and the container runtime.
+// Unlike the pod-resources based metrics, it also covers containers which got
+// access to a GPU without the device plugin, e.g. through NRI device injection.
+type processCollector struct {
+	procRoot  string
+	processes gpuProcessLister
+	resolver  containerResolver
+}
+
+func newProcessCollector(criEndpoint string) *processCollector {
+	return &processCollector{
+		procRoot:  "/proc",
+		processes: newNvmlProcessLister(),
+		resolver:  &criContainerResolver{endpoint: criEndpoint},
+	}
+}
+
+// containerUsage is the GPU usage of a container on one device.
+type containerUsage struct {
+	usedMemory uint64
+	smUtil     uint
+}
+
+// containerProcess is a process of a container running on a GPU.
+type containerProcess struct {
+	gpuProcess
+	container ContainerID
+	device    string
+}
+
+// collect returns the processes of the containers running on the GPUs.
+func (p *processCollector) collect(gpuDevices map[string]*nvml.Device, infos func(device string, d *nvml.Device) (metricsInfo, error)) ([]containerProcess, map[string]metricsInfo, error) {
+	containers, err := p.resolver.containers()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	var containerProcesses []containerProcess
+	deviceInfos := make(map[string]metricsInfo)
+	for device, d := range gpuDevices {
+		mi, err := infos(device, d)
+		if err != nil {
+			glog.Infof("Failed to get info of device %s: %v. Skipping process metrics for this device", device, err)
+			continue
+		}
+		processes, err := p.processes.gpuProcesses(mi.uuid, d)
+		if err != nil {
+			glog.Infof("Failed to list processes of device %s: %v", device, err)
+			continue
+		}
+		deviceInfos[device] = mi
+		for _, proc := range processes {
+			containerID, err := containerIDForPid(p.procRoot, proc.pid)
+			if err != nil {
+				glog.V(4).Infof("Failed to find container of process %d: %v", proc.pid, err)
+				continue
+			}
+			container, ok := containers[containerID]
+			if !ok {
+				glog.V(4).Infof("Process %d belongs to unknown container %s", proc.pid, containerID)
+				continue
+			}
+			containerProcesses = append(containerProcesses, containerProcess{gpuProcess: proc, container: container, device: device})
+		}
+	}
+	return containerProcesses, deviceInfos, nil
+}
+
+// containerUsages sums the GPU usage of the processes per container and device.
+func containerUsages(processes []containerProcess) map[ContainerID]map[string]containerUsage {
+	usage := make(map[ContainerID]map[string]containerUsage)
+	for _, proc := range processes {
+		if usage[proc.container] == nil {
+			usage[proc.container] = make(map[string]containerUsage)
+		}
+		u := usage[proc.container][proc.device]
+		u.usedMemory += proc.usedMemory
+		u.smUtil += proc.smUtil
+		usage[proc.container][proc.device] = u
+	}
+	return usage
+}
+
+// containerIDForPid returns the ID of the container a process belongs to by
+// parsing /proc/<pid>/cgroup.
+func containerIDForPid(procRoot string, pid uint32) (string, error) {
+	f, err := os.Open(filepath.Join(procRoot, fmt.Sprint(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line is hierarchy-ID:controller-list:cgroup-path.
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if m := cgroupContainerIDRegex.FindStringSubmatch(fields[2]); m != nil {
+			return m[1], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no container ID in cgroup of process %d", pid)
+}
+
+// nvmlProcessLister lists GPU processes with NVML. It remembers the timestamp
+// of the last process utilization sample per device, so that each sample is
+// used by exactly one collection.
+type nvmlProcessLister struct {
+	lastSeen map[string]uint64
+}
+
+func newNvmlProcessLister() *nvmlProcessLister {
+	return &nvmlProcessLister{lastSeen: make(map[string]uint64)}
+}
+
+func (l *nvmlProcessLister) gpuProcesses(uuid string, d *nvml.Device) ([]gpuProcess, error) {
+	compute, ret := d.GetComputeRunningProcesses()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get compute processes: %v", nvml.ErrorString(ret))
+	}
+	graphics, ret := d.GetGraphicsRunningProcesses()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get graphics processes: %v", nvml.ErrorString(ret))
+	}
+
+	// A process using both compute and graphics is listed twice with the
+	// same memory usage.
+	byPid := make(map[uint32]*gpuProcess)
+	var processes []*gpuProcess
+	for _, info := range append(compute, graphics...) {
+		if _, ok := byPid[info.Pid]; ok {
+			continue
+		}
+		proc := &gpuProcess{pid: info.Pid, usedMemory: info.UsedGpuMemory}
+		byPid[info.Pid] = proc
+		processes = append(processes, proc)
+	}
+
+	samples, ret := d.GetProcessUtilization(l.lastSeen[uuid])
+	switch ret {
+	case nvml.SUCCESS:
+		sums := make(map[uint32]uint)
+		counts := make(map[uint32]uint)
+		for _, s := range samples {
+			if s.TimeStamp > l.lastSeen[uuid] {
+				l.lastSeen[uuid] = s.TimeStamp
+			}
+			sums[s.Pid] += uint(s.SmUtil)
+			counts[s.Pid]++
+		}
+		for pid, sum := range sums {
+			if proc, ok := byPid[pid]; ok {
+				proc.smUtil = sum / counts[pid]
+			}
+		}
+	case nvml.ERROR_NOT_FOUND:
+		// No samples since the last collection.
+	default:
+		glog.V(3).Infof("Failed to get process utilization of device %s: %v", uuid, nvml.ErrorString(ret))
+	}
+
+	result := make([]gpuProcess, 0, len(processes))
+	for _, proc := range processes {
+		result = append(result, *proc)
+	}
+	return result, nil
+}
+
+// criContainerResolver lists containers through the CRI runtime service. The
+// gRPC connection is created on first use and reused by every collection, gRPC
+// reconnecting in the background if the runtime restarts.
+type criContainerResolver struct {
+	endpoint string
+
+	conn   *grpc.ClientConn
+	client criapi.RuntimeServiceClient
+}
+
+func (r *criContainerResolver) containers() (map[string]ContainerID, error) {
+	if r.client == nil {
+		conn, err := grpc.NewClient(
+			"passthrough:///"+strings.TrimPrefix(r.endpoint, "unix://"),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+			}))
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to container runtime at %s: %v", r.endpoint, err)
+		}
+		r.conn = conn
+		r.client = criapi.NewRuntimeServiceClient(conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectionTimeout)
+	defer cancel()
+	resp, err := r.client.ListContainers(ctx, &criapi.ListContainersRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %v", err)
+	}
+
+	containers := make(map[string]ContainerID, len(resp.Containers))
+	for _, c := range resp.Containers {
+		containers[c.Id] = ContainerID{
+			namespace: c.Labels[criPodNamespaceLabel],
+			pod:       c.Labels[criPodNameLabel],
+			container: c.Labels[criContainerLabel],
+		}
+	}
+	return containers, nil
+}
+
+// Close closes the connection to the container runtime.
+func (r *criContainerResolver) Close() error {
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn, r.client = nil, nil
+	return err
+}
+
+// close releases the resources of the resolver, if any.
+func (p *processCollector) close() {
+	c, ok := p.resolver.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := c.Close(); err != nil {
+		glog.Warningf("Failed to close grpc connection to container runtime: %v", err)
+	}
+}
+
+// updateProcessMetrics updates the per container process metrics.
+func updateProcessMetrics(usage map[ContainerID]map[string]containerUsage, infos map[string]metricsInfo) {
+	for container, devices := range usage {
+		for device, u := range devices {
+			mi := infos[device]
+			ProcessMemoryUsed.WithLabelValues(container.namespace, container.pod, container.container, "nvidia", mi.uuid, mi.deviceModel).Set(float64(u.usedMemory))
+			ProcessSMUtilization.WithLabelValues(container.namespace, container.pod, container.container, "nvidia", mi.uuid, mi.deviceModel).Set(float64(u.smUtil))
+		}
+	}
+}
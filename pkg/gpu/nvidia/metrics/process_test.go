@@ -0,0 +1,201 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const (
+	containerA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	containerB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+type fakeProcessLister map[string][]gpuProcess
+
+func (f fakeProcessLister) gpuProcesses(uuid string, d *nvml.Device) ([]gpuProcess, error) {
+	return f[uuid], nil
+}
+
+type fakeContainerResolver map[string]ContainerID
+
+func (f fakeContainerResolver) containers() (map[string]ContainerID, error) {
+	return f, nil
+}
+
+func writeCgroup(t *testing.T, procRoot, pid, content string) {
+	t.Helper()
+	dir := filepath.Join(procRoot, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerIDForPid(t *testing.T) {
+	procRoot := t.TempDir()
+	for _, tc := range []struct {
+		name    string
+		cgroup  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "cgroup v2 systemd driver",
+			cgroup: "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/cri-containerd-" + containerA + ".scope\n",
+			want:   containerA,
+		},
+		{
+			name: "cgroup v1 cgroupfs driver",
+			cgroup: strings.Join([]string{
+				"12:devices:/kubepods/besteffort/pod1234/" + containerB,
+				"11:memory:/kubepods/besteffort/pod1234/" + containerB,
+			}, "\n"),
+			want: containerB,
+		},
+		{
+			name:    "host process",
+			cgroup:  "0::/system.slice/sshd.service\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeCgroup(t, procRoot, "42", tc.cgroup)
+			got, err := containerIDForPid(procRoot, 42)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("containerIDForPid() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("containerIDForPid() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProcessMetricsUpdate(t *testing.T) {
+	procRoot := t.TempDir()
+	writeCgroup(t, procRoot, "1", "0::/kubepods.slice/cri-containerd-"+containerA+".scope\n")
+	writeCgroup(t, procRoot, "2", "0::/kubepods.slice/cri-containerd-"+containerA+".scope\n")
+	writeCgroup(t, procRoot, "3", "0::/kubepods.slice/cri-containerd-"+containerB+".scope\n")
+	writeCgroup(t, procRoot, "4", "0::/system.slice/Xorg.service\n")
+
+	gmc = &mockCollector{}
+	ms := MetricServer{processes: &processCollector{
+		procRoot: procRoot,
+		processes: fakeProcessLister{
+			"656547758": {{pid: 1, usedMemory: 10, smUtil: 20}, {pid: 2, usedMemory: 5, smUtil: 30}, {pid: 4, usedMemory: 100}},
+			"850729563": {{pid: 3, usedMemory: 70, smUtil: 5}},
+		},
+		resolver: fakeContainerResolver{
+			containerA: {namespace: "default", pod: "pod1", container: "container1"},
+			// Containers using devices which are not in pod-resources,
+			// e.g. injected through NRI, are reported as well.
+			containerB: {namespace: "nri", pod: "pod3", container: "container3"},
+		},
+	}}
+	ms.updateMetrics(map[ContainerID][]string{}, map[string]*nvml.Device{"nvidia0": {}, "nvidia1": {}})
+
+	for _, tc := range []struct {
+		labels []string
+		memory float64
+		smUtil float64
+	}{
+		{labels: []string{"default", "pod1", "container1", "nvidia", "656547758", "model1"}, memory: 15, smUtil: 50},
+		{labels: []string{"nri", "pod3", "container3", "nvidia", "850729563", "model2"}, memory: 70, smUtil: 5},
+	} {
+		if got := testutil.ToFloat64(ProcessMemoryUsed.WithLabelValues(tc.labels...)); got != tc.memory {
+			t.Errorf("ProcessMemoryUsed%v = %v, want %v", tc.labels, got, tc.memory)
+		}
+		if got := testutil.ToFloat64(ProcessSMUtilization.WithLabelValues(tc.labels...)); got != tc.smUtil {
+			t.Errorf("ProcessSMUtilization%v = %v, want %v", tc.labels, got, tc.smUtil)
+		}
+	}
+	// The host process is not attributed to any container.
+	if diff := cmp.Diff(2, testutil.CollectAndCount(ProcessMemoryUsed)); diff != "" {
+		t.Errorf("unexpected number of process memory series (-want +got):\n%s", diff)
+	}
+}
+
+type fakeRuntimeService struct {
+	criapi.UnimplementedRuntimeServiceServer
+}
+
+func (*fakeRuntimeService) ListContainers(context.Context, *criapi.ListContainersRequest) (*criapi.ListContainersResponse, error) {
+	return &criapi.ListContainersResponse{Containers: []*criapi.Container{{
+		Id: containerA,
+		Labels: map[string]string{
+			criPodNamespaceLabel: "default",
+			criPodNameLabel:      "pod1",
+			criContainerLabel:    "container1",
+		},
+	}}}, nil
+}
+
+// countingListener counts the accepted connections.
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+func TestCRIContainerResolverReusesConnection(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "cri.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", socket, err)
+	}
+	counting := &countingListener{Listener: lis}
+	server := grpc.NewServer()
+	criapi.RegisterRuntimeServiceServer(server, &fakeRuntimeService{})
+	go server.Serve(counting)
+	defer server.Stop()
+
+	resolver := &criContainerResolver{endpoint: "unix://" + socket}
+	defer resolver.Close()
+	want := map[string]ContainerID{containerA: {namespace: "default", pod: "pod1", container: "container1"}}
+	for i := 0; i < 3; i++ {
+		got, err := resolver.containers()
+		if err != nil {
+			t.Fatalf("containers() failed: %v", err)
+		}
+		if diff := cmp.Diff(want, got, cmp.AllowUnexported(ContainerID{})); diff != "" {
+			t.Errorf("unexpected containers (-want +got):\n%s", diff)
+		}
+	}
+	if got := counting.accepted.Load(); got != 1 {
+		t.Errorf("container runtime accepted %d connections, want 1", got)
+	}
+}
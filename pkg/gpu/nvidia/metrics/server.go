@@ -0,0 +1,217 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// authCacheTTL is how long the result of a token review and access review is reused.
+const authCacheTTL = time.Minute
+
+// certReloader serves a TLS key pair from disk and reloads it when the files
+// change, e.g. when a mounted Secret is rotated.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certMod  time.Time
+	keyMod   time.Time
+	lastStat time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.getCertificate(nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// getCertificate implements tls.Config.GetCertificate. The files are checked
+// for changes at most once per second.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.cert != nil && now.Sub(r.lastStat) < time.Second {
+		return r.cert, nil
+	}
+	r.lastStat = now
+
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return r.cachedOr(fmt.Errorf("failed to stat TLS certificate %s: %v", r.certFile, err))
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return r.cachedOr(fmt.Errorf("failed to stat TLS key %s: %v", r.keyFile, err))
+	}
+	if r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return r.cachedOr(fmt.Errorf("failed to load TLS key pair: %v", err))
+	}
+	if r.cert != nil {
+		glog.Infof("Reloaded metrics server TLS certificate %s", r.certFile)
+	}
+	r.cert = &cert
+	r.certMod = certInfo.ModTime()
+	r.keyMod = keyInfo.ModTime()
+	return r.cert, nil
+}
+
+// cachedOr keeps serving the previous certificate while a rotation is in
+// progress, and only fails if no certificate was ever loaded.
+func (r *certReloader) cachedOr(err error) (*tls.Certificate, error) {
+	if r.cert != nil {
+		glog.Warningf("Using previous TLS certificate: %v", err)
+		return r.cert, nil
+	}
+	return nil, err
+}
+
+type authResult struct {
+	authenticated bool
+	allowed       bool
+	expiry        time.Time
+}
+
+// kubeAuthorizer authenticates bearer tokens with a TokenReview and authorizes
+// the request path with a SubjectAccessReview, like kube-rbac-proxy does for
+// non-resource URLs.
+type kubeAuthorizer struct {
+	kubeClient kubernetes.Interface
+	now        func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]authResult
+}
+
+func newKubeAuthorizer(kubeClient kubernetes.Interface) *kubeAuthorizer {
+	return &kubeAuthorizer{
+		kubeClient: kubeClient,
+		now:        time.Now,
+		cache:      make(map[string]authResult),
+	}
+}
+
+func (a *kubeAuthorizer) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if token == "" || !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		res, err := a.authorize(r.Context(), token, r.URL.Path, strings.ToLower(r.Method))
+		if err != nil {
+			glog.Errorf("Failed to authorize metrics request: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !res.authenticated {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !res.allowed {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *kubeAuthorizer) authorize(ctx context.Context, token, path, verb string) (authResult, error) {
+	// Key on a hash of the token so that the bearer tokens are not kept in memory.
+	sum := sha256.Sum256([]byte(token))
+	key := verb + " " + path + " " + hex.EncodeToString(sum[:])
+	a.mu.Lock()
+	if res, ok := a.cache[key]; ok && a.now().Before(res.expiry) {
+		a.mu.Unlock()
+		return res, nil
+	}
+	a.mu.Unlock()
+
+	res, err := a.review(ctx, token, path, verb)
+	if err != nil {
+		return authResult{}, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	for k, res := range a.cache {
+		if now.After(res.expiry) {
+			delete(a.cache, k)
+		}
+	}
+	res.expiry = now.Add(authCacheTTL)
+	a.cache[key] = res
+	return res, nil
+}
+
+func (a *kubeAuthorizer) review(ctx context.Context, token, path, verb string) (authResult, error) {
+	tr, err := a.kubeClient.AuthenticationV1().TokenReviews().Create(ctx, &authnv1.TokenReview{
+		Spec: authnv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return authResult{}, fmt.Errorf("token review failed: %v", err)
+	}
+	if !tr.Status.Authenticated {
+		return authResult{}, nil
+	}
+
+	extra := make(map[string]authzv1.ExtraValue, len(tr.Status.User.Extra))
+	for k, v := range tr.Status.User.Extra {
+		extra[k] = authzv1.ExtraValue(v)
+	}
+	sar, err := a.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authzv1.SubjectAccessReview{
+		Spec: authzv1.SubjectAccessReviewSpec{
+			User:   tr.Status.User.Username,
+			UID:    tr.Status.User.UID,
+			Groups: tr.Status.User.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authzv1.NonResourceAttributes{
+				Path: path,
+				Verb: verb,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return authResult{}, fmt.Errorf("subject access review failed: %v", err)
+	}
+	return authResult{authenticated: true, allowed: sar.Status.Allowed}, nil
+}
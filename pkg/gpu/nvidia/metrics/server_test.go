@@ -0,0 +1,247 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// freePort returns a TCP port on the loopback interface that is currently unused.
+func freePort(t *testing.T) int {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+// writeKeyPair writes a self-signed certificate for commonName to dir.
+func writeKeyPair(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestMetricServerStartStop(t *testing.T) {
+	port := freePort(t)
+	ms := NewMetricServer(1000, port, "/metrics")
+	ms.SetBindAddress("127.0.0.1")
+	if err := ms.startServer(); err != nil {
+		t.Fatalf("startServer() failed: %v", err)
+	}
+
+	url := "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/metrics"
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET %s = %d, want 200", url, resp.StatusCode)
+	}
+
+	ms.Stop()
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("GET %s succeeded after Stop()", url)
+	}
+
+	// The server can be started again once stopped.
+	if err := ms.startServer(); err != nil {
+		t.Fatalf("startServer() after Stop() failed: %v", err)
+	}
+	ms.Stop()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeKeyPair(t, dir, "first")
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader() failed: %v", err)
+	}
+	commonName := func() string {
+		t.Helper()
+		cert, err := r.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("getCertificate() failed: %v", err)
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Subject.CommonName
+	}
+	if got := commonName(); got != "first" {
+		t.Errorf("certificate common name = %s, want first", got)
+	}
+
+	writeKeyPair(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	r.lastStat = time.Time{}
+	if got := commonName(); got != "second" {
+		t.Errorf("certificate common name after rotation = %s, want second", got)
+	}
+
+	// A broken rotation keeps serving the previous certificate.
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute))
+	r.lastStat = time.Time{}
+	if got := commonName(); got != "second" {
+		t.Errorf("certificate common name after failed rotation = %s, want second", got)
+	}
+
+	if _, err := newCertReloader(filepath.Join(dir, "missing.crt"), keyFile); err == nil {
+		t.Errorf("newCertReloader() with missing files succeeded, want error")
+	}
+}
+
+func TestMetricServerTLS(t *testing.T) {
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), "metrics")
+	port := freePort(t)
+	ms := NewMetricServer(1000, port, "/metrics")
+	ms.SetBindAddress("127.0.0.1")
+	ms.EnableTLS(certFile, keyFile)
+	if err := ms.startServer(); err != nil {
+		t.Fatalf("startServer() failed: %v", err)
+	}
+	defer ms.Stop()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port)) + "/metrics")
+	if err != nil {
+		t.Fatalf("GET over TLS failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET over TLS = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestMetricServerAuthorizationRequiresTLS(t *testing.T) {
+	ms := NewMetricServer(1000, freePort(t), "/metrics")
+	ms.SetBindAddress("127.0.0.1")
+	ms.EnableAuthorization(fake.NewSimpleClientset())
+	if err := ms.startServer(); err == nil {
+		ms.Stop()
+		t.Fatalf("startServer() with authorization and without TLS succeeded, want error")
+	}
+
+	certFile, keyFile := writeKeyPair(t, t.TempDir(), "metrics")
+	ms.EnableTLS(certFile, keyFile)
+	if err := ms.startServer(); err != nil {
+		t.Fatalf("startServer() with authorization and TLS failed: %v", err)
+	}
+	ms.Stop()
+}
+
+func TestKubeAuthorizer(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	reviews := 0
+	kubeClient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		tr := action.(k8stesting.CreateAction).GetObject().(*authnv1.TokenReview)
+		if tr.Spec.Token == "valid" || tr.Spec.Token == "forbidden" {
+			tr.Status.Authenticated = true
+			tr.Status.User.Username = tr.Spec.Token
+		}
+		return true, tr, nil
+	})
+	kubeClient.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authzv1.SubjectAccessReview)
+		attrs := sar.Spec.NonResourceAttributes
+		sar.Status.Allowed = sar.Spec.User == "valid" && attrs.Path == "/metrics" && attrs.Verb == "get"
+		return true, sar, nil
+	})
+
+	handler := newKubeAuthorizer(kubeClient).wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tc := range []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "basic auth", header: "Basic dXNlcjpwYXNz", want: http.StatusUnauthorized},
+		{name: "invalid token", header: "Bearer invalid", want: http.StatusUnauthorized},
+		{name: "not allowed", header: "Bearer forbidden", want: http.StatusForbidden},
+		{name: "allowed", header: "Bearer valid", want: http.StatusOK},
+		{name: "allowed cached", header: "Bearer valid", want: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+	if reviews != 3 {
+		t.Errorf("%d token reviews, want 3 (results are cached)", reviews)
+	}
+}
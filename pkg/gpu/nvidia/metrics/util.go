@@ -25,32 +25,39 @@ package metrics
 #include "../../../../vendor/github.com/NVIDIA/go-nvml/pkg/nvml/nvml.h"
 
 // This function is here because the API provided by NVML is not very user
-// friendly. This function can be used to get average utilization for a gpu.
+// friendly. This function can be used to get the utilization samples of a gpu.
 //
 // `uuid`: The uuid identifier of the target GPU device.
-// `lastSeenTimeStamp`: Return average using samples with timestamp greather than this timestamp. Unix epoch in micro seconds.
-// `averageUsage`: Reference in which average is returned.
+// `lastSeenTimeStamp`: Return samples with timestamp greater than this timestamp. Unix epoch in micro seconds.
+// `samples`: Reference in which the samples are returned. It is allocated
+//            with malloc and must be released by the caller, it is set to
+//            NULL when no samples are available.
+// `sampleCount`: Reference in which the number of returned samples is stored.
 //
 // In my experiments, I found that NVML_GPU_UTILIZATION_SAMPLES buffer stores
 // 100 samples that are uniformly spread with ~6 samples per second. So the
 // buffer stores last ~16s of data.
-nvmlReturn_t nvmlDeviceGetAverageUsage(char *uuid, unsigned long long lastSeenTimeStamp, unsigned int* averageUsage, unsigned int* sumValue, unsigned int* sampleCountValue) {
+nvmlReturn_t nvmlDeviceGetUtilizationSamples(char *uuid, unsigned long long lastSeenTimeStamp, nvmlSample_t** samples, unsigned int* sampleCount) {
   nvmlValueType_t sampleValType;
+  nvmlDevice_t device;
 
-  // This will be set to the number of samples that can be queried. We would
-  // need to allocate an array of this size to store the samples.
-  unsigned int sampleCount;
+  *samples = NULL;
+  *sampleCount = 0;
 
-  nvmlDevice_t device;
   nvmlReturn_t r = nvmlDeviceGetHandleByUUID(uuid, &device);
   if (r != NVML_SUCCESS) {
-	  return r;
+    return r;
   }
 
   // Invoking this method with `samples` set to NULL, to get the size of samples that user needs to allocate.
   // The returned samplesCount will provide the number of samples that can be queried. The user needs to
   // allocate the buffer with size as samplesCount * sizeof(nvmlSample_t).
-  r = nvmlDeviceGetSamples(device, NVML_GPU_UTILIZATION_SAMPLES, lastSeenTimeStamp, &sampleValType, &sampleCount, NULL);
+  unsigned int count = 0;
+  r = nvmlDeviceGetSamples(device, NVML_GPU_UTILIZATION_SAMPLES, lastSeenTimeStamp, &sampleValType, &count, NULL);
+  if (r == NVML_ERROR_NOT_FOUND) {
+    // No samples newer than lastSeenTimeStamp.
+    return NVML_SUCCESS;
+  }
   if (r != NVML_SUCCESS) {
     // @return
     //      - \ref NVML_SUCCESS                 if samples are successfully retrieved
@@ -63,51 +70,66 @@ nvmlReturn_t nvmlDeviceGetAverageUsage(char *uuid, unsigned long long lastSeenTi
     //      - \ref NVML_ERROR_UNKNOWN           on any unexpected error
     return r;
   }
-  // Allocate memory to store sampleCount samples.
+  if (count == 0) {
+    return NVML_SUCCESS;
+  }
+
   // In my experiments, the sampleCount at this stage was always 120 for
-  // NVML_TOTAL_POWER_SAMPLES and 100 for NVML_GPU_UTILIZATION_SAMPLES
-  // The reference to a sampleCount will not be 0, otherwise if will have NVML_ERROR_INVALID_ARGUMENT error
-  nvmlSample_t* samples = (nvmlSample_t*) malloc(sampleCount * sizeof(nvmlSample_t));
-  r = nvmlDeviceGetSamples(device, NVML_GPU_UTILIZATION_SAMPLES, lastSeenTimeStamp, &sampleValType, &sampleCount, samples);
+  // NVML_TOTAL_POWER_SAMPLES and 100 for NVML_GPU_UTILIZATION_SAMPLES.
+  nvmlSample_t* buf = (nvmlSample_t*) malloc(count * sizeof(nvmlSample_t));
+  if (buf == NULL) {
+    return NVML_ERROR_MEMORY;
+  }
+  r = nvmlDeviceGetSamples(device, NVML_GPU_UTILIZATION_SAMPLES, lastSeenTimeStamp, &sampleValType, &count, buf);
+  if (r == NVML_ERROR_NOT_FOUND) {
+    free(buf);
+    return NVML_SUCCESS;
+  }
   if (r != NVML_SUCCESS) {
-    free(samples);
+    free(buf);
     return r;
   }
-  int i = 0;
-  unsigned int sum = 0;
-  for (; i < sampleCount; i++) {
   // Power, Utilization and Clock samples are returned as type "unsigned int" for the union nvmlValue_t.
-    sum += samples[i].sampleValue.uiVal;
+  if (sampleValType != NVML_VALUE_TYPE_UNSIGNED_INT) {
+    free(buf);
+    return NVML_ERROR_UNKNOWN;
   }
-  *averageUsage = sum/sampleCount;
-  *sumValue = sum;
-  *sampleCountValue = sampleCount;
-  free(samples);
-  return r;
+  *samples = buf;
+  *sampleCount = count;
+  return NVML_SUCCESS;
 }
 */
 import "C"
 import (
 	"fmt"
-	"time"
 	"unsafe"
 )
 
-// AverageGPUUtilization reports the average GPU utilization over the last 10 seconds.
-func AverageGPUUtilization(uuid string, since time.Duration) (uint, error) {
-	lastTs := C.ulonglong(time.Now().Add(-1*since).UnixNano() / 1000)
+// nvmlUtilizationSampler reads GPU utilization samples from NVML.
+type nvmlUtilizationSampler struct{}
+
+func (nvmlUtilizationSampler) utilizationSamples(uuid string, lastSeenTimestamp uint64) ([]utilizationSample, error) {
 	uuidCStr := C.CString(uuid)
-	var util C.uint
-	var sum C.uint
+	defer C.free(unsafe.Pointer(uuidCStr))
+
+	var samples *C.nvmlSample_t
 	var sampleCount C.uint
-	r := C.nvmlDeviceGetAverageUsage(uuidCStr, lastTs, &util, &sum, &sampleCount)
-	C.free(unsafe.Pointer(uuidCStr))
+	r := C.nvmlDeviceGetUtilizationSamples(uuidCStr, C.ulonglong(lastSeenTimestamp), &samples, &sampleCount)
 	if r != C.NVML_SUCCESS {
-		return 0, fmt.Errorf("failed to get GPU utilization for device %s, nvml return code: %v", uuid, r)
+		return nil, fmt.Errorf("failed to get GPU utilization samples for device %s, nvml return code: %v", uuid, r)
+	}
+	if samples == nil {
+		return nil, nil
 	}
-	averageUtilization := uint(util)
-	if averageUtilization > 100 || averageUtilization < 0 {
-		return 0, fmt.Errorf("failed to get GPU utilization for device %s, out of range [0, 100] utilization: %d, sum: %d, sampleCount: %d", uuid, averageUtilization, uint(sum), uint(sampleCount))
+	defer C.free(unsafe.Pointer(samples))
+
+	cSamples := unsafe.Slice(samples, int(sampleCount))
+	result := make([]utilizationSample, 0, len(cSamples))
+	for _, s := range cSamples {
+		result = append(result, utilizationSample{
+			timestamp: uint64(s.timeStamp),
+			value:     uint32(*(*C.uint)(unsafe.Pointer(&s.sampleValue))),
+		})
 	}
-	return averageUtilization, nil
+	return result, nil
 }
@@ -0,0 +1,143 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// utilizationSample is a single GPU utilization sample reported by NVML.
+type utilizationSample struct {
+	// timestamp is the CPU timestamp of the sample in microseconds.
+	timestamp uint64
+	// value is the GPU utilization in percent.
+	value uint32
+}
+
+// utilizationSampler returns the GPU utilization samples of a device that
+// are newer than lastSeenTimestamp (Unix epoch in microseconds).
+type utilizationSampler interface {
+	utilizationSamples(uuid string, lastSeenTimestamp uint64) ([]utilizationSample, error)
+}
+
+// utilizationStats summarizes the utilization samples of one collection interval.
+type utilizationStats struct {
+	average uint
+	p50     uint
+	p95     uint
+	max     uint
+	// sampleCount is the number of samples of the interval, zero when the
+	// stats are those of a previous interval.
+	sampleCount int
+}
+
+// utilizationTracker remembers the timestamp of the last sample seen for
+// every device, so that each sample is consumed by exactly one collection
+// interval.
+type utilizationTracker struct {
+	sampler utilizationSampler
+	// window is used to bound the samples of the first collection of a device.
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	lastSeen map[string]uint64
+	// last holds the stats of the last interval with samples of every device.
+	last map[string]utilizationStats
+}
+
+func newUtilizationTracker(sampler utilizationSampler, window time.Duration) *utilizationTracker {
+	return &utilizationTracker{
+		sampler:  sampler,
+		window:   window,
+		now:      time.Now,
+		lastSeen: make(map[string]uint64),
+		last:     make(map[string]utilizationStats),
+	}
+}
+
+// collect returns the utilization statistics of the samples reported since
+// the previous call for the same device. When there is no new sample, e.g.
+// because NVML samples less often than the collection interval, it returns the
+// statistics of the last interval with samples without a sample count, or zero
+// statistics if the device never reported any.
+func (u *utilizationTracker) collect(uuid string) (utilizationStats, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	lastSeen, ok := u.lastSeen[uuid]
+	if !ok {
+		lastSeen = uint64(u.now().Add(-u.window).UnixMicro())
+	}
+	samples, err := u.sampler.utilizationSamples(uuid, lastSeen)
+	if err != nil {
+		return utilizationStats{}, err
+	}
+
+	values := make([]uint, 0, len(samples))
+	for _, s := range samples {
+		if s.timestamp <= lastSeen {
+			continue
+		}
+		if s.timestamp > u.lastSeen[uuid] {
+			u.lastSeen[uuid] = s.timestamp
+		}
+		if s.value > 100 {
+			glog.V(3).Infof("Ignoring out of range [0, 100] utilization sample %d for device %s", s.value, uuid)
+			continue
+		}
+		values = append(values, uint(s.value))
+	}
+	if len(values) == 0 {
+		glog.V(3).Infof("No new GPU utilization samples for device %s", uuid)
+		stats := u.last[uuid]
+		stats.sampleCount = 0
+		return stats, nil
+	}
+	stats := computeUtilizationStats(values)
+	u.last[uuid] = stats
+	return stats, nil
+}
+
+// computeUtilizationStats returns the average, nearest-rank percentiles and
+// maximum of values. values must not be empty.
+func computeUtilizationStats(values []uint) utilizationStats {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	var sum uint64
+	for _, v := range values {
+		sum += uint64(v)
+	}
+	return utilizationStats{
+		average:     uint(sum / uint64(len(values))),
+		p50:         percentile(values, 50),
+		p95:         percentile(values, 95),
+		max:         values[len(values)-1],
+		sampleCount: len(values),
+	}
+}
+
+// percentile returns the p-th percentile of the sorted values using the
+// nearest-rank method.
+func percentile(sorted []uint, p int) uint {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,146 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeSampler returns the samples of a device that are newer than the
+// requested timestamp, like NVML does.
+type fakeSampler struct {
+	samples   map[string][]utilizationSample
+	err       error
+	requested []uint64
+}
+
+func (f *fakeSampler) utilizationSamples(uuid string, lastSeenTimestamp uint64) ([]utilizationSample, error) {
+	f.requested = append(f.requested, lastSeenTimestamp)
+	if f.err != nil {
+		return nil, f.err
+	}
+	var result []utilizationSample
+	for _, s := range f.samples[uuid] {
+		if s.timestamp > lastSeenTimestamp {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func TestUtilizationTrackerConsumesSamplesOnce(t *testing.T) {
+	now := time.UnixMicro(1000)
+	sampler := &fakeSampler{samples: map[string][]utilizationSample{
+		"GPU-1": {{timestamp: 100, value: 10}, {timestamp: 600, value: 20}, {timestamp: 700, value: 30}},
+	}}
+	tracker := newUtilizationTracker(sampler, 500*time.Microsecond)
+	tracker.now = func() time.Time { return now }
+
+	// The first collection only looks back one window.
+	got, err := tracker.collect("GPU-1")
+	if err != nil {
+		t.Fatalf("collect() failed: %v", err)
+	}
+	want := utilizationStats{average: 25, p50: 20, p95: 30, max: 30, sampleCount: 2}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(utilizationStats{})); diff != "" {
+		t.Errorf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	// No new samples since the last collection: the previous stats are reused.
+	got, err = tracker.collect("GPU-1")
+	if err != nil {
+		t.Fatalf("collect() without new samples failed: %v", err)
+	}
+	want.sampleCount = 0
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(utilizationStats{})); diff != "" {
+		t.Errorf("unexpected stats without new samples (-want +got):\n%s", diff)
+	}
+
+	sampler.samples["GPU-1"] = append(sampler.samples["GPU-1"], utilizationSample{timestamp: 900, value: 90})
+	got, err = tracker.collect("GPU-1")
+	if err != nil {
+		t.Fatalf("collect() failed: %v", err)
+	}
+	want = utilizationStats{average: 90, p50: 90, p95: 90, max: 90, sampleCount: 1}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(utilizationStats{})); diff != "" {
+		t.Errorf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]uint64{500, 700, 700}, sampler.requested); diff != "" {
+		t.Errorf("unexpected lastSeenTimestamp requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestUtilizationTrackerErrors(t *testing.T) {
+	sampler := &fakeSampler{err: fmt.Errorf("nvml failure")}
+	tracker := newUtilizationTracker(sampler, time.Second)
+	if _, err := tracker.collect("GPU-1"); err == nil {
+		t.Errorf("collect() succeeded, want sampler error")
+	}
+
+	// Out of range samples are dropped instead of corrupting the average.
+	sampler = &fakeSampler{samples: map[string][]utilizationSample{
+		"GPU-1": {{timestamp: uint64(time.Now().UnixMicro()) + 1, value: 4000000000}},
+	}}
+	tracker = newUtilizationTracker(sampler, time.Second)
+	got, err := tracker.collect("GPU-1")
+	if err != nil {
+		t.Fatalf("collect() with only invalid samples failed: %v", err)
+	}
+	if diff := cmp.Diff(utilizationStats{}, got, cmp.AllowUnexported(utilizationStats{})); diff != "" {
+		t.Errorf("unexpected stats with only invalid samples (-want +got):\n%s", diff)
+	}
+}
+
+func TestComputeUtilizationStats(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		values []uint
+		want   utilizationStats
+	}{
+		{
+			name:   "single sample",
+			values: []uint{42},
+			want:   utilizationStats{average: 42, p50: 42, p95: 42, max: 42, sampleCount: 1},
+		},
+		{
+			name:   "unsorted samples",
+			values: []uint{100, 0, 50, 25, 75},
+			want:   utilizationStats{average: 50, p50: 50, p95: 100, max: 100, sampleCount: 5},
+		},
+		{
+			name: "full NVML buffer does not overflow",
+			values: func() []uint {
+				v := make([]uint, 100)
+				for i := range v {
+					v[i] = uint(i + 1)
+				}
+				return v
+			}(),
+			want: utilizationStats{average: 50, p50: 50, p95: 95, max: 100, sampleCount: 100},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := computeUtilizationStats(tc.values)
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(utilizationStats{})); diff != "" {
+				t.Errorf("unexpected stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -89,15 +89,17 @@ type DeviceManager struct {
 	procDirectory     string
 	gpuPartitionSpecs map[string][]pluginapi.DeviceSpec
 	gpuPartitions     map[string]pluginapi.Device
+	nvmlOps           nvmlutil.NvmlOperations
 }
 
 // NewDeviceManager creates a new DeviceManager to handle MIG devices on the node.
-func NewDeviceManager(devDirectory, procDirectory string) DeviceManager {
+func NewDeviceManager(devDirectory, procDirectory string, nvmlOps nvmlutil.NvmlOperations) DeviceManager {
 	return DeviceManager{
 		devDirectory:      devDirectory,
 		procDirectory:     procDirectory,
 		gpuPartitionSpecs: make(map[string][]pluginapi.DeviceSpec),
 		gpuPartitions:     make(map[string]pluginapi.Device),
+		nvmlOps:           nvmlOps,
 	}
 }
 
@@ -297,12 +299,9 @@ func (d *DeviceManager) topology(deviceIndex string) (*pluginapi.TopologyInfo, e
 		return nil, fmt.Errorf("unable to convert deviceIndex %q string to int: %v", deviceIndex, err)
 	}
 
-	if nvmlutil.NvmlDeviceInfo == nil {
-		nvmlutil.NvmlDeviceInfo = &nvmlutil.DeviceInfo{}
-	}
-	device, ret := nvmlutil.NvmlDeviceInfo.DeviceHandleByIndex(index)
+	device, ret := d.nvmlOps.DeviceHandleByIndex(index)
 	if ret != nvml.SUCCESS {
 		return nil, fmt.Errorf("failed to get mig device handle: %v", nvml.ErrorString(ret))
 	}
-	return nvmlutil.Topology(device, pciDevicesRoot)
+	return nvmlutil.Topology(d.nvmlOps, device, pciDevicesRoot)
 }
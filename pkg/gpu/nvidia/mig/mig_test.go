@@ -81,10 +81,7 @@ func TestDiscoverGPUPartitions(t *testing.T) {
 		}
 	}
 
-	// overriding nvmlutil.NvmlDeviceInfo to nvmlutil.MockDeviceInfo interface
-	nvmlutil.NvmlDeviceInfo = &nvmlutil.MockDeviceInfo{}
-
-	deviceManager := NewDeviceManager(testDevDir, testProcDir)
+	deviceManager := NewDeviceManager(testDevDir, testProcDir, &nvmlutil.MockDeviceInfo{})
 	if err := deviceManager.Start("3g.20gb"); err != nil {
 		t.Errorf("Mig device manager failed to start: %v", err)
 	}
@@ -0,0 +1,386 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvidia
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/nvmlutil"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/golang/glog"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	mpsPipeDirEnv = "CUDA_MPS_PIPE_DIRECTORY"
+	mpsLogDirEnv  = "CUDA_MPS_LOG_DIRECTORY"
+
+	mpsHealthCheckInterval = 30 * time.Second
+	mpsReadyTimeout        = 30 * time.Second
+	mpsReadyPollInterval   = 500 * time.Millisecond
+	mpsStopTimeout         = 10 * time.Second
+	mpsMinRestartBackoff   = 1 * time.Second
+	mpsMaxRestartBackoff   = 2 * time.Minute
+)
+
+// errMPSStopped is returned when the daemon manager is stopped while a daemon is starting.
+var errMPSStopped = errors.New("MPS daemon manager stopped")
+
+// mpsProcess is a running MPS control daemon.
+type mpsProcess interface {
+	Wait() error
+	Kill() error
+}
+
+// mpsRunner starts MPS control daemons and sends commands to them.
+type mpsRunner interface {
+	// Start starts a control daemon in the foreground with the given environment.
+	Start(env []string) (mpsProcess, error)
+	// Control sends a command to the control daemon selected by the environment and returns its reply.
+	Control(env []string, command string) (string, error)
+}
+
+type execMPSRunner struct{}
+
+func (execMPSRunner) Start(env []string) (mpsProcess, error) {
+	cmd := exec.Command(mpsControlBin, "-f")
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &execMPSProcess{cmd: cmd}, nil
+}
+
+func (execMPSRunner) Control(env []string, command string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(mpsControlBin)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(command + "\n")
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%q failed: %v, output: %s", command, err, out.String())
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+type execMPSProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p *execMPSProcess) Wait() error {
+	return p.cmd.Wait()
+}
+
+func (p *execMPSProcess) Kill() error {
+	return p.cmd.Process.Kill()
+}
+
+// mpsPipeDir returns the directory of the MPS control daemon pipes for a GPU or GPU partition.
+func mpsPipeDir(root, deviceID string) string {
+	return path.Join(root, strings.ReplaceAll(deviceID, "/", "_"))
+}
+
+// mpsDaemonManager starts and supervises one MPS control daemon per GPU or GPU partition.
+type mpsDaemonManager struct {
+	runner     mpsRunner
+	deviceUUID func(deviceID string) (string, error)
+	// setHealth reports whether the control daemon of a GPU or GPU partition is healthy.
+	setHealth func(deviceID string, healthy bool)
+	// pipeDirRoot holds the pipe directory of every control daemon.
+	pipeDirRoot string
+
+	// defaultLimits returns the default active thread percentage and memory limit (in MiB)
+	// of the MPS clients of a GPU or GPU partition.
+	defaultLimits func(deviceID string) (int, uint64)
+
+	checkInterval  time.Duration
+	readyTimeout   time.Duration
+	minRestartWait time.Duration
+
+	mu      sync.Mutex
+	daemons map[string]bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newMPSDaemonManager(setHealth func(deviceID string, healthy bool), defaultLimits func(deviceID string) (int, uint64), nvmlOps nvmlutil.NvmlOperations) *mpsDaemonManager {
+	return &mpsDaemonManager{
+		runner:         execMPSRunner{},
+		deviceUUID:     func(deviceID string) (string, error) { return nvmlDeviceUUID(nvmlOps, deviceID) },
+		setHealth:      setHealth,
+		pipeDirRoot:    nvidiaMpsDir,
+		defaultLimits:  defaultLimits,
+		checkInterval:  mpsHealthCheckInterval,
+		readyTimeout:   mpsReadyTimeout,
+		minRestartWait: mpsMinRestartBackoff,
+		daemons:        make(map[string]bool),
+		stop:           make(chan struct{}),
+	}
+}
+
+// start starts a control daemon for each of the devices which is not supervised yet.
+func (m *mpsDaemonManager) start(devices map[string]pluginapi.Device) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range devices {
+		if m.daemons[id] {
+			continue
+		}
+		uuid, err := m.deviceUUID(id)
+		if err != nil {
+			return fmt.Errorf("failed to get UUID of %s for its MPS control daemon: %v", id, err)
+		}
+		pipeDir := mpsPipeDir(m.pipeDirRoot, id)
+		d := &mpsDaemon{
+			manager:  m,
+			deviceID: id,
+			pipeDir:  pipeDir,
+			env:      []string{"CUDA_VISIBLE_DEVICES=" + uuid, mpsPipeDirEnv + "=" + pipeDir, mpsLogDirEnv + "=" + path.Join(pipeDir, "log")},
+			healthy:  true,
+			backoff:  m.minRestartWait,
+		}
+		m.daemons[id] = true
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			d.run()
+		}()
+		glog.Infof("Started supervising MPS control daemon for %s in %s", id, pipeDir)
+	}
+	return nil
+}
+
+// stopAll stops all control daemons and waits for their supervisors to exit.
+func (m *mpsDaemonManager) stopAll() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// mpsDaemon supervises the control daemon of a single GPU or GPU partition.
+type mpsDaemon struct {
+	manager  *mpsDaemonManager
+	deviceID string
+	pipeDir  string
+	env      []string
+	healthy  bool
+	backoff  time.Duration
+}
+
+// run keeps the control daemon running until the manager is stopped, and
+// reports the device unhealthy while the daemon is down.
+func (d *mpsDaemon) run() {
+	for {
+		err := d.serve()
+		if err == nil {
+			return
+		}
+		glog.Errorf("MPS control daemon for %s failed, restarting in %v: %v", d.deviceID, d.backoff, err)
+		d.setHealth(pluginapi.Unhealthy)
+		select {
+		case <-d.manager.stop:
+			return
+		case <-time.After(d.backoff):
+		}
+		d.backoff *= 2
+		if d.backoff > mpsMaxRestartBackoff {
+			d.backoff = mpsMaxRestartBackoff
+		}
+	}
+}
+
+// serve starts the control daemon, configures it and health checks it until
+// it fails, which is returned, or the manager is stopped.
+func (d *mpsDaemon) serve() error {
+	if err := os.MkdirAll(path.Join(d.pipeDir, "log"), 0755); err != nil {
+		return fmt.Errorf("failed to create MPS pipe directory: %v", err)
+	}
+	proc, err := d.manager.runner.Start(d.env)
+	if err != nil {
+		return fmt.Errorf("failed to start: %v", err)
+	}
+	// exited is closed once the daemon exits, with its error in waitErr.
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = proc.Wait()
+		close(exited)
+	}()
+
+	if err := d.configure(exited); err != nil {
+		proc.Kill()
+		<-exited
+		if err == errMPSStopped {
+			return nil
+		}
+		return err
+	}
+	d.backoff = d.manager.minRestartWait
+	d.setHealth(pluginapi.Healthy)
+
+	ticker := time.NewTicker(d.manager.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.manager.stop:
+			if _, err := d.manager.runner.Control(d.env, "quit"); err != nil {
+				glog.Warningf("Failed to quit MPS control daemon for %s: %v", d.deviceID, err)
+			}
+			select {
+			case <-exited:
+			case <-time.After(mpsStopTimeout):
+				proc.Kill()
+				<-exited
+			}
+			return nil
+		case <-exited:
+			return fmt.Errorf("exited: %v", waitErr)
+		case <-ticker.C:
+			if _, err := d.manager.runner.Control(d.env, mpsActiveThreadCmd); err != nil {
+				proc.Kill()
+				<-exited
+				return fmt.Errorf("health check failed: %v", err)
+			}
+		}
+	}
+}
+
+// configure waits for the control daemon to answer and sets the default client limits.
+func (d *mpsDaemon) configure(exited <-chan struct{}) error {
+	deadline := time.Now().Add(d.manager.readyTimeout)
+	for {
+		_, err := d.manager.runner.Control(d.env, mpsActiveThreadCmd)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %v: %v", d.manager.readyTimeout, err)
+		}
+		select {
+		case <-exited:
+			return fmt.Errorf("exited before becoming ready")
+		case <-d.manager.stop:
+			return errMPSStopped
+		case <-time.After(mpsReadyPollInterval):
+		}
+	}
+
+	commands := []string{}
+	threadPercentage, memLimitMB := d.manager.defaultLimits(d.deviceID)
+	if threadPercentage > 0 {
+		commands = append(commands, fmt.Sprintf("set_default_active_thread_percentage %d", threadPercentage))
+	}
+	if memLimitMB > 0 {
+		// Each daemon only sees its own GPU or GPU partition, which is always device 0.
+		commands = append(commands, fmt.Sprintf("set_default_device_pinned_mem_limit 0 %dM", memLimitMB))
+	}
+	for _, command := range commands {
+		if _, err := d.manager.runner.Control(d.env, command); err != nil {
+			return fmt.Errorf("failed to set default limits: %v", err)
+		}
+	}
+	return nil
+}
+
+// setHealth reports a change of the daemon health, which is combined with the health of its device.
+func (d *mpsDaemon) setHealth(health string) {
+	healthy := health == pluginapi.Healthy
+	if healthy == d.healthy {
+		return
+	}
+	d.healthy = healthy
+	d.manager.setHealth(d.deviceID, healthy)
+	glog.Infof("Marked the MPS control daemon of %s as %s", d.deviceID, health)
+}
+
+// nvmlDeviceUUID returns the UUID of a GPU, e.g. nvidia0, or of a GPU partition, e.g. nvidia0/gi1.
+func nvmlDeviceUUID(nvmlOps nvmlutil.NvmlOperations, deviceID string) (string, error) {
+	device, err := nvmlDeviceHandle(nvmlOps, deviceID)
+	if err != nil {
+		return "", err
+	}
+	uuid, ret := nvmlOps.UUID(device)
+	if ret != nvml.SUCCESS {
+		return "", fmt.Errorf("failed to get the UUID of %s: %v", deviceID, nvml.ErrorString(ret))
+	}
+	return uuid, nil
+}
+
+// nvmlDeviceMemory returns the total memory (in bytes) of a GPU or GPU partition.
+func nvmlDeviceMemory(nvmlOps nvmlutil.NvmlOperations, deviceID string) (uint64, error) {
+	device, err := nvmlDeviceHandle(nvmlOps, deviceID)
+	if err != nil {
+		return 0, err
+	}
+	memory, ret := nvmlOps.MemoryInfo(device)
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("failed to get the memory of %s: %v", deviceID, nvml.ErrorString(ret))
+	}
+	return memory.Total, nil
+}
+
+// nvmlDeviceHandle returns the NVML handle of a GPU, e.g. nvidia0, or of a GPU partition, e.g. nvidia0/gi1.
+func nvmlDeviceHandle(nvmlOps nvmlutil.NvmlOperations, deviceID string) (nvml.Device, error) {
+	matches := regexp.MustCompile(`^nvidia([0-9]+)(/gi([0-9]+))?$`).FindStringSubmatch(deviceID)
+	if matches == nil {
+		return nvml.Device{}, fmt.Errorf("invalid device ID %s", deviceID)
+	}
+	minor, _ := strconv.Atoi(matches[1])
+
+	count, ret := nvmlOps.DeviceCount()
+	if ret != nvml.SUCCESS {
+		return nvml.Device{}, fmt.Errorf("failed to enumerate devices: %v", nvml.ErrorString(ret))
+	}
+	for i := 0; i < count; i++ {
+		device, ret := nvmlOps.DeviceHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nvml.Device{}, fmt.Errorf("failed to get the device handle for index %d: %v", i, nvml.ErrorString(ret))
+		}
+		if m, ret := nvmlOps.MinorNumber(device); ret != nvml.SUCCESS || m != minor {
+			continue
+		}
+		if matches[3] == "" {
+			return device, nil
+		}
+
+		gi, _ := strconv.Atoi(matches[3])
+		migCount, ret := nvmlOps.MaxMigDeviceCount(device)
+		if ret != nvml.SUCCESS {
+			return nvml.Device{}, fmt.Errorf("failed to get the MIG device count of %s: %v", deviceID, nvml.ErrorString(ret))
+		}
+		for j := 0; j < migCount; j++ {
+			migDevice, ret := nvmlOps.MigDeviceHandleByIndex(device, j)
+			if ret != nvml.SUCCESS {
+				continue
+			}
+			if id, ret := nvmlOps.GpuInstanceId(migDevice); ret != nvml.SUCCESS || id != gi {
+				continue
+			}
+			return migDevice, nil
+		}
+	}
+	return nvml.Device{}, fmt.Errorf("device %s not found", deviceID)
+}
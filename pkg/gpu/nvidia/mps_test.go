@@ -0,0 +1,265 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvidia
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/nvmlutil"
+	"github.com/google/go-cmp/cmp"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+type fakeMPSProcess struct {
+	once sync.Once
+	exit chan struct{}
+}
+
+func (p *fakeMPSProcess) Wait() error {
+	<-p.exit
+	return errors.New("killed")
+}
+
+func (p *fakeMPSProcess) Kill() error {
+	p.once.Do(func() { close(p.exit) })
+	return nil
+}
+
+type fakeMPSRunner struct {
+	mu        sync.Mutex
+	processes []*fakeMPSProcess
+	envs      [][]string
+	commands  []string
+	// unresponsive makes health checks fail.
+	unresponsive bool
+}
+
+func (r *fakeMPSRunner) Start(env []string) (mpsProcess, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := &fakeMPSProcess{exit: make(chan struct{})}
+	r.processes = append(r.processes, p)
+	r.envs = append(r.envs, env)
+	return p, nil
+}
+
+func (r *fakeMPSRunner) Control(env []string, command string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, command)
+	switch {
+	case command == "quit":
+		r.processes[len(r.processes)-1].Kill()
+	case command == mpsActiveThreadCmd && r.unresponsive:
+		return "", errors.New("no reply")
+	}
+	return "100.0", nil
+}
+
+func (r *fakeMPSRunner) lastProcess() *fakeMPSProcess {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.processes[len(r.processes)-1]
+}
+
+// waitConfigured waits until n daemons set their default limits.
+func (r *fakeMPSRunner) waitConfigured(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		configured := 0
+		for _, c := range r.commands {
+			if strings.HasPrefix(c, "set_default_device_pinned_mem_limit") {
+				configured++
+			}
+		}
+		r.mu.Unlock()
+		if configured >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d MPS control daemons to be configured", n)
+}
+
+func (r *fakeMPSRunner) setUnresponsive(unresponsive bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unresponsive = unresponsive
+}
+
+// mpsHealth is a change of the health of an MPS control daemon.
+type mpsHealth struct {
+	deviceID string
+	healthy  bool
+}
+
+func expectHealth(t *testing.T, health <-chan mpsHealth, want mpsHealth) {
+	t.Helper()
+	select {
+	case got := <-health:
+		if diff := cmp.Diff(want, got, cmp.AllowUnexported(mpsHealth{})); diff != "" {
+			t.Errorf("unexpected MPS control daemon health (-want, +got) = %s", diff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the MPS control daemon of %s to be marked healthy %v", want.deviceID, want.healthy)
+	}
+}
+
+func TestMPSDaemonManager(t *testing.T) {
+	health := make(chan mpsHealth)
+	runner := &fakeMPSRunner{}
+	setHealth := func(deviceID string, healthy bool) { health <- mpsHealth{deviceID: deviceID, healthy: healthy} }
+	m := newMPSDaemonManager(setHealth, func(deviceID string) (int, uint64) { return 10, 8192 }, &nvmlutil.MockDeviceInfo{})
+	m.runner = runner
+	m.deviceUUID = func(deviceID string) (string, error) { return "GPU-" + deviceID, nil }
+	m.pipeDirRoot = t.TempDir()
+	m.checkInterval = 10 * time.Millisecond
+	m.minRestartWait = 10 * time.Millisecond
+
+	if err := m.start(map[string]pluginapi.Device{"nvidia0": {ID: "nvidia0", Health: pluginapi.Healthy}}); err != nil {
+		t.Fatalf("start() failed: %v", err)
+	}
+	// Starting again does not start another daemon for the same device.
+	if err := m.start(map[string]pluginapi.Device{"nvidia0": {ID: "nvidia0", Health: pluginapi.Healthy}}); err != nil {
+		t.Fatalf("start() failed: %v", err)
+	}
+
+	// The daemon crashes, and is restarted.
+	runner.waitConfigured(t, 1)
+	first := runner.lastProcess()
+	first.Kill()
+	expectHealth(t, health, mpsHealth{deviceID: "nvidia0", healthy: false})
+	expectHealth(t, health, mpsHealth{deviceID: "nvidia0", healthy: true})
+	if runner.lastProcess() == first {
+		t.Errorf("MPS control daemon was not restarted")
+	}
+
+	// The daemon stops answering health checks.
+	runner.setUnresponsive(true)
+	expectHealth(t, health, mpsHealth{deviceID: "nvidia0", healthy: false})
+	runner.setUnresponsive(false)
+	expectHealth(t, health, mpsHealth{deviceID: "nvidia0", healthy: true})
+
+	m.stopAll()
+
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	pipeDir := path.Join(m.pipeDirRoot, "nvidia0")
+	wantEnv := []string{"CUDA_VISIBLE_DEVICES=GPU-nvidia0", "CUDA_MPS_PIPE_DIRECTORY=" + pipeDir, "CUDA_MPS_LOG_DIRECTORY=" + path.Join(pipeDir, "log")}
+	if diff := cmp.Diff(wantEnv, runner.envs[0]); diff != "" {
+		t.Errorf("unexpected daemon environment (-want, +got) = %s", diff)
+	}
+	if diff := cmp.Diff([]string{
+		mpsActiveThreadCmd,
+		"set_default_active_thread_percentage 10",
+		"set_default_device_pinned_mem_limit 0 8192M",
+	}, runner.commands[:3]); diff != "" {
+		t.Errorf("unexpected daemon configuration (-want, +got) = %s", diff)
+	}
+	if got := runner.commands[len(runner.commands)-1]; got != "quit" {
+		t.Errorf("last command = %q, want quit", got)
+	}
+}
+
+func TestMPSPipeDir(t *testing.T) {
+	ngm := &nvidiaGPUManager{
+		gpuConfig: GPUConfig{
+			GPUSharingConfig: GPUSharingConfig{
+				GPUSharingStrategy:     "mps",
+				MaxSharedClientsPerGPU: 2,
+				ManageMPSControlDaemon: true,
+			},
+		},
+		totalMemPerGPU: 16 * 1024 * 1024 * 1024,
+	}
+	want := map[string]string{
+		mpsThreadLimitEnv:  "50",
+		mpsMemLimitEnv:     "0=8192M",
+		cudaDeviceOrderEnv: "PCI_BUS_ID",
+		mpsPipeDirEnv:      "/tmp/nvidia-mps/nvidia0_gi1",
+	}
+	if diff := cmp.Diff(want, ngm.Envs([]string{"nvidia0/gi1/vgpu0"})); diff != "" {
+		t.Errorf("unexpected Envs() (-want, +got) = %s", diff)
+	}
+}
+
+func TestNvmlDeviceLookups(t *testing.T) {
+	testDevDir := t.TempDir()
+	for _, device := range []string{"nvidia0", "nvidia1"} {
+		if _, err := os.Create(path.Join(testDevDir, device)); err != nil {
+			t.Fatalf("failed to create device %s: %v", device, err)
+		}
+	}
+	nvmlOps := &nvmlutil.MockDeviceInfo{TestDevDir: testDevDir, TotalMemory: 16 * 1024 * 1024 * 1024}
+
+	uuid, err := nvmlDeviceUUID(nvmlOps, "nvidia1")
+	if err != nil || uuid != "GPU-1" {
+		t.Errorf("nvmlDeviceUUID(nvidia1) = %q, %v, want GPU-1", uuid, err)
+	}
+	if _, err := nvmlDeviceUUID(nvmlOps, "nvidia2"); err == nil {
+		t.Errorf("nvmlDeviceUUID(nvidia2) succeeded for a missing device, want error")
+	}
+	if memory, err := nvmlDeviceMemory(nvmlOps, "nvidia0"); err != nil || memory != nvmlOps.TotalMemory {
+		t.Errorf("nvmlDeviceMemory(nvidia0) = %d, %v, want %d", memory, err, nvmlOps.TotalMemory)
+	}
+	if memory, err := totalMemPerGPU(nvmlOps); err != nil || memory != nvmlOps.TotalMemory {
+		t.Errorf("totalMemPerGPU() = %d, %v, want %d", memory, err, nvmlOps.TotalMemory)
+	}
+}
+
+func TestMPSHealthCombinedWithDeviceHealth(t *testing.T) {
+	ngm := &nvidiaGPUManager{
+		devices: map[string]pluginapi.Device{
+			"nvidia0": {ID: "nvidia0", Health: pluginapi.Healthy},
+			"nvidia1": {ID: "nvidia1", Health: pluginapi.Healthy},
+		},
+	}
+	health := func() map[string]string {
+		got := make(map[string]string)
+		for id, device := range ngm.ListDevices() {
+			got[id] = device.Health
+		}
+		return got
+	}
+
+	// The XID health checker marks nvidia0 unhealthy while its MPS control daemon is down.
+	ngm.setMPSHealth("nvidia0", false)
+	ngm.setMPSHealth("nvidia1", false)
+	ngm.SetDeviceHealth("nvidia0", pluginapi.Unhealthy, nil)
+	if diff := cmp.Diff(map[string]string{"nvidia0": pluginapi.Unhealthy, "nvidia1": pluginapi.Unhealthy}, health()); diff != "" {
+		t.Errorf("unexpected device health with MPS control daemons down (-want, +got) = %s", diff)
+	}
+	if _, err := ngm.DeviceSpec("nvidia1"); err == nil {
+		t.Errorf("DeviceSpec(nvidia1) succeeded while its MPS control daemon is down, want error")
+	}
+
+	// The recovery of the MPS control daemon does not override the XID health.
+	ngm.setMPSHealth("nvidia0", true)
+	ngm.setMPSHealth("nvidia1", true)
+	if diff := cmp.Diff(map[string]string{"nvidia0": pluginapi.Unhealthy, "nvidia1": pluginapi.Healthy}, health()); diff != "" {
+		t.Errorf("unexpected device health with MPS control daemons recovered (-want, +got) = %s", diff)
+	}
+	if _, err := ngm.DeviceSpec("nvidia1"); err != nil {
+		t.Errorf("DeviceSpec(nvidia1) failed: %v", err)
+	}
+}
@@ -17,6 +17,7 @@
 package nvmlutil
 
 import (
+	"fmt"
 	"io/ioutil"
 	"regexp"
 
@@ -29,6 +30,8 @@ type MockDeviceInfo struct {
 	CurrentDevice int
 	TestDevDir    string
 	BusID         [32]int8
+	// TotalMemory is the total memory (in bytes) reported for every device.
+	TotalMemory uint64
 }
 
 func (gpuDeviceInfo *MockDeviceInfo) DeviceCount() (int, nvml.Return) {
@@ -68,3 +71,19 @@ func (gpuDeviceInfo *MockDeviceInfo) MinorNumber(d nvml.Device) (int, nvml.Retur
 func (gpuDeviceInfo *MockDeviceInfo) PciInfo(d nvml.Device) (nvml.PciInfo, nvml.Return) {
 	return nvml.PciInfo{BusId: gpuDeviceInfo.BusID}, nvml.SUCCESS
 }
+
+func (gpuDeviceInfo *MockDeviceInfo) UUID(d nvml.Device) (string, nvml.Return) {
+	return fmt.Sprintf("GPU-%d", gpuDeviceInfo.CurrentDevice), nvml.SUCCESS
+}
+
+func (gpuDeviceInfo *MockDeviceInfo) MemoryInfo(d nvml.Device) (nvml.Memory, nvml.Return) {
+	return nvml.Memory{Total: gpuDeviceInfo.TotalMemory}, nvml.SUCCESS
+}
+
+func (gpuDeviceInfo *MockDeviceInfo) MaxMigDeviceCount(d nvml.Device) (int, nvml.Return) {
+	return 0, nvml.SUCCESS
+}
+
+func (gpuDeviceInfo *MockDeviceInfo) GpuInstanceId(d nvml.Device) (int, nvml.Return) {
+	return 0, nvml.SUCCESS
+}
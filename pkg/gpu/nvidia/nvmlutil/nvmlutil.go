@@ -34,13 +34,12 @@ type NvmlOperations interface {
 	MigMode(nvml.Device) (int, int, nvml.Return)
 	MinorNumber(nvml.Device) (int, nvml.Return)
 	PciInfo(d nvml.Device) (nvml.PciInfo, nvml.Return)
+	UUID(d nvml.Device) (string, nvml.Return)
+	MemoryInfo(d nvml.Device) (nvml.Memory, nvml.Return)
+	MaxMigDeviceCount(d nvml.Device) (int, nvml.Return)
+	GpuInstanceId(d nvml.Device) (int, nvml.Return)
 }
 
-// Declare an interface variable for NVML operations.
-// This allows the interface to be overriden with mock
-// implementations in the tests.
-var NvmlDeviceInfo NvmlOperations
-
 // DeviceInfo is a struct that implements the nvmlOperations interface.
 type DeviceInfo struct{}
 
@@ -73,6 +72,22 @@ func (gpuDeviceInfo *DeviceInfo) PciInfo(d nvml.Device) (nvml.PciInfo, nvml.Retu
 	return d.GetPciInfo()
 }
 
+func (gpuDeviceInfo *DeviceInfo) UUID(d nvml.Device) (string, nvml.Return) {
+	return d.GetUUID()
+}
+
+func (gpuDeviceInfo *DeviceInfo) MemoryInfo(d nvml.Device) (nvml.Memory, nvml.Return) {
+	return d.GetMemoryInfo()
+}
+
+func (gpuDeviceInfo *DeviceInfo) MaxMigDeviceCount(d nvml.Device) (int, nvml.Return) {
+	return d.GetMaxMigDeviceCount()
+}
+
+func (gpuDeviceInfo *DeviceInfo) GpuInstanceId(d nvml.Device) (int, nvml.Return) {
+	return d.GetGpuInstanceId()
+}
+
 // topology determines the NUMA topology information for a GPU device.
 // Returns a TopologyInfo containing the NUMA node ID for the GPU device
 // if NUMA is enabled, nil otherwise.
@@ -85,12 +100,8 @@ func (gpuDeviceInfo *DeviceInfo) PciInfo(d nvml.Device) (nvml.PciInfo, nvml.Retu
 //	        },
 //	    },
 //	}
-func Topology(d nvml.Device, pciDevicesRoot string) (*pluginapi.TopologyInfo, error) {
-	if NvmlDeviceInfo == nil {
-		NvmlDeviceInfo = &DeviceInfo{}
-	}
-
-	numaEnabled, node, err := numaNode(d, pciDevicesRoot)
+func Topology(nvmlOps NvmlOperations, d nvml.Device, pciDevicesRoot string) (*pluginapi.TopologyInfo, error) {
+	numaEnabled, node, err := numaNode(nvmlOps, d, pciDevicesRoot)
 	if err != nil {
 		return nil, err
 	}
@@ -111,11 +122,8 @@ func Topology(d nvml.Device, pciDevicesRoot string) (*pluginapi.TopologyInfo, er
 // numaNode retrieves the NUMA node information for a given GPU device.
 // It first gets the PCI bus ID from the device, formats it appropriately,
 // then reads the NUMA node value from the sysfs filesystem.
-func numaNode(d nvml.Device, pciDevicesRoot string) (numaEnabled bool, numaNode int, err error) {
-	if NvmlDeviceInfo == nil {
-		NvmlDeviceInfo = &DeviceInfo{}
-	}
-	pciInfo, ret := NvmlDeviceInfo.PciInfo(d)
+func numaNode(nvmlOps NvmlOperations, d nvml.Device, pciDevicesRoot string) (numaEnabled bool, numaNode int, err error) {
+	pciInfo, ret := nvmlOps.PciInfo(d)
 	if ret != nvml.SUCCESS {
 		return false, 0, fmt.Errorf("error getting PCI Bus Info of device: %v", ret)
 	}
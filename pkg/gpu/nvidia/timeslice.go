@@ -0,0 +1,194 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvidia
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/container-engine-accelerators/pkg/gpu/nvidia/nvmlutil"
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TimesliceClass is the scheduling timeslice given to each context on a time-shared GPU.
+type TimesliceClass string
+
+const (
+	// TimesliceDefault keeps the timeslice of the driver.
+	TimesliceDefault TimesliceClass = ""
+	TimesliceShort   TimesliceClass = "short"
+	TimesliceMedium  TimesliceClass = "medium"
+	TimesliceLong    TimesliceClass = "long"
+	// TimesliceCustom applies GPUSharingConfig.CustomTimeslice, one of the
+	// values accepted by nvidia-smi compute-policy.
+	TimesliceCustom TimesliceClass = "custom"
+
+	TimesliceAnnotationPrefix = "cloud.google.com/gpu-timeslice"
+	TimesliceClassAnnotation  = TimesliceAnnotationPrefix + ".class"
+	TimesliceValueAnnotation  = TimesliceAnnotationPrefix + ".value"
+
+	// maxTimeslice is the largest timeslice accepted by nvidia-smi compute-policy --set-timeslice.
+	maxTimeslice = 3
+
+	nvidiaSmiBin = "/usr/local/nvidia/bin/nvidia-smi"
+)
+
+// timesliceValues are the values of the timeslice classes known to nvidia-smi compute-policy.
+var timesliceValues = map[TimesliceClass]int{
+	TimesliceDefault: 0,
+	TimesliceShort:   1,
+	TimesliceMedium:  2,
+	TimesliceLong:    3,
+}
+
+// Timeslice reports the timeslice applied to each GPU.
+var Timeslice = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "timeslice",
+		Help: "Timeslice applied to the time-shared GPU: 0 (default), 1 (short), 2 (medium), 3 (long) or a custom value",
+	},
+	[]string{"make", "accelerator_id", "class"})
+
+// timesliceValue returns the value applied to the GPUs for a timeslice class.
+func timesliceValue(class TimesliceClass, custom int) (int, error) {
+	if class == TimesliceCustom {
+		if custom < 0 || custom > maxTimeslice {
+			return 0, fmt.Errorf("invalid custom timeslice %d, should be between 0 and %d", custom, maxTimeslice)
+		}
+		return custom, nil
+	}
+	value, ok := timesliceValues[class]
+	if !ok {
+		return 0, fmt.Errorf("invalid timeslice class: %v, should be one of short, medium, long or custom", class)
+	}
+	return value, nil
+}
+
+// timesliceSetter configures the timeslice of a GPU.
+type timesliceSetter interface {
+	SetTimeslice(uuid string, value int) error
+}
+
+// nvmlTimesliceSetter switches the GPU to the shared compute mode through NVML
+// and sets the timeslice with nvidia-smi compute-policy, which NVML does not expose.
+type nvmlTimesliceSetter struct{}
+
+func (nvmlTimesliceSetter) SetTimeslice(uuid string, value int) error {
+	device, ret := nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("failed to get the device handle for %s: %v", uuid, nvml.ErrorString(ret))
+	}
+	if ret := device.SetComputeMode(nvml.COMPUTEMODE_DEFAULT); ret != nvml.SUCCESS {
+		return fmt.Errorf("failed to set the default compute mode on %s: %v", uuid, nvml.ErrorString(ret))
+	}
+	var out bytes.Buffer
+	cmd := exec.Command(nvidiaSmiBin, "compute-policy", "-i", uuid, "--set-timeslice="+strconv.Itoa(value))
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to set timeslice %d on %s: %v, output: %s", value, uuid, err, out.String())
+	}
+	return nil
+}
+
+// timesliceManager applies the timeslice to the GPUs and reports it.
+type timesliceManager struct {
+	setter     timesliceSetter
+	deviceUUID func(deviceID string) (string, error)
+	kubeClient kubernetes.Interface
+	nodeName   string
+
+	mu sync.Mutex
+	// class and custom are the timeslice last applied. They are kept apart from
+	// the GPU config, which is read concurrently without a lock.
+	class  TimesliceClass
+	custom int
+}
+
+func newTimesliceManager(nvmlOps nvmlutil.NvmlOperations) *timesliceManager {
+	return &timesliceManager{
+		setter:     nvmlTimesliceSetter{},
+		deviceUUID: func(deviceID string) (string, error) { return nvmlDeviceUUID(nvmlOps, deviceID) },
+	}
+}
+
+// apply sets the timeslice on every GPU, then records it in the timeslice
+// metric and, if a kube client is set, in the node annotations.
+func (m *timesliceManager) apply(deviceIDs []string, class TimesliceClass, custom int) error {
+	value, err := timesliceValue(class, custom)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sort.Slice(deviceIDs, func(i, j int) bool { return lessDeviceID(deviceIDs[i], deviceIDs[j]) })
+	Timeslice.Reset()
+	for _, id := range deviceIDs {
+		uuid, err := m.deviceUUID(id)
+		if err != nil {
+			return fmt.Errorf("failed to get UUID of %s: %v", id, err)
+		}
+		if err := m.setter.SetTimeslice(uuid, value); err != nil {
+			return err
+		}
+		Timeslice.WithLabelValues("nvidia", uuid, timesliceClassName(class)).Set(float64(value))
+	}
+	glog.Infof("Applied %s timeslice (%d) to GPUs %v", timesliceClassName(class), value, deviceIDs)
+	m.class, m.custom = class, custom
+
+	if m.kubeClient == nil {
+		return nil
+	}
+	annotations := map[string]string{
+		TimesliceClassAnnotation: timesliceClassName(class),
+		TimesliceValueAnnotation: strconv.Itoa(value),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// A dedicated field manager keeps the annotations applied by other parts of the device plugin.
+	_, err = m.kubeClient.CoreV1().Nodes().Apply(ctx, corev1apply.Node(m.nodeName).WithAnnotations(annotations),
+		metav1.ApplyOptions{FieldManager: "gpu-device-plugin-timeslice", Force: true})
+	if err != nil {
+		return fmt.Errorf("failed to apply node %s timeslice annotations: %v", m.nodeName, err)
+	}
+	return nil
+}
+
+// current returns the timeslice last applied.
+func (m *timesliceManager) current() (TimesliceClass, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.class, m.custom
+}
+
+func timesliceClassName(class TimesliceClass) string {
+	if class == TimesliceDefault {
+		return "default"
+	}
+	return string(class)
+}
@@ -0,0 +1,121 @@
+// Copyright 2026 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nvidia
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+type fakeTimesliceSetter map[string]int
+
+func (f fakeTimesliceSetter) SetTimeslice(uuid string, value int) error {
+	f[uuid] = value
+	return nil
+}
+
+func TestTimesliceValue(t *testing.T) {
+	tests := []struct {
+		class   TimesliceClass
+		custom  int
+		want    int
+		wantErr bool
+	}{
+		{class: TimesliceDefault, want: 0},
+		{class: TimesliceShort, want: 1},
+		{class: TimesliceMedium, want: 2},
+		{class: TimesliceLong, want: 3},
+		{class: TimesliceCustom, custom: 2, want: 2},
+		{class: TimesliceCustom, custom: 4, wantErr: true},
+		{class: TimesliceCustom, custom: -1, wantErr: true},
+		{class: "tiny", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(timesliceClassName(tt.class), func(t *testing.T) {
+			got, err := timesliceValue(tt.class, tt.custom)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("timesliceValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("timesliceValue() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateTimeslice(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	kubeClient := fake.NewSimpleClientset(node)
+	setter := fakeTimesliceSetter{}
+	ngm := &nvidiaGPUManager{
+		devices: map[string]pluginapi.Device{
+			"nvidia0": {ID: "nvidia0", Health: pluginapi.Healthy},
+			"nvidia1": {ID: "nvidia1", Health: pluginapi.Healthy},
+		},
+		gpuConfig: GPUConfig{
+			GPUSharingConfig: GPUSharingConfig{
+				GPUSharingStrategy:     "time-sharing",
+				MaxSharedClientsPerGPU: 2,
+			},
+		},
+		timeslices: &timesliceManager{
+			setter:     setter,
+			deviceUUID: func(deviceID string) (string, error) { return "GPU-" + deviceID, nil },
+		},
+	}
+	ngm.EnableTimesliceAnnotations(kubeClient, "node1")
+
+	if err := ngm.UpdateTimeslice(GPUSharingConfig{TimesliceClass: TimesliceLong}); err != nil {
+		t.Fatalf("UpdateTimeslice() failed: %v", err)
+	}
+	if diff := cmp.Diff(fakeTimesliceSetter{"GPU-nvidia0": 3, "GPU-nvidia1": 3}, setter); diff != "" {
+		t.Errorf("unexpected timeslices (-want, +got) = %s", diff)
+	}
+	if got := testutil.ToFloat64(Timeslice.WithLabelValues("nvidia", "GPU-nvidia1", "long")); got != 3 {
+		t.Errorf("timeslice metric = %v, want 3", got)
+	}
+	if class, _ := ngm.timeslices.current(); class != TimesliceLong {
+		t.Errorf("timeslice class = %q after update, want long", class)
+	}
+
+	// The fake clientset does not implement server-side apply, so only check that it was requested.
+	var applied bool
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "patch" && action.GetResource().Resource == "nodes" {
+			applied = true
+		}
+	}
+	if !applied {
+		t.Errorf("node timeslice annotations were not applied")
+	}
+
+	if err := ngm.UpdateTimeslice(GPUSharingConfig{TimesliceClass: "tiny"}); err == nil {
+		t.Errorf("UpdateTimeslice() with an invalid class succeeded, want error")
+	}
+	if got := testutil.ToFloat64(Timeslice.WithLabelValues("nvidia", "GPU-nvidia1", "long")); got != 3 {
+		t.Errorf("timeslice metric = %v after a failed update, want 3", got)
+	}
+
+	ngm.gpuConfig.GPUSharingConfig.GPUSharingStrategy = "mps"
+	if err := ngm.UpdateTimeslice(GPUSharingConfig{TimesliceClass: TimesliceShort}); err == nil {
+		t.Errorf("UpdateTimeslice() with mps succeeded, want error")
+	}
+}